@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/admin/upload"
+	"github.com/ponzu-cms/ponzu/system/db"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	dryRun bool
+	minAge time.Duration
+)
+
+// ErrWrongOrMissingGCTarget informs a user that the data to garbage collect
+// must be explicitly specified when gc is called
+var ErrWrongOrMissingGCTarget = errors.New("To execute 'ponzu gc', " +
+	"you must specify what to collect, i.e. 'uploads'.")
+
+var gcCmd = &cobra.Command{
+	Use:   "gc [flags] <uploads>",
+	Short: "removes uploaded files which are not used by any content",
+	Long: `Finds the files uploaded to your Ponzu system which are not referenced by
+any content, including content pending approval, and removes their records and
+the files themselves from storage. Files uploaded more recently than the
+--min-age duration are kept, since the content they were uploaded for may not
+have been saved yet.
+
+Since only one process can open the database, stop your Ponzu server before
+running gc. Use --dry-run to list the files which would be removed.`,
+	Example: `$ ponzu gc uploads
+(or)
+$ ponzu gc --dry-run --min-age=72h uploads`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 || args[0] != "uploads" {
+			return ErrWrongOrMissingGCTarget
+		}
+
+		name := buildOutputName()
+		buildPathName := strings.Join([]string{".", name}, string(filepath.Separator))
+
+		return execAndWait(buildPathName,
+			"collect",
+			args[0],
+			fmt.Sprintf("--dry-run=%t", dryRun),
+			fmt.Sprintf("--min-age=%s", minAge),
+		)
+	},
+}
+
+var collectCmd = &cobra.Command{
+	Use:    "collect [flags] <uploads>",
+	Short:  "collect garbage (collect is wrapped by the gc command)",
+	Hidden: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 || args[0] != "uploads" {
+			return ErrWrongOrMissingGCTarget
+		}
+
+		if _, err := os.Stat("system.db"); err != nil {
+			return fmt.Errorf("No system.db found in the current directory: %s", err)
+		}
+
+		db.Init()
+		defer db.Close()
+
+		unused, err := upload.CollectGarbage(minAge, dryRun)
+		for _, file := range unused {
+			if dryRun {
+				fmt.Println("Unused:", file.Path)
+			} else {
+				fmt.Println("Removed:", file.Path)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d unused upload(s) found.\n", len(unused))
+
+		return nil
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{gcCmd, collectCmd} {
+		cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the unused uploads without removing them")
+		cmd.Flags().DurationVar(&minAge, "min-age", 24*time.Hour, "keep uploads more recent than this duration")
+	}
+
+	RegisterCmdlineCommand(gcCmd)
+	RegisterCmdlineCommand(collectCmd)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ponzu-cms/ponzu/system/admin/upload"
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+	"github.com/ponzu-cms/ponzu/system/search"
+
+	"github.com/spf13/cobra"
+)
+
+// ErrWrongOrMissingImportTarget informs a user that the data to import and the
+// directory to import it from must be specified when import is called
+var ErrWrongOrMissingImportTarget = errors.New("To execute 'ponzu import', " +
+	"you must specify what to import and from where, i.e. 'uploads path/to/dir'.")
+
+var importCmd = &cobra.Command{
+	Use:   "import <uploads> <dir>",
+	Short: "imports the files in a directory as uploads",
+	Long: `Stores each file within the directory, and its subdirectories, as if it was
+uploaded through the CMS, so a large media library can be migrated at once. Files
+are checked against the Max Upload Size setting, and hidden files are skipped.
+Files identical to ones already uploaded are not stored again.
+
+Since only one process can open the database, stop your Ponzu server before
+running import.`,
+	Example: `$ ponzu import uploads ~/Pictures/media-library`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 || args[0] != "uploads" {
+			return ErrWrongOrMissingImportTarget
+		}
+
+		dir, err := filepath.Abs(args[1])
+		if err != nil {
+			return err
+		}
+
+		name := buildOutputName()
+		buildPathName := strings.Join([]string{".", name}, string(filepath.Separator))
+
+		return execAndWait(buildPathName, "load", args[0], dir)
+	},
+}
+
+var loadCmd = &cobra.Command{
+	Use:    "load <uploads> <dir>",
+	Short:  "load data (load is wrapped by the import command)",
+	Hidden: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 || args[0] != "uploads" {
+			return ErrWrongOrMissingImportTarget
+		}
+
+		if _, err := os.Stat("system.db"); err != nil {
+			return fmt.Errorf("No system.db found in the current directory: %s", err)
+		}
+
+		fi, err := os.Stat(args[1])
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", args[1])
+		}
+
+		db.Init()
+		defer db.Close()
+
+		err = search.MapIndex("__uploads")
+		if err != nil {
+			return err
+		}
+
+		var failed int
+		imported, err := upload.ImportDir(args[1], func(r upload.Result) {
+			if r.Error != "" {
+				failed++
+				fmt.Println("Failed:", r.Name, "-", r.Error)
+				return
+			}
+
+			fmt.Println("Imported:", r.Name, "->", r.Path)
+
+			// index the upload before exiting, so it can be searched in the CMS
+			j, err := db.UploadByPath(r.Path)
+			if err != nil || j == nil {
+				return
+			}
+
+			var file item.FileUpload
+			err = json.Unmarshal(j, &file)
+			if err != nil {
+				return
+			}
+
+			err = search.UpdateIndex(fmt.Sprintf("__uploads:%d", file.ID), j)
+			if err != nil {
+				fmt.Println("Couldn't add", r.Name, "to search index:", err)
+			}
+		})
+
+		fmt.Printf("%d file(s) imported, %d failed.\n", imported, failed)
+
+		return err
+	},
+}
+
+func init() {
+	RegisterCmdlineCommand(importCmd)
+	RegisterCmdlineCommand(loadCmd)
+}
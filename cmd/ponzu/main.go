@@ -20,6 +20,7 @@ import (
 	"github.com/ponzu-cms/ponzu/system/api"
 	"github.com/ponzu-cms/ponzu/system/api/analytics"
 	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/metrics"
 	"github.com/ponzu-cms/ponzu/system/tls"
 
 	"github.com/spf13/cobra"
@@ -139,6 +140,9 @@ var serveCmd = &cobra.Command{
 		analytics.Init()
 		defer analytics.Close()
 
+		// index which content references each upload, if not yet indexed
+		db.InitUploadRefs()
+
 		services := strings.Split(args[0], ",")
 
 		for _, service := range services {
@@ -151,6 +155,9 @@ var serveCmd = &cobra.Command{
 			}
 		}
 
+		// run metrics endpoint, protected by token or basic auth
+		metrics.Run()
+
 		// run docs server if --docs is true
 		if docs {
 			admin.Docs(docsport)
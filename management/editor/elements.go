@@ -118,7 +118,8 @@ func File(fieldName string, p interface{}, attrs map[string]string) []byte {
 					viewLinkText = document.createTextNode('Download / View '),
 					iconLaunch = document.createElement('i'),
 					iconLaunchText = document.createTextNode('launch'),
-					uploadSrc = store.val();
+					uploadSrc = store.val(),
+					chunkSize = 8 * 1024 * 1024;
 					video.setAttribute
 					preview.hide();
 					viewLink.setAttribute('href', '` + value + `');
@@ -139,6 +140,13 @@ func File(fieldName string, p interface{}, attrs map[string]string) []byte {
 				// add the 'name' attr to ` + name + ` input
 				upload.on('change', function(e) {
 					resetImage();
+
+					// large files are sent in resumable chunks before the
+					// form is saved, instead of with the form
+					var file = this.files && this.files[0];
+					if (file && file.size > chunkSize && file.slice) {
+						resumableUpload(file);
+					}
 				});
 
 				if (uploadSrc.length > 0) {
@@ -204,6 +212,92 @@ func File(fieldName string, p interface{}, attrs map[string]string) []byte {
 					upload.attr('name', '` + name + `');
 					clip.empty();
 				}
+
+				function resumableUpload(file) {
+					var form = $file.closest('form'),
+						submit = form.find('button[type=submit]'),
+						filePath = $file.find('input.file-path'),
+						type = (window.location.search.match(/[?&]type=([^&]*)/) || [])[1] || '',
+						meta = [
+							'filename ' + btoa(unescape(encodeURIComponent(file.name))),
+							'type ' + btoa(decodeURIComponent(type)),
+							'field ' + btoa('` + name + `')
+						].join(',');
+
+					upload.attr('name', '');
+					submit.prop('disabled', true);
+
+					var xhr = new XMLHttpRequest();
+					xhr.open('POST', '/api/uploads/tus/');
+					xhr.setRequestHeader('Tus-Resumable', '1.0.0');
+					xhr.setRequestHeader('Upload-Length', file.size);
+					xhr.setRequestHeader('Upload-Metadata', meta);
+					xhr.onload = function() {
+						if (xhr.status !== 201) {
+							return failed();
+						}
+
+						send(xhr.getResponseHeader('Location'), 0, 0);
+					};
+					xhr.onerror = failed;
+					xhr.send();
+
+					function send(location, offset, retries) {
+						var patch = new XMLHttpRequest();
+						patch.open('PATCH', location);
+						patch.setRequestHeader('Tus-Resumable', '1.0.0');
+						patch.setRequestHeader('Upload-Offset', offset);
+						patch.setRequestHeader('Content-Type', 'application/offset+octet-stream');
+						patch.onload = function() {
+							if (patch.status !== 204) {
+								return failed();
+							}
+
+							offset = parseInt(patch.getResponseHeader('Upload-Offset'), 10);
+							if (offset < file.size) {
+								filePath.val(file.name + ' (' + Math.floor(offset / file.size * 100) + '%)');
+								return send(location, offset, 0);
+							}
+
+							store.val(patch.getResponseHeader('Ponzu-Upload-Path'));
+							store.attr('name', '` + name + `');
+							upload.val('');
+							filePath.val(file.name);
+							submit.prop('disabled', false);
+						};
+						patch.onerror = function() {
+							if (retries >= 5) {
+								return failed();
+							}
+
+							// resume from the offset the server has after the
+							// connection was interrupted
+							setTimeout(function() {
+								var head = new XMLHttpRequest();
+								head.open('HEAD', location);
+								head.setRequestHeader('Tus-Resumable', '1.0.0');
+								head.onload = function() {
+									if (head.status !== 200) {
+										return failed();
+									}
+
+									send(location, parseInt(head.getResponseHeader('Upload-Offset'), 10), retries + 1);
+								};
+								head.onerror = function() {
+									send(location, offset, retries + 1);
+								};
+								head.send();
+							}, 1000 * (retries + 1));
+						};
+						patch.send(file.slice(offset, offset + chunkSize));
+					}
+
+					function failed() {
+						upload.val('');
+						filePath.val(file.name + ' (upload failed)');
+						submit.prop('disabled', false);
+					}
+				}
 			});	
 		</script>`
 
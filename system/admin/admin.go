@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"strconv"
 
 	"github.com/ponzu-cms/ponzu/system/admin/user"
 	"github.com/ponzu-cms/ponzu/system/api/analytics"
@@ -498,9 +499,34 @@ var analyticsHTML = `
 <div class="analytics">
 <div class="card">
 <div class="card-content">
-    <p class="right">Data range: {{ .from }} - {{ .to }} (UTC)</p>
+    <p class="right">
+        Data range: {{ .from }} - {{ .to }} (UTC)
+        &nbsp;|&nbsp;
+        {{ range $days := .ranges }}
+        <a class="analytics-range{{ if eq $days $.days }} active{{ end }}" href="/admin?range={{ $days }}">{{ if eq $days 1 }}Today{{ else }}{{ $days }} days{{ end }}</a>
+        {{ end }}
+    </p>
     <div class="card-title">API Requests</div>
     <canvas id="analytics-chart"></canvas>
+    <form class="analytics-export row" action="/admin/analytics/export" method="get">
+        <div class="input-field col s3">
+            <select class="browser-default" name="period">
+                <option value="day">Daily</option>
+                <option value="week">Weekly</option>
+                <option value="month">Monthly</option>
+            </select>
+        </div>
+        <div class="input-field col s3">
+            <input type="date" name="from" placeholder="From (YYYY-MM-DD)"/>
+        </div>
+        <div class="input-field col s3">
+            <input type="date" name="to" placeholder="To (YYYY-MM-DD)"/>
+        </div>
+        <div class="input-field col s3">
+            <button class="btn waves-effect waves-light" type="submit" name="format" value="csv">CSV</button>
+            <button class="btn waves-effect waves-light" type="submit" name="format" value="json">JSON</button>
+        </div>
+    </form>
     <script>
     var target = document.getElementById("analytics-chart");
     Chart.defaults.global.defaultFontColor = '#212121';
@@ -540,18 +566,106 @@ var analyticsHTML = `
     </script>
 </div>
 </div>
+{{ with .report }}
+<div class="card">
+<div class="card-content">
+    <p class="right">
+        Errors: {{ .Errors }}
+        &nbsp;|&nbsp;
+        Latency (ms): avg {{ .Latency.Avg }}, p50 {{ .Latency.P50 }}, p95 {{ .Latency.P95 }}, p99 {{ .Latency.P99 }}, max {{ .Latency.Max }}
+    </p>
+    <div class="card-title">{{ .Total }} Requests from {{ .Unique }} Clients</div>
+    <form class="analytics-purge __ponzu" action="/admin/analytics/purge" method="post">
+        <p>Client IP addresses are not stored, and clients which send a "Do Not Track" or "Global Privacy Control" header are not recorded.
+        <a class="purge-link" href="#">Purge all request data</a></p>
+    </form>
+    <script>
+    $(function() {
+        $('.analytics-purge .purge-link').on('click', function(e) {
+            e.preventDefault();
+            if (confirm("[Ponzu] Please confirm:\n\nAre you sure you want to purge all API request data?\nDaily totals will be kept, but this cannot be undone.")) {
+                $('.analytics-purge').submit();
+            }
+        });
+    });
+    </script>
+    <div class="row">
+        {{ template "counts" map "Title" "Endpoints" "Counts" .Endpoints }}
+        {{ template "counts" map "Title" "Content Types" "Counts" .Types }}
+    </div>
+    <div class="row">
+        {{ template "counts" map "Title" "Items" "Counts" .Items }}
+        {{ template "counts" map "Title" "Status Codes" "Counts" .Statuses }}
+    </div>
+</div>
 </div>
+{{ end }}
+</div>
+{{ define "counts" }}
+<div class="col s12 l6">
+    <table class="striped analytics-counts">
+        <thead>
+            <tr>
+                <th>{{ .Title }}</th>
+                <th>Total</th>
+                <th>Unique</th>
+                <th>Errors</th>
+                <th>Avg ms</th>
+            </tr>
+        </thead>
+        <tbody>
+            {{ range $count := .Counts }}
+            <tr>
+                <td>{{ $count.Key }}</td>
+                <td>{{ $count.Total }}</td>
+                <td>{{ $count.Unique }}</td>
+                <td>{{ $count.Errors }}</td>
+                <td>{{ $count.Latency }}</td>
+            </tr>
+            {{ else }}
+            <tr><td colspan="5">No requests recorded.</td></tr>
+            {{ end }}
+        </tbody>
+    </table>
+</div>
+{{ end }}
 `
 
-// Dashboard returns the admin view with analytics dashboard
-func Dashboard() ([]byte, error) {
+// Dashboard returns the admin view with analytics dashboard, showing the range
+// of days selected by the request's "range" query parameter
+func Dashboard(req *http.Request) ([]byte, error) {
+	days, err := strconv.Atoi(req.URL.Query().Get("range"))
+	if err != nil {
+		days = analytics.Retention()
+	}
+
 	buf := &bytes.Buffer{}
-	data, err := analytics.ChartData()
+	data, err := analytics.ChartData(days)
 	if err != nil {
 		return nil, err
 	}
 
-	tmpl := template.Must(template.New("analytics").Parse(analyticsHTML))
+	report, err := analytics.Breakdown(days, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	data["report"] = report
+	data["days"] = report.Days
+	data["ranges"] = analyticsRanges()
+
+	funcs := template.FuncMap{
+		"map": func(pairs ...interface{}) map[string]interface{} {
+			m := make(map[string]interface{})
+			for i := 0; i+1 < len(pairs); i += 2 {
+				m[pairs[i].(string)] = pairs[i+1]
+			}
+
+			return m
+		},
+	}
+
+	tmpl := template.Must(template.New("analytics").Funcs(funcs).Parse(analyticsHTML))
 	err = tmpl.Execute(buf, data)
 	if err != nil {
 		return nil, err
@@ -559,6 +673,21 @@ func Dashboard() ([]byte, error) {
 	return Admin(buf.Bytes())
 }
 
+// analyticsRanges returns the number of days which can be selected to view on
+// the analytics dashboard, up to the analytics retention period
+func analyticsRanges() []int {
+	retention := analytics.Retention()
+
+	var ranges []int
+	for _, days := range []int{1, 7, 30} {
+		if days < retention {
+			ranges = append(ranges, days)
+		}
+	}
+
+	return append(ranges, retention)
+}
+
 var err400HTML = []byte(`
 <div class="error-page e400 col s6">
 <div class="card">
@@ -25,8 +25,24 @@ type Config struct {
 	DisableHTTPCache        bool     `json:"cache_disabled"`
 	CacheMaxAge             int64    `json:"cache_max_age"`
 	CacheInvalidate         []string `json:"cache"`
+	EnableGraphQL           bool     `json:"graphql_enabled"`
 	BackupBasicAuthUser     string   `json:"backup_basic_auth_user"`
 	BackupBasicAuthPassword string   `json:"backup_basic_auth_password"`
+	AnalyticsRetention      int64    `json:"analytics_retention"`
+	AnalyticsIPMode         string   `json:"analytics_ip_mode"`
+	MetricsToken            string   `json:"metrics_token"`
+	StorageBackend          string   `json:"storage_backend"`
+	S3Endpoint              string   `json:"s3_endpoint"`
+	S3Region                string   `json:"s3_region"`
+	S3Bucket                string   `json:"s3_bucket"`
+	S3Prefix                string   `json:"s3_prefix"`
+	S3AccessKey             string   `json:"s3_access_key"`
+	S3SecretKey             string   `json:"s3_secret_key"`
+	S3PathStyle             bool     `json:"s3_path_style"`
+	ImageSignedURLs         bool     `json:"image_signed_urls"`
+	UploadMaxSize           int64    `json:"upload_max_size"`
+	UploadImportMaxSize     int64    `json:"upload_import_max_size"`
+	UploadKeepMetadata      bool     `json:"upload_keep_metadata"`
 }
 
 const (
@@ -34,6 +50,31 @@ const (
 		<p class="flow-text">Database Backup Credentials:</p>
 		<p>Add a user name and password to download a backup of your data via HTTP.</p>
 	`
+
+	metricsInfo = `
+		<p class="flow-text">Server Metrics:</p>
+		<p>Add a token to collect metrics from /metrics as a Bearer token. Without one, the backup credentials above are required.</p>
+	`
+
+	storageInfo = `
+		<p class="flow-text">Upload Storage:</p>
+		<p>Choose where uploaded files are stored. Files are always served from /api/uploads, so changing storage does not move files which were already uploaded.</p>
+	`
+
+	uploadInfo = `
+		<p class="flow-text">Upload Limits:</p>
+		<p>Set the largest file which can be uploaded, unless a content type sets its own limit for the field, and the largest .zip archive which can be imported. Location and other private metadata are removed from uploaded JPEG and PNG photos, unless they are kept below.</p>
+	`
+
+	imageInfo = `
+		<p class="flow-text">Image Transforms:</p>
+		<p>Uploaded images can be resized and converted with the w, h, fit, q and fmt parameters. Require signed URLs to stop clients from requesting arbitrary sizes.</p>
+	`
+
+	analyticsInfo = `
+		<p class="flow-text">API Analytics:</p>
+		<p>Choose how long API requests are kept and how clients are identified. IP addresses are never stored.</p>
+	`
 )
 
 // String partially implements item.Identifiable and overrides Item's String()
@@ -130,6 +171,13 @@ func (c *Config) MarshalEditor() ([]byte, error) {
 				"invalidate": "Invalidate Cache",
 			}),
 		},
+		editor.Field{
+			View: editor.Checkbox("EnableGraphQL", c, map[string]string{
+				"label": "GraphQL API (served from /api/graphql)",
+			}, map[string]string{
+				"true": "Enable GraphQL",
+			}),
+		},
 		editor.Field{
 			View: []byte(dbBackupInfo),
 		},
@@ -147,6 +195,120 @@ func (c *Config) MarshalEditor() ([]byte, error) {
 				"type":        "password",
 			}),
 		},
+		editor.Field{
+			View: []byte(uploadInfo),
+		},
+		editor.Field{
+			View: editor.Input("UploadMaxSize", c, map[string]string{
+				"label": "Max upload size in MB (0 = unlimited)",
+				"type":  "text",
+			}),
+		},
+		editor.Field{
+			View: editor.Input("UploadImportMaxSize", c, map[string]string{
+				"label": "Max import archive size in MB (0 = 1024)",
+				"type":  "text",
+			}),
+		},
+		editor.Field{
+			View: editor.Checkbox("UploadKeepMetadata", c, map[string]string{
+				"label": "Photo Metadata",
+			}, map[string]string{
+				"true": "Keep location and other private metadata in uploaded photos",
+			}),
+		},
+		editor.Field{
+			View: []byte(storageInfo),
+		},
+		editor.Field{
+			View: editor.Select("StorageBackend", c, map[string]string{
+				"label": "Storage Backend (None = local)",
+			}, map[string]string{
+				"local": "Local disk (./uploads)",
+				"s3":    "S3-compatible object storage",
+			}),
+		},
+		editor.Field{
+			View: editor.Input("S3Endpoint", c, map[string]string{
+				"label":       "S3 Endpoint",
+				"placeholder": "e.g. https://s3.us-east-1.amazonaws.com or http://localhost:9000",
+			}),
+		},
+		editor.Field{
+			View: editor.Input("S3Region", c, map[string]string{
+				"label":       "S3 Region",
+				"placeholder": "e.g. us-east-1",
+			}),
+		},
+		editor.Field{
+			View: editor.Input("S3Bucket", c, map[string]string{
+				"label":       "S3 Bucket",
+				"placeholder": "Enter the name of the bucket to store uploads in",
+			}),
+		},
+		editor.Field{
+			View: editor.Input("S3Prefix", c, map[string]string{
+				"label":       "S3 Key Prefix (optional)",
+				"placeholder": "e.g. uploads",
+			}),
+		},
+		editor.Field{
+			View: editor.Input("S3AccessKey", c, map[string]string{
+				"label":       "S3 Access Key",
+				"placeholder": "Enter the access key ID",
+			}),
+		},
+		editor.Field{
+			View: editor.Input("S3SecretKey", c, map[string]string{
+				"label":       "S3 Secret Key",
+				"placeholder": "Enter the secret access key",
+				"type":        "password",
+			}),
+		},
+		editor.Field{
+			View: editor.Checkbox("S3PathStyle", c, map[string]string{
+				"label": "Path-style bucket addressing (required by most self-hosted object stores)",
+			}, map[string]string{
+				"true": "Use path-style addressing",
+			}),
+		},
+		editor.Field{
+			View: []byte(imageInfo),
+		},
+		editor.Field{
+			View: editor.Checkbox("ImageSignedURLs", c, map[string]string{
+				"label": "Signed image URLs (signed with the Client Secret)",
+			}, map[string]string{
+				"true": "Require a signature for image transforms",
+			}),
+		},
+		editor.Field{
+			View: []byte(metricsInfo),
+		},
+		editor.Field{
+			View: editor.Input("MetricsToken", c, map[string]string{
+				"label":       "Metrics Token",
+				"placeholder": "Enter a token for Bearer auth access",
+				"type":        "password",
+			}),
+		},
+		editor.Field{
+			View: []byte(analyticsInfo),
+		},
+		editor.Field{
+			View: editor.Input("AnalyticsRetention", c, map[string]string{
+				"label": "Days to keep API requests (0 = 14)",
+				"type":  "text",
+			}),
+		},
+		editor.Field{
+			View: editor.Select("AnalyticsIPMode", c, map[string]string{
+				"label": "Client identifiers (None = hash, rotated daily)",
+			}, map[string]string{
+				"hash":     "Hash of IP address, rotated daily",
+				"truncate": "Truncated IP address (IPv4 /24, IPv6 /48)",
+			}),
+		},
 	)
 	if err != nil {
 		return nil, err
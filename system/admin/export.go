@@ -2,15 +2,18 @@ package admin
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/ponzu-cms/ponzu/management/format"
+	"github.com/ponzu-cms/ponzu/system/api/analytics"
 	"github.com/ponzu-cms/ponzu/system/db"
 	"github.com/ponzu-cms/ponzu/system/item"
 
@@ -140,3 +143,117 @@ func exportCSV(res http.ResponseWriter, req *http.Request, pt func() interface{}
 		log.Println("Failed to remove tmp file for CSV export:", err)
 	}
 }
+
+func analyticsExportHandler(res http.ResponseWriter, req *http.Request) {
+	// /admin/analytics/export?format=csv&period=day&from=2017-01-01&to=2017-12-31
+	q := req.URL.Query()
+	f := strings.ToLower(q.Get("format"))
+	period := strings.ToLower(q.Get("period"))
+	if period == "" {
+		period = analytics.PeriodDay
+	}
+
+	// from defaults to the earliest rollup, and to defaults to today
+	var from time.Time
+	to := time.Now()
+	var err error
+	if q.Get("from") != "" {
+		from, err = time.Parse("2006-01-02", q.Get("from"))
+	}
+	if err == nil && q.Get("to") != "" {
+		to, err = time.Parse("2006-01-02", q.Get("to"))
+	}
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		errView, err := Error400()
+		if err != nil {
+			return
+		}
+
+		res.Write(errView)
+		return
+	}
+
+	rollups, err := analytics.Rollups(period, from, to)
+	if err != nil {
+		log.Println("Failed to get analytics rollups for export:", err)
+		res.WriteHeader(http.StatusBadRequest)
+		errView, err := Error400()
+		if err != nil {
+			return
+		}
+
+		res.Write(errView)
+		return
+	}
+
+	ts := time.Now().Unix()
+	disposition := `attachment; filename="analytics-%s-%d.%s"`
+
+	switch f {
+	case "json":
+		if rollups == nil {
+			rollups = []analytics.Rollup{}
+		}
+
+		j, err := json.Marshal(map[string]interface{}{"data": rollups})
+		if err != nil {
+			log.Println("Failed to encode analytics export:", err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		res.Header().Set("Content-Disposition", fmt.Sprintf(disposition, period, ts, f))
+		res.Write(j)
+
+	case "csv", "":
+		res.Header().Set("Content-Type", "text/csv")
+		res.Header().Set("Content-Disposition", fmt.Sprintf(disposition, period, ts, "csv"))
+
+		w := csv.NewWriter(res)
+		w.Write([]string{
+			"period", "date", "total", "unique", "errors", "avg_latency_ms",
+			"endpoints", "content_types", "status_codes",
+		})
+
+		for _, r := range rollups {
+			w.Write([]string{
+				r.Period,
+				r.Date,
+				fmt.Sprintf("%d", r.Total),
+				fmt.Sprintf("%d", r.Unique),
+				fmt.Sprintf("%d", r.Errors),
+				fmt.Sprintf("%.3f", r.Latency),
+				csvCounts(r.Endpoints),
+				csvCounts(r.Types),
+				csvCounts(r.Statuses),
+			})
+		}
+
+		w.Flush()
+		if err := w.Error(); err != nil {
+			log.Println("Failed to write analytics CSV export:", err)
+		}
+
+	default:
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+}
+
+// csvCounts formats a set of counts for a single CSV cell, i.e. "key=1;key2=2"
+func csvCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	cell := make([]string, 0, len(keys))
+	for _, k := range keys {
+		cell = append(cell, fmt.Sprintf("%s=%d", k, counts[k]))
+	}
+
+	return strings.Join(cell, ";")
+}
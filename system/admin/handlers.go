@@ -6,8 +6,11 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -32,7 +35,7 @@ import (
 )
 
 func adminHandler(res http.ResponseWriter, req *http.Request) {
-	view, err := Dashboard()
+	view, err := Dashboard(req)
 	if err != nil {
 		log.Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -196,6 +199,87 @@ func configHandler(res http.ResponseWriter, req *http.Request) {
 
 }
 
+func analyticsHandler(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := req.URL.Query()
+	days, err := strconv.Atoi(q.Get("range")) // int: number of days including today (retention period default)
+	if err != nil {
+		days = analytics.Retention()
+	}
+
+	limit, err := strconv.Atoi(q.Get("limit")) // int: number of entries in each list (10 default)
+	if err != nil {
+		limit = 10
+	}
+
+	report, err := analytics.Breakdown(days, limit)
+	if err != nil {
+		log.Println("Failed to create analytics report:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	chart, err := analytics.ChartData(report.Days)
+	if err != nil {
+		log.Println("Failed to create analytics chart data:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	j, err := json.Marshal(map[string]interface{}{
+		"data": []interface{}{
+			map[string]interface{}{
+				"report": report,
+				"daily": map[string]interface{}{
+					"dates":  chart["dates"],
+					"total":  json.RawMessage(chart["total"].(string)),
+					"unique": json.RawMessage(chart["unique"].(string)),
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Failed to encode analytics report:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Write(j)
+}
+
+func analyticsPurgeHandler(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		errView, err := Error405()
+		if err != nil {
+			return
+		}
+
+		res.Write(errView)
+		return
+	}
+
+	err := analytics.Purge()
+	if err != nil {
+		log.Println("Failed to purge analytics:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		errView, err := Error500()
+		if err != nil {
+			return
+		}
+
+		res.Write(errView)
+		return
+	}
+
+	http.Redirect(res, req, req.URL.Scheme+req.URL.Host+"/admin", http.StatusFound)
+}
+
 func backupHandler(res http.ResponseWriter, req *http.Request) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -897,6 +981,35 @@ func uploadContentsHandler(res http.ResponseWriter, req *http.Request) {
 		Order:  order,
 	}
 
+	// filter by the kind of file (the first part of its content type) and tag
+	kind := strings.ToLower(q.Get("kind"))
+	tag := q.Get("tag")
+
+	filters := url.Values{}
+	if kind != "" {
+		filters.Set("kind", kind)
+	}
+	if tag != "" {
+		filters.Set("tag", tag)
+	}
+
+	kindOptions := ""
+	for _, k := range [][2]string{
+		{"", "All Files"},
+		{"image", "Images"},
+		{"video", "Video"},
+		{"audio", "Audio"},
+		{"application", "Documents"},
+		{"text", "Text"},
+	} {
+		selected := ""
+		if k[0] == kind {
+			selected = " selected"
+		}
+		kindOptions += `<option value="` + k[0] + `"` + selected + `>` + k[1] + `</option>`
+	}
+	tagValue := html.EscapeString(tag)
+
 	b := &bytes.Buffer{}
 	var total int
 	var posts [][]byte
@@ -922,7 +1035,9 @@ func uploadContentsHandler(res http.ResponseWriter, req *http.Request) {
 										var path = window.location.pathname;
 										var s = sort.val();
 
-										window.location.replace(path + '?order=' + s);
+										var filters = $('form.__ponzu.upload-filters').serialize();
+
+										window.location.replace(path + '?order=' + s + (filters ? '&' + filters : ''));
 									});
 
 									var order = getParam('order');
@@ -942,11 +1057,50 @@ func uploadContentsHandler(res http.ResponseWriter, req *http.Request) {
 							<input type="hidden" name="type" value="__uploads" />
 						</div>
                     </form>	
-					</div>`
+					</div>
+					<form class="row __ponzu upload-filters" action="/admin/uploads" method="get">
+						<div class="col s4 input-field inline">
+							<select class="browser-default" name="kind">` + kindOptions + `</select>
+							<label class="active">Show:</label>
+						</div>
+						<div class="col s4 input-field inline">
+							<input type="text" name="tag" value="` + tagValue + `" placeholder="Any tag"/>
+							<label class="active">Tagged:</label>
+						</div>
+						<div class="col s4 input-field inline">
+							<button class="btn-flat waves-effect" type="submit">Filter</button>
+						</div>
+					</form>
+					<script>
+						$(function() {
+							var filters = $('form.__ponzu.upload-filters');
+
+							filters.find('select[name=kind]').on('change', function() {
+								filters.submit();
+							});
+
+							filters.on('submit', function() {
+								filters.find('input, select').each(function() {
+									if ($(this).val() === '') {
+										$(this).attr('name', '');
+									}
+								});
+
+								var order = getParam('order');
+								if (order !== '') {
+									filters.append('<input type="hidden" name="order" value="' + order + '"/>');
+								}
+							});
+						});
+					</script>`
 
 	t := "__uploads"
 	status := ""
-	total, posts = db.Query(t, opts)
+	if kind != "" || tag != "" {
+		total, posts = filterUploads(kind, tag, opts)
+	} else {
+		total, posts = db.Query(t, opts)
+	}
 
 	for i := range posts {
 		err := json.Unmarshal(posts[i], &p)
@@ -1020,6 +1174,9 @@ func uploadContentsHandler(res http.ResponseWriter, req *http.Request) {
 
 	// set up pagination values
 	urlFmt := req.URL.Path + "?count=%d&offset=%d&&order=%s"
+	if len(filters) > 0 {
+		urlFmt += "&" + strings.Replace(filters.Encode(), "%", "%%", -1)
+	}
 	prevURL := fmt.Sprintf(urlFmt, count, offset-1, order)
 	nextURL := fmt.Sprintf(urlFmt, count, offset+1, order)
 	start := 1 + count*offset
@@ -1083,7 +1240,7 @@ func uploadContentsHandler(res http.ResponseWriter, req *http.Request) {
 	</script>
 	`
 
-	btn := `<div class="col s3"><a href="/admin/edit/upload" class="btn new-post waves-effect waves-light">New Upload</a></div></div>`
+	btn := `<div class="col s3"><a href="/admin/edit/upload" class="btn new-post waves-effect waves-light">New Upload</a>` + uploadDropZone + `</div></div>`
 	html = html + b.String() + script + btn
 
 	adminView, err := Admin([]byte(html))
@@ -1811,7 +1968,22 @@ func editHandler(res http.ResponseWriter, req *http.Request) {
 		res.Write(adminView)
 
 	case http.MethodPost:
+		// the content type is in the form, so uploads are limited to the size
+		// allowed by any type until it is read
+		max := upload.LimitBody(res, req, nil)
+
 		err := req.ParseMultipartForm(1024 * 1024 * 4) // maxMemory 4MB
+		if upload.TooLarge(err) {
+			log.Println(err)
+			res.WriteHeader(http.StatusRequestEntityTooLarge)
+			errView, err := ErrorMessage("Upload Rejected", "Files are larger than "+item.FmtBytes(float64(max)))
+			if err != nil {
+				return
+			}
+
+			res.Write(errView)
+			return
+		}
 		if err != nil {
 			log.Println(err)
 			res.WriteHeader(http.StatusInternalServerError)
@@ -1839,7 +2011,24 @@ func editHandler(res http.ResponseWriter, req *http.Request) {
 			req.PostForm.Set("updated", ts)
 		}
 
-		urlPaths, err := upload.StoreFiles(req)
+		// files are validated against the upload rules of the content type
+		var rules interface{}
+		if p, ok := item.Types[t]; ok {
+			rules = p()
+		}
+
+		urlPaths, err := upload.StoreFilesFor(req, rules)
+		if e, ok := err.(*upload.Error); ok {
+			log.Println(err)
+			res.WriteHeader(e.Status)
+			errView, err := ErrorMessage("Upload Rejected", html.EscapeString(e.Error()))
+			if err != nil {
+				return
+			}
+
+			res.Write(errView)
+			return
+		}
 		if err != nil {
 			log.Println(err)
 			res.WriteHeader(http.StatusInternalServerError)
@@ -2193,13 +2382,52 @@ func deleteUploadHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	data, err := db.Upload(t + ":" + id)
+	if err != nil {
+		log.Println(err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	file := &item.FileUpload{}
+	err = json.Unmarshal(data, file)
+	if err != nil {
+		log.Println(err)
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// files still referenced by content are only removed once the deletion
+	// is confirmed, knowing which content will be left without them
+	refs, err := db.UploadReferences(file.Path)
+	if err != nil {
+		log.Println(err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(refs) > 0 && req.FormValue("confirm") != "true" {
+		res.WriteHeader(http.StatusConflict)
+		confirmView, err := Admin(adminUploadDeleteConfirm(id, file, refs))
+		if err != nil {
+			return
+		}
+
+		res.Write(confirmView)
+		return
+	}
+
+	if len(refs) > 0 {
+		log.Println("Deleting upload", file.Path, "used by", strings.Join(refs, ", "))
+	}
+
 	err = hook.BeforeDelete(res, req)
 	if err != nil {
 		log.Println("Error running BeforeDelete method in deleteHandler for:", t, err)
 		return
 	}
 
-	err = db.DeleteUpload(t + ":" + id)
+	err = upload.Delete(file)
 	if err != nil {
 		log.Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -2285,6 +2513,15 @@ func editUploadHandler(res http.ResponseWriter, req *http.Request) {
 			return
 		}
 
+		if i != "" {
+			refs, err := db.UploadReferences(post.Path)
+			if err != nil {
+				log.Println(err)
+			}
+
+			m = append(m, adminUploadUsedBy(refs)...)
+		}
+
 		adminView, err := Admin(m)
 		if err != nil {
 			log.Println(err)
@@ -2296,7 +2533,21 @@ func editUploadHandler(res http.ResponseWriter, req *http.Request) {
 		res.Write(adminView)
 
 	case http.MethodPost:
+		// uploads larger than allowed are rejected before they are read
+		max := upload.LimitBody(res, req, nil)
+
 		err := req.ParseMultipartForm(1024 * 1024 * 4) // maxMemory 4MB
+		if upload.TooLarge(err) {
+			log.Println(err)
+			res.WriteHeader(http.StatusRequestEntityTooLarge)
+			errView, err := ErrorMessage("Upload Rejected", "Files are larger than "+item.FmtBytes(float64(max)))
+			if err != nil {
+				return
+			}
+
+			res.Write(errView)
+			return
+		}
 		if err != nil {
 			log.Println(err)
 			res.WriteHeader(http.StatusInternalServerError)
@@ -2346,6 +2597,17 @@ func editUploadHandler(res http.ResponseWriter, req *http.Request) {
 
 		// StoreFiles has the SetUpload call (which is equivalent of SetContent in other handlers)
 		urlPaths, err := upload.StoreFiles(req)
+		if e, ok := err.(*upload.Error); ok {
+			log.Println(err)
+			res.WriteHeader(e.Status)
+			errView, err := ErrorMessage("Upload Rejected", html.EscapeString(e.Error()))
+			if err != nil {
+				return
+			}
+
+			res.Write(errView)
+			return
+		}
 		if err != nil {
 			log.Println(err)
 			res.WriteHeader(http.StatusInternalServerError)
@@ -2409,6 +2671,23 @@ func editUploadHandler(res http.ResponseWriter, req *http.Request) {
 			}
 		}
 
+		// saving an existing upload without a new file updates its metadata
+		id := req.PostForm.Get("id")
+		if id != "" && id != "-1" && len(urlPaths) == 0 {
+			err = db.UpdateUpload(pt+":"+id, req.PostForm)
+			if err != nil {
+				log.Println(err)
+				res.WriteHeader(http.StatusBadRequest)
+				errView, err := ErrorMessage("Metadata Not Saved", html.EscapeString(err.Error()))
+				if err != nil {
+					return
+				}
+
+				res.Write(errView)
+				return
+			}
+		}
+
 		err = hook.AfterSave(res, req)
 		if err != nil {
 			log.Println("Error running AfterSave method in editHandler for:", t, err)
@@ -2418,10 +2697,18 @@ func editUploadHandler(res http.ResponseWriter, req *http.Request) {
 		scheme := req.URL.Scheme
 		host := req.URL.Host
 		redir := scheme + host + "/admin/uploads"
+		if id != "" && id != "-1" && len(urlPaths) == 0 {
+			redir = scheme + host + "/admin/edit/upload?id=" + id
+		}
 		http.Redirect(res, req, redir, http.StatusFound)
 
 	case http.MethodPut:
 		urlPaths, err := upload.StoreFiles(req)
+		if e, ok := err.(*upload.Error); ok {
+			log.Println(err)
+			http.Error(res, e.Error(), e.Status)
+			return
+		}
 		if err != nil {
 			log.Println("Couldn't store file uploads.", err)
 			res.WriteHeader(http.StatusInternalServerError)
@@ -2458,11 +2745,11 @@ func editUploadHandler(res http.ResponseWriter, req *http.Request) {
 func searchHandler(res http.ResponseWriter, req *http.Request) {
 	q := req.URL.Query()
 	t := q.Get("type")
-	search := q.Get("q")
+	query := q.Get("q")
 	status := q.Get("status")
 	var specifier string
 
-	if t == "" || search == "" {
+	if t == "" || query == "" {
 		http.Redirect(res, req, req.URL.Scheme+req.URL.Host+"/admin", http.StatusFound)
 		return
 	}
@@ -2471,7 +2758,11 @@ func searchHandler(res http.ResponseWriter, req *http.Request) {
 		specifier = "__" + status
 	}
 
-	posts := db.ContentAll(t + specifier)
+	count, offset, ok := searchPage(res, req)
+	if !ok {
+		return
+	}
+
 	b := &bytes.Buffer{}
 	pt, ok := item.Types[t]
 	if !ok {
@@ -2499,14 +2790,20 @@ func searchHandler(res http.ResponseWriter, req *http.Request) {
 					</div>
 					<ul class="posts row">`
 
-	for i := range posts {
-		// skip posts that don't have any matching search criteria
-		match := strings.ToLower(search)
-		all := strings.ToLower(string(posts[i]))
-		if !strings.Contains(all, match) {
-			continue
-		}
+	// pending content is not indexed, so it is always searched by scanning
+	var posts [][]byte
+	var matches []search.Match
+	var total int
+	var indexed bool
+	if specifier == "" {
+		posts, matches, total, indexed = searchIndex(t, query, count, offset)
+	}
 
+	if !indexed {
+		posts = searchScan(db.ContentAll(t+specifier), query)
+	}
+
+	for i := range posts {
 		err := json.Unmarshal(posts[i], &p)
 		if err != nil {
 			log.Println("Error unmarshal search result json into", t, err, posts[i])
@@ -2529,6 +2826,9 @@ func searchHandler(res http.ResponseWriter, req *http.Request) {
 		}
 
 		post := adminPostListItem(p, t, status)
+		if indexed {
+			post = append(post, adminSearchFragments(matches[i].Fragments)...)
+		}
 		_, err = b.Write([]byte(post))
 		if err != nil {
 			log.Println(err)
@@ -2544,7 +2844,13 @@ func searchHandler(res http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	_, err := b.WriteString(`</ul></div></div>`)
+	_, err := b.WriteString(`</ul>`)
+	if err == nil && indexed {
+		_, err = b.WriteString(adminPagination(req, total, count, offset))
+	}
+	if err == nil {
+		_, err = b.WriteString(`</div></div>`)
+	}
 	if err != nil {
 		log.Println(err)
 
@@ -2599,15 +2905,19 @@ func searchHandler(res http.ResponseWriter, req *http.Request) {
 func uploadSearchHandler(res http.ResponseWriter, req *http.Request) {
 	q := req.URL.Query()
 	t := "__uploads"
-	search := q.Get("q")
+	query := q.Get("q")
 	status := q.Get("status")
 
-	if t == "" || search == "" {
+	if t == "" || query == "" {
 		http.Redirect(res, req, req.URL.Scheme+req.URL.Host+"/admin", http.StatusFound)
 		return
 	}
 
-	posts := db.UploadAll()
+	count, offset, ok := searchPage(res, req)
+	if !ok {
+		return
+	}
+
 	b := &bytes.Buffer{}
 	p := interface{}(&item.FileUpload{}).(editor.Editable)
 
@@ -2626,14 +2936,12 @@ func uploadSearchHandler(res http.ResponseWriter, req *http.Request) {
 					</div>
 					<ul class="posts row">`
 
-	for i := range posts {
-		// skip posts that don't have any matching search criteria
-		match := strings.ToLower(search)
-		all := strings.ToLower(string(posts[i]))
-		if !strings.Contains(all, match) {
-			continue
-		}
+	posts, matches, total, indexed := searchIndex(t, query, count, offset)
+	if !indexed {
+		posts = searchScan(db.UploadAll(), query)
+	}
 
+	for i := range posts {
 		err := json.Unmarshal(posts[i], &p)
 		if err != nil {
 			log.Println("Error unmarshal search result json into", t, err, posts[i])
@@ -2656,6 +2964,9 @@ func uploadSearchHandler(res http.ResponseWriter, req *http.Request) {
 		}
 
 		post := adminPostListItem(p, t, status)
+		if indexed {
+			post = append(post, adminSearchFragments(matches[i].Fragments)...)
+		}
 		_, err = b.Write([]byte(post))
 		if err != nil {
 			log.Println(err)
@@ -2671,7 +2982,13 @@ func uploadSearchHandler(res http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	_, err := b.WriteString(`</ul></div></div>`)
+	_, err := b.WriteString(`</ul>`)
+	if err == nil && indexed {
+		_, err = b.WriteString(adminPagination(req, total, count, offset))
+	}
+	if err == nil {
+		_, err = b.WriteString(`</div></div>`)
+	}
 	if err != nil {
 		log.Println(err)
 
@@ -2699,6 +3016,326 @@ func uploadSearchHandler(res http.ResponseWriter, req *http.Request) {
 	res.Write(adminView)
 }
 
+// filterUploads returns the uploads whose content type starts with the kind,
+// if set, and which have the tag, if set, ordered and paginated by the opts
+func filterUploads(kind, tag string, opts db.QueryOptions) (int, [][]byte) {
+	var matches [][]byte
+	for _, data := range db.UploadAll() {
+		file := item.FileUpload{}
+		err := json.Unmarshal(data, &file)
+		if err != nil {
+			log.Println("Error unmarshal json into __uploads", err, string(data))
+			continue
+		}
+
+		if kind != "" && !strings.HasPrefix(strings.ToLower(file.ContentType), kind+"/") {
+			continue
+		}
+
+		if tag != "" {
+			tagged := false
+			for _, t := range file.Tags {
+				if strings.EqualFold(t, tag) {
+					tagged = true
+					break
+				}
+			}
+
+			if !tagged {
+				continue
+			}
+		}
+
+		matches = append(matches, data)
+	}
+
+	// uploads are stored in order of their sequential IDs, oldest first
+	if opts.Order != "asc" {
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	}
+
+	total := len(matches)
+	if opts.Count < 0 {
+		return total, matches
+	}
+
+	start := opts.Count * opts.Offset
+	if start > total {
+		start = total
+	}
+
+	end := start + opts.Count
+	if end > total {
+		end = total
+	}
+
+	return total, matches[start:end]
+}
+
+// adminUploadUsedBy creates the card listing the content items which reference
+// an upload, shown below the upload editor, and warns before the upload is
+// deleted while it is in use
+func adminUploadUsedBy(refs []string) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<div class="card used-by"><div class="card-content"><div class="card-title">Used By</div>`)
+
+	if len(refs) == 0 {
+		buf.WriteString(`<p>This file is not used by any content.</p></div></div>`)
+		return buf.Bytes()
+	}
+
+	writeUploadRefs(buf, refs)
+	buf.WriteString(`</div></div>`)
+
+	buf.WriteString(fmt.Sprintf(`
+	<script>
+		$(function() {
+			var del = $('form button.delete-post'),
+				form = del.closest('form');
+			del.off('click');
+			del.on('click', function(e) {
+				e.preventDefault();
+				if (confirm("[Ponzu] Please confirm:\n\nThis file is used by %d content item(s), listed below the editor.\nThey will be left without it. Are you sure you want to delete it?\nThis cannot be undone.")) {
+					form.attr('action', form.attr('action') + '/delete');
+					form.append('<input type="hidden" name="confirm" value="true"/>');
+					form.submit();
+				}
+			});
+		});
+	</script>
+	`, len(refs)))
+
+	return buf.Bytes()
+}
+
+// adminUploadDeleteConfirm creates the view asking to confirm the deletion of
+// the upload with the id, which is used by the content items refs
+func adminUploadDeleteConfirm(id string, file *item.FileUpload, refs []string) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<div class="col s9 card"><div class="card-content">`)
+	buf.WriteString(`<div class="card-title">Delete ` + html.EscapeString(file.Name) + `?</div>`)
+	buf.WriteString(fmt.Sprintf(`<p>This file is used by %d content item(s), which will be left without it:</p>`, len(refs)))
+	writeUploadRefs(buf, refs)
+
+	buf.WriteString(`
+		<form enctype="multipart/form-data" action="/admin/edit/upload/delete" method="post">
+			<input type="hidden" name="id" value="` + html.EscapeString(id) + `"/>
+			<input type="hidden" name="confirm" value="true"/>
+			<a class="btn-flat waves-effect waves-light" href="/admin/edit/upload?id=` + url.QueryEscape(id) + `">Cancel</a>
+			<button class="right waves-effect waves-light btn red" type="submit">Delete Anyway</button>
+		</form>
+	</div></div>`)
+
+	return buf.Bytes()
+}
+
+// writeUploadRefs writes the list of links to the content items refs which use
+// an upload to buf
+func writeUploadRefs(buf *bytes.Buffer, refs []string) {
+	buf.WriteString(`<ul>`)
+	for _, target := range refs {
+		parts := strings.SplitN(target, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		t, status := parts[0], ""
+		if strings.HasSuffix(t, "__pending") {
+			t, status = strings.TrimSuffix(t, "__pending"), "&status=pending"
+		}
+
+		u := "/admin/edit?type=" + url.QueryEscape(t) + "&id=" + url.QueryEscape(parts[1]) + status
+		buf.WriteString(`<li><a href="` + html.EscapeString(u) + `">` + html.EscapeString(t+" "+parts[1]) + `</a>`)
+		if status != "" {
+			buf.WriteString(` <span class="grey-text">(pending)</span>`)
+		}
+		buf.WriteString(`</li>`)
+	}
+	buf.WriteString(`</ul>`)
+}
+
+// searchPage reads the count and offset used to paginate admin search results
+// from the request, and will respond with an error view if either is invalid
+func searchPage(res http.ResponseWriter, req *http.Request) (int, int, bool) {
+	q := req.URL.Query()
+
+	count, err := strconv.Atoi(q.Get("count")) // int: determines number of results to return (10 default)
+	if err != nil || count < 1 {
+		if q.Get("count") == "" {
+			count = 10
+		} else {
+			res.WriteHeader(http.StatusBadRequest)
+			errView, err := Error400()
+			if err != nil {
+				return 0, 0, false
+			}
+
+			res.Write(errView)
+			return 0, 0, false
+		}
+	}
+
+	offset, err := strconv.Atoi(q.Get("offset")) // int: multiplier of count for pagination (0 default)
+	if err != nil || offset < 0 {
+		if q.Get("offset") == "" {
+			offset = 0
+		} else {
+			res.WriteHeader(http.StatusBadRequest)
+			errView, err := Error400()
+			if err != nil {
+				return 0, 0, false
+			}
+
+			res.Write(errView)
+			return 0, 0, false
+		}
+	}
+
+	return count, offset, true
+}
+
+// searchIndex queries the search index for the namespace and returns the data
+// for each match, along with the matches themselves and the total number of
+// results. If the namespace has no index or the query fails, indexed is false
+// and the caller should fall back to searchScan
+func searchIndex(namespace, query string, count, offset int) (posts [][]byte, matches []search.Match, total int, indexed bool) {
+	results, total, err := search.TypeQueryHighlight(namespace, query, count, offset)
+	if err == search.ErrNoIndex {
+		return nil, nil, 0, false
+	}
+	if err != nil {
+		log.Println("[search] Error:", err)
+		return nil, nil, 0, false
+	}
+
+	for i := range results {
+		var data []byte
+		if namespace == "__uploads" {
+			data, err = db.Upload(results[i].Target)
+		} else {
+			data, err = db.Content(results[i].Target)
+		}
+		if err != nil {
+			log.Println("[search] Error:", err)
+			continue
+		}
+
+		// skip matches which have been removed but are still in the index
+		if len(data) == 0 {
+			continue
+		}
+
+		posts = append(posts, data)
+		matches = append(matches, results[i])
+	}
+
+	return posts, matches, total, true
+}
+
+// searchScan returns the items from all which contain the query as a
+// case-insensitive substring, used when a namespace has no search index
+func searchScan(all [][]byte, query string) [][]byte {
+	match := strings.ToLower(query)
+
+	var posts [][]byte
+	for i := range all {
+		if strings.Contains(strings.ToLower(string(all[i])), match) {
+			posts = append(posts, all[i])
+		}
+	}
+
+	return posts
+}
+
+// adminSearchFragments creates the li containing the highlighted fragments of a
+// search match, to be displayed below the matched item in the results list
+func adminSearchFragments(fragments map[string][]string) []byte {
+	if len(fragments) == 0 {
+		return nil
+	}
+
+	fields := make([]string, 0, len(fragments))
+	for field := range fragments {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	// fragments are the stored content, which may contain markup, so only the
+	// highlighting of the matched terms is kept
+	highlight := strings.NewReplacer(
+		html.EscapeString("<mark>"), "<mark>",
+		html.EscapeString("</mark>"), "</mark>",
+	)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<li class="col s12 search-fragments">`)
+	for _, field := range fields {
+		var frags []string
+		for _, frag := range fragments[field] {
+			frags = append(frags, highlight.Replace(html.EscapeString(frag)))
+		}
+
+		buf.WriteString(`<div class="grey-text"><span class="grey-text text-lighten-1">` + html.EscapeString(field) + `:</span> `)
+		buf.WriteString(strings.Join(frags, " &hellip; "))
+		buf.WriteString(`</div>`)
+	}
+	buf.WriteString(`</li>`)
+
+	return buf.Bytes()
+}
+
+// adminPagination creates the pagination controls for a list of total items,
+// linking to the previous and next pages of the current request's URL
+func adminPagination(req *http.Request, total, count, offset int) string {
+	// show indicator that a collection of items will be listed implicitly, but
+	// that none are found
+	if total < 1 {
+		return `
+		<ul class="pagination row">
+			<li class="col s2 waves-effect disabled"><a href="#"><i class="material-icons">chevron_left</i></a></li>
+			<li class="col s8">0 to 0 of 0</li>
+			<li class="col s2 waves-effect disabled"><a href="#"><i class="material-icons">chevron_right</i></a></li>
+		</ul>
+		`
+	}
+
+	statusDisabled := "disabled"
+	prevStatus := ""
+	nextStatus := ""
+	// nothing previous to current list
+	if offset == 0 {
+		prevStatus = statusDisabled
+	}
+	// nothing after current list
+	if (offset+1)*count >= total {
+		nextStatus = statusDisabled
+	}
+
+	// set up pagination values
+	q := req.URL.Query()
+	q.Set("count", fmt.Sprintf("%d", count))
+	q.Set("offset", fmt.Sprintf("%d", offset-1))
+	prevURL := req.URL.Path + "?" + q.Encode()
+	q.Set("offset", fmt.Sprintf("%d", offset+1))
+	nextURL := req.URL.Path + "?" + q.Encode()
+
+	start := 1 + count*offset
+	end := start + count - 1
+	if total < end {
+		end = total
+	}
+
+	return fmt.Sprintf(`
+	<ul class="pagination row">
+		<li class="col s2 waves-effect %s"><a href="%s"><i class="material-icons">chevron_left</i></a></li>
+		<li class="col s8">%d to %d of %d</li>
+		<li class="col s2 waves-effect %s"><a href="%s"><i class="material-icons">chevron_right</i></a></li>
+	</ul>
+	`, prevStatus, html.EscapeString(prevURL), start, end, total, nextStatus, html.EscapeString(nextURL))
+}
+
 func addonsHandler(res http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
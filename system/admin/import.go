@@ -0,0 +1,240 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/ponzu-cms/ponzu/system/admin/upload"
+)
+
+// maxImportFormBytes is the space allowed in the request body for the
+// multipart headers, in addition to the zip archive
+const maxImportFormBytes = 64 * 1024
+
+// importSummary is the last line of the import response
+type importSummary struct {
+	Done     bool `json:"done"`
+	Imported int  `json:"imported"`
+	Failed   int  `json:"failed"`
+}
+
+func importUploadsHandler(res http.ResponseWriter, req *http.Request) {
+	// POST /admin/uploads/import with a zip archive in the "archive" field
+	if req.Method != http.MethodPost {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	req.Body = http.MaxBytesReader(res, req.Body, upload.MaxArchiveBytes()+maxImportFormBytes)
+	err := req.ParseMultipartForm(1024 * 1024 * 4) // maxMemory 4MB
+	if upload.TooLarge(err) {
+		http.Error(res, "Zip archive is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Println("Couldn't parse upload import form:", err)
+		http.Error(res, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	archive, header, err := req.FormFile("archive")
+	if err != nil {
+		http.Error(res, "Missing zip archive", http.StatusBadRequest)
+		return
+	}
+	defer archive.Close()
+
+	// report the result of each file as a line of JSON as soon as it is
+	// imported, so the progress of large archives can be shown
+	res.Header().Set("Content-Type", "application/x-ndjson")
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	flusher, _ := res.(http.Flusher)
+	enc := json.NewEncoder(res)
+
+	var failed int
+	imported, err := upload.ImportZip(archive, header.Size, func(r upload.Result) {
+		if r.Error != "" {
+			failed++
+		}
+
+		err := enc.Encode(r)
+		if err != nil {
+			log.Println("Error writing upload import progress:", err)
+			return
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		log.Println("Couldn't read zip archive for upload import:", err)
+		http.Error(res, "Invalid zip archive", http.StatusBadRequest)
+		return
+	}
+
+	err = enc.Encode(importSummary{Done: true, Imported: imported, Failed: failed})
+	if err != nil {
+		log.Println("Error writing upload import summary:", err)
+	}
+}
+
+// uploadDropZone is shown beside the list of uploads, to upload many files at
+// once by dropping them or choosing them. Each file is uploaded in turn with the
+// progress shown, and zip archives are imported unless unchecked.
+const uploadDropZone = `
+<div class="card __ponzu-upload-drop">
+	<div class="card-content">
+		<span class="card-title">Add Files</span>
+		<div class="drop-zone center-align" style="border: 2px dashed #bdbdbd; padding: 30px 10px; cursor: pointer;">
+			<i class="material-icons medium grey-text">cloud_upload</i>
+			<p>Drop files or .zip archives here, or click to choose them</p>
+			<input type="file" multiple style="display: none;"/>
+		</div>
+		<p>
+			<input type="checkbox" class="filled-in" id="__ponzu-extract-zip" checked/>
+			<label for="__ponzu-extract-zip">Import the files within .zip archives</label>
+		</p>
+		<ul class="collection progress-list" style="display: none; max-height: 400px; overflow-y: auto;"></ul>
+		<a class="btn-flat waves-effect refresh" href="/admin/uploads" style="display: none;">Refresh List</a>
+	</div>
+</div>
+<script>
+	$(function() {
+		var card = $('.__ponzu-upload-drop');
+		var zone = card.find('.drop-zone');
+		var input = zone.find('input[type=file]');
+		var list = card.find('.progress-list');
+		var queue = [];
+		var busy = false;
+
+		zone.on('click', function(e) {
+			if (e.target !== input[0]) {
+				input.click();
+			}
+		});
+
+		input.on('change', function() {
+			add(this.files);
+			this.value = '';
+		});
+
+		zone.on('dragenter dragover', function(e) {
+			e.preventDefault();
+			zone.css('border-color', '#26a69a');
+		});
+
+		zone.on('dragleave dragend drop', function(e) {
+			e.preventDefault();
+			zone.css('border-color', '#bdbdbd');
+		});
+
+		zone.on('drop', function(e) {
+			add(e.originalEvent.dataTransfer.files);
+		});
+
+		function add(files) {
+			for (var i = 0; i < files.length; i++) {
+				var row = $('<li class="collection-item">' +
+					'<div class="name truncate"></div>' +
+					'<div class="progress"><div class="determinate" style="width: 0%"></div></div>' +
+					'<div class="status grey-text"></div>' +
+					'<ul class="errors red-text"></ul>' +
+				'</li>');
+				row.find('.name').text(files[i].name);
+				list.show().append(row);
+				queue.push({file: files[i], row: row});
+			}
+
+			next();
+		}
+
+		function next() {
+			if (busy) {
+				return;
+			}
+
+			var job = queue.shift();
+			if (!job) {
+				card.find('.refresh').show();
+				return;
+			}
+
+			busy = true;
+			var zip = /\.zip$/i.test(job.file.name) && $('#__ponzu-extract-zip').is(':checked');
+			var status = job.row.find('.status');
+			var read = 0;
+			var imported = 0;
+
+			var data = new FormData();
+			data.append(zip ? 'archive' : 'file', job.file);
+
+			var xhr = new XMLHttpRequest();
+			xhr.open(zip ? 'POST' : 'PUT', zip ? '/admin/uploads/import' : '/admin/edit/upload');
+
+			xhr.upload.onprogress = function(e) {
+				if (e.lengthComputable) {
+					job.row.find('.determinate').css('width', (e.loaded / e.total * 100) + '%');
+				}
+			};
+
+			xhr.upload.onload = function() {
+				status.text(zip ? 'Importing...' : 'Storing...');
+			};
+
+			// each line of an import response is the result of one file
+			var progress = function() {
+				var lines = xhr.responseText.substring(read).split('\n');
+				read = xhr.responseText.length - lines.pop().length;
+
+				for (var i = 0; i < lines.length; i++) {
+					var r;
+					try {
+						r = JSON.parse(lines[i]);
+					} catch (e) {
+						continue;
+					}
+
+					if (r.done) {
+						status.text('Imported ' + r.imported + ' files' + (r.failed ? ', ' + r.failed + ' failed' : ''));
+					} else if (r.error) {
+						job.row.find('.errors').append($('<li></li>').text(r.name + ': ' + r.error));
+					} else {
+						imported++;
+						status.text('Importing... ' + imported + ' files imported');
+					}
+				}
+			};
+
+			xhr.onprogress = function() {
+				if (zip && xhr.status === 200) {
+					progress();
+				}
+			};
+
+			xhr.onload = function() {
+				if (xhr.status !== 200) {
+					status.removeClass('grey-text').addClass('red-text').text(xhr.responseText || xhr.statusText);
+				} else if (zip) {
+					progress();
+				} else {
+					var url = JSON.parse(xhr.responseText).data[0].url;
+					status.empty().append($('<a target="_blank"></a>').attr('href', url).text(url));
+				}
+
+				busy = false;
+				next();
+			};
+
+			xhr.onerror = function() {
+				status.removeClass('grey-text').addClass('red-text').text('Upload failed, check your connection');
+				busy = false;
+				next();
+			};
+
+			xhr.send(data);
+		}
+	});
+</script>
+`
@@ -5,12 +5,17 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/ponzu-cms/ponzu/system"
+	"github.com/ponzu-cms/ponzu/system/admin/upload"
 	"github.com/ponzu-cms/ponzu/system/admin/user"
 	"github.com/ponzu-cms/ponzu/system/api"
 	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/imaging"
+	"github.com/ponzu-cms/ponzu/system/storage"
 )
 
 // Run adds Handlers to default http listener for Admin
@@ -25,6 +30,9 @@ func Run() {
 	http.HandleFunc("/admin/recover", forgotPasswordHandler)
 	http.HandleFunc("/admin/recover/key", recoveryKeyHandler)
 
+	http.HandleFunc("/admin/analytics/purge", user.Auth(analyticsPurgeHandler))
+	http.HandleFunc("/admin/analytics/export", user.Auth(analyticsExportHandler))
+
 	http.HandleFunc("/admin/addons", user.Auth(addonsHandler))
 	http.HandleFunc("/admin/addon", user.Auth(addonHandler))
 
@@ -35,6 +43,7 @@ func Run() {
 
 	http.HandleFunc("/admin/uploads", user.Auth(uploadContentsHandler))
 	http.HandleFunc("/admin/uploads/search", user.Auth(uploadSearchHandler))
+	http.HandleFunc("/admin/uploads/import", user.Auth(importUploadsHandler))
 
 	http.HandleFunc("/admin/contents", user.Auth(contentsHandler))
 	http.HandleFunc("/admin/contents/search", user.Auth(searchHandler))
@@ -56,12 +65,32 @@ func Run() {
 
 	// API path needs to be registered within server package so that it is handled
 	// even if the API server is not running. Otherwise, images/files uploaded
-	// through the editor will not load within the admin system.
-	uploadsDir := filepath.Join(pwd, "uploads")
-	http.Handle("/api/uploads/", api.Record(api.CORS(db.CacheControl(http.StripPrefix("/api/uploads/", http.FileServer(restrict(http.Dir(uploadsDir))))))))
+	// through the editor will not load within the admin system, and large files
+	// can't be uploaded with the resumable upload handler.
+	http.Handle("/api/uploads/", api.Record(api.FileCORS(http.StripPrefix("/api/uploads/", http.HandlerFunc(serveUploads)).ServeHTTP)))
+	api.HandleTus()
 
 	// Database & uploads backup via HTTP route registered with Basic Auth middleware.
 	http.HandleFunc("/admin/backup", system.BasicAuth(backupHandler))
+
+	// Analytics reports via HTTP route registered with Basic Auth middleware,
+	// using the same credentials as backups, for use by external dashboards.
+	http.HandleFunc("/admin/analytics", system.BasicAuth(analyticsHandler))
+}
+
+// serveUploads serves files uploaded to the storage backend selected in the
+// config. Images requested with transform parameters are resized and converted
+// by the imaging package.
+func serveUploads(res http.ResponseWriter, req *http.Request) {
+	s := storage.Current()
+	key := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+
+	if imaging.Requested(req.URL.Query()) {
+		imaging.Serve(res, req, s, key)
+		return
+	}
+
+	upload.ServeFile(res, req, s, key)
 }
 
 // Docs adds the documentation file server to the server, accessible at
@@ -0,0 +1,78 @@
+package upload
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+	"github.com/ponzu-cms/ponzu/system/storage"
+)
+
+// Delete removes the upload's record from the db and its file from storage.
+// Uploads are deduplicated by content, so no other upload shares the file.
+func Delete(file *item.FileUpload) error {
+	err := db.DeleteUpload(fmt.Sprintf("__uploads:%d", file.ID))
+	if err != nil {
+		return err
+	}
+
+	if key := storage.Key(file.Path); key != "" {
+		err = storage.Current().Delete(key)
+		if err != nil && err != storage.ErrNotExist {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CollectGarbage finds the uploads which are not referenced by any content and
+// were uploaded longer ago than minAge, and deletes them unless dryRun is set.
+// The index of references is rebuilt first, so that it is complete. It returns
+// the unreferenced uploads.
+func CollectGarbage(minAge time.Duration, dryRun bool) ([]item.FileUpload, error) {
+	err := db.RebuildUploadRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-minAge).UnixNano() / int64(time.Millisecond)
+
+	var unused []item.FileUpload
+	for _, j := range db.UploadAll() {
+		var file item.FileUpload
+		err := json.Unmarshal(j, &file)
+		if err != nil {
+			log.Println("Error decoding upload during garbage collection:", err)
+			continue
+		}
+
+		// recent uploads may belong to content which has not been saved yet
+		if file.Timestamp > cutoff {
+			continue
+		}
+
+		refs, err := db.UploadReferences(file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(refs) > 0 {
+			continue
+		}
+
+		if !dryRun {
+			err := Delete(&file)
+			if err != nil {
+				return unused, err
+			}
+		}
+
+		unused = append(unused, file)
+	}
+
+	return unused, nil
+}
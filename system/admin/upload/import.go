@@ -0,0 +1,159 @@
+package upload
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/item"
+)
+
+// Result reports the outcome of importing one file. Path is the URL path of the
+// stored file, or Error is why it was not stored.
+type Result struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ImportZip stores each file within the zip archive read from r as an upload,
+// calling report with the result of each. Directories, hidden files and the
+// resource forks added by macOS are skipped. It returns the number of files
+// stored, or an error if the archive cannot be read.
+func ImportZip(r io.ReaderAt, size int64, report func(Result)) (int, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return 0, err
+	}
+
+	var stored int
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || skip(f.Name) {
+			continue
+		}
+
+		res := Result{Name: f.Name}
+		rc, err := f.Open()
+		if err == nil {
+			res.Path, err = importFile(f.Name, int64(f.UncompressedSize64), rc)
+			rc.Close()
+		}
+
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			stored++
+		}
+
+		report(res)
+	}
+
+	return stored, nil
+}
+
+// ImportDir stores each file within dir and its subdirectories as an upload,
+// calling report with the result of each, like ImportZip
+func ImportDir(dir string, report func(Result)) (int, error) {
+	var stored int
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if rel != "." && skip(rel) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.Mode().IsRegular() || skip(rel) {
+			return nil
+		}
+
+		res := Result{Name: rel}
+		f, err := os.Open(p)
+		if err == nil {
+			res.Path, err = importFile(rel, info.Size(), f)
+			f.Close()
+		}
+
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			stored++
+		}
+
+		report(res)
+
+		return nil
+	})
+
+	return stored, err
+}
+
+// skip reports whether the file at the slash separated path name is hidden or
+// within a hidden directory, such as .DS_Store files and __MACOSX directories
+func skip(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// importFile validates and stores the size bytes read from src with the name of
+// the file at the slash separated path name, copying it to a temporary file if
+// src cannot seek
+func importFile(name string, size int64, src io.Reader) (string, error) {
+	filename := path.Base(name)
+
+	// check the size before copying the file, which may be decompressed
+	err := checkSize(item.UploadRule{}, "file", filename, size)
+	if err != nil {
+		return "", err
+	}
+
+	rs, ok := src.(io.ReadSeeker)
+	if !ok {
+		tmp, err := ioutil.TempFile("", "ponzu-import-")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		_, err = io.Copy(tmp, src)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = tmp.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+
+		rs = tmp
+	}
+
+	contentType, err := Validate(item.UploadRule{}, "file", filename, size, rs)
+	if err != nil {
+		return "", err
+	}
+
+	return StoreFile(filename, contentType, size, rs, time.Now())
+}
@@ -0,0 +1,131 @@
+package upload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+	"github.com/ponzu-cms/ponzu/system/storage"
+)
+
+// active types can run scripts when opened in a browser from the site's origin,
+// so they are always served as attachments
+var active = map[string]bool{
+	"text/html":              true,
+	"application/xhtml+xml":  true,
+	"image/svg+xml":          true,
+	"text/xml":               true,
+	"application/xml":        true,
+	"text/javascript":        true,
+	"application/javascript": true,
+}
+
+// ServeFile writes the file stored at the key, using the upload's record for its
+// Content-Type, a strong ETag from its content hash, and its name. Range and
+// conditional requests are supported for files from seekable backends. The
+// "download" query parameter serves the file as an attachment, named by the
+// parameter's value if set.
+func ServeFile(res http.ResponseWriter, req *http.Request, s storage.Storage, key string) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	rc, info, err := s.Get(key)
+	if err == storage.ErrNotExist {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error getting uploaded file from storage:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	var file item.FileUpload
+	j, err := db.UploadByPath(storage.URLPrefix + key)
+	if err != nil {
+		log.Println("Error finding upload by path:", key, err)
+	}
+	if j != nil {
+		err = json.Unmarshal(j, &file)
+		if err != nil {
+			log.Println("Error unmarshal json into __uploads", err, string(j))
+		}
+	}
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	name := file.Name
+	if name == "" {
+		name = path.Base(key)
+	}
+
+	disposition := "inline"
+	q := req.URL.Query()
+	if _, ok := q["download"]; ok || active[mediaType(contentType)] {
+		disposition = "attachment"
+		if d := path.Base(q.Get("download")); d != "" && d != "." && d != "/" {
+			name = d
+		}
+	}
+
+	h := res.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", db.CachePolicy())
+
+	// identical content has the same hash, so it is a strong validator. Files
+	// uploaded before hashes were recorded fall back to a weak validator.
+	if file.Hash != "" {
+		h.Set("ETag", `"`+file.Hash+`"`)
+	} else if !info.ModTime.IsZero() {
+		h.Set("ETag", fmt.Sprintf(`W/"%x-%x"`, info.Size, info.ModTime.UnixNano()))
+	}
+
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(res, req, "", info.ModTime, rs)
+		return
+	}
+
+	// without seeking, only whole files can be served
+	if etag := h.Get("ETag"); etag != "" && strings.Contains(req.Header.Get("If-None-Match"), etag) {
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Accept-Ranges", "none")
+	if info.Size > 0 {
+		h.Set("Content-Length", fmt.Sprintf("%d", info.Size))
+	}
+	if !info.ModTime.IsZero() {
+		h.Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	_, err = io.Copy(res, rc)
+	if err != nil {
+		log.Println("Error writing uploaded file from storage:", err)
+	}
+}
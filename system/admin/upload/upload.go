@@ -3,24 +3,50 @@
 package upload
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/imaging"
 	"github.com/ponzu-cms/ponzu/system/item"
+	"github.com/ponzu-cms/ponzu/system/storage"
 )
 
 // StoreFiles stores file uploads at paths like /YYYY/MM/filename.ext
 func StoreFiles(req *http.Request) (map[string]string, error) {
+	return StoreFilesFor(req, nil)
+}
+
+// StoreFilesFor stores file uploads at paths like /YYYY/MM/filename.ext, after
+// validating each against the UploadRule for its field of the content type post.
+// If any file is rejected, none are stored and an *Error is returned.
+func StoreFilesFor(req *http.Request, post interface{}) (map[string]string, error) {
+	var max int64
+	if req.MultipartForm == nil {
+		max = LimitBody(nil, req, post)
+	}
+
 	err := req.ParseMultipartForm(1024 * 1024 * 4) // maxMemory 4MB
+	if TooLarge(err) {
+		return nil, &Error{
+			Status:   http.StatusRequestEntityTooLarge,
+			Filename: "request",
+			Message:  fmt.Sprintf("files are larger than %s", item.FmtBytes(float64(max))),
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -36,13 +62,6 @@ func StoreFiles(req *http.Request) (map[string]string, error) {
 	// To use for FormValue name:urlPath
 	urlPaths := make(map[string]string)
 
-	// get or create upload directory to save files from request
-	pwd, err := os.Getwd()
-	if err != nil {
-		err := fmt.Errorf("Failed to locate current directory: %s", err)
-		return nil, err
-	}
-
 	i, err := strconv.ParseInt(ts, 10, 64)
 	if err != nil {
 		return nil, err
@@ -50,73 +69,287 @@ func StoreFiles(req *http.Request) (map[string]string, error) {
 
 	tm := time.Unix(int64(i/1000), int64(i%1000))
 
-	urlPathPrefix := "api"
-	uploadDirName := "uploads"
-
-	uploadDir := filepath.Join(pwd, uploadDirName, fmt.Sprintf("%d", tm.Year()), fmt.Sprintf("%02d", tm.Month()))
-	err = os.MkdirAll(uploadDir, os.ModeDir|os.ModePerm)
-	if err != nil {
-		return nil, err
+	// open and validate all files before storing any of them
+	type file struct {
+		header      *multipart.FileHeader
+		src         multipart.File
+		contentType string
 	}
 
-	// loop over all files and save them to disk
-	for name, fds := range req.MultipartForm.File {
-		filename, err := item.NormalizeString(fds[0].Filename)
-		if err != nil {
-			return nil, err
+	files := make(map[string]file)
+	defer func() {
+		for _, f := range files {
+			f.src.Close()
 		}
+	}()
 
+	for name, fds := range req.MultipartForm.File {
 		src, err := fds[0].Open()
 		if err != nil {
 			err := fmt.Errorf("Couldn't open uploaded file: %s", err)
 			return nil, err
 
 		}
-		defer src.Close()
 
-		// check if file at path exists, if so, add timestamp to file
-		absPath := filepath.Join(uploadDir, filename)
-
-		if _, err := os.Stat(absPath); !os.IsNotExist(err) {
-			filename = fmt.Sprintf("%d-%s", time.Now().Unix(), filename)
-			absPath = filepath.Join(uploadDir, filename)
-		}
+		files[name] = file{header: fds[0], src: src}
 
-		// save to disk (TODO: or check if S3 credentials exist, & save to cloud)
-		dst, err := os.Create(absPath)
+		contentType, err := Validate(Rule(post, name), name, fds[0].Filename, fds[0].Size, src)
 		if err != nil {
-			err := fmt.Errorf("Failed to create destination file for upload: %s", err)
 			return nil, err
 		}
 
-		// copy file from src to dst on disk
-		var size int64
-		if size, err = io.Copy(dst, src); err != nil {
-			err := fmt.Errorf("Failed to copy uploaded file to destination: %s", err)
+		files[name] = file{header: fds[0], src: src, contentType: contentType}
+	}
+
+	// loop over all files and store them
+	for name, f := range files {
+		urlPath, err := StoreFile(f.header.Filename, f.contentType, f.header.Size, f.src, tm)
+		if err != nil {
 			return nil, err
 		}
 
 		// add name:urlPath to req.PostForm to be inserted into db
-		urlPath := fmt.Sprintf("/%s/%s/%d/%02d/%s", urlPathPrefix, uploadDirName, tm.Year(), tm.Month(), filename)
 		urlPaths[name] = urlPath
-
-		// add upload information to db
-		go storeFileInfo(size, filename, urlPath, fds)
 	}
 
 	return urlPaths, nil
 }
 
-func storeFileInfo(size int64, filename, urlPath string, fds []*multipart.FileHeader) {
+// StoreFile saves the size bytes read from src to the storage backend selected
+// in the config, at a key like YYYY/MM/filename.ext using the time provided, and
+// adds the upload information to the db. It returns the URL path of the file.
+// Files are identified by the SHA-256 hash of their content, so if an identical
+// file has already been uploaded, its URL path is returned instead.
+func StoreFile(filename, contentType string, size int64, src io.Reader, tm time.Time) (string, error) {
+	filename, err := item.NormalizeString(filename)
+	if err != nil {
+		return "", err
+	}
+
+	s := storage.Current()
+
+	// read the metadata of photos, and remove their location and other private
+	// metadata unless the config keeps it, before they are hashed and stored
+	src, size, meta, done, err := prepareImage(filename, contentType, size, src)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+
+	// hash sources which can be read twice before storing them, so that
+	// duplicates are never stored
+	var hash string
+	rs, seekable := src.(io.ReadSeeker)
+	if seekable {
+		h := sha256.New()
+		_, err = io.Copy(h, rs)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = rs.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+
+		hash = hex.EncodeToString(h.Sum(nil))
+		if urlPath, ok := existing(s, hash); ok {
+			return urlPath, nil
+		}
+	}
+
+	dir := fmt.Sprintf("%d/%02d", tm.Year(), tm.Month())
+
+	// check if file at key exists, if so, add timestamp to file
+	key := path.Join(dir, filename)
+	if storage.Exists(s, key) {
+		filename = fmt.Sprintf("%d-%s", time.Now().Unix(), filename)
+		key = path.Join(dir, filename)
+	}
+
 	data := url.Values{
 		"name":           []string{filename},
-		"path":           []string{urlPath},
-		"content_type":   []string{fds[0].Header.Get("Content-Type")},
+		"content_type":   []string{contentType},
 		"content_length": []string{fmt.Sprintf("%d", size)},
 	}
 
+	if meta.Orientation > 0 {
+		data.Set("orientation", fmt.Sprintf("%d", meta.Orientation))
+	}
+	if camera := meta.Camera(); camera != "" {
+		data.Set("camera", camera)
+	}
+	if meta.Captured != "" {
+		data.Set("captured", meta.Captured)
+	}
+
+	// record the dimensions of images, reading only their header
+	if seekable && strings.HasPrefix(contentType, "image/") {
+		width, height, err := imaging.Dimensions(rs)
+		if err != nil {
+			log.Println("Couldn't read dimensions of uploaded image:", filename, err)
+		} else {
+			data.Set("width", fmt.Sprintf("%d", width))
+			data.Set("height", fmt.Sprintf("%d", height))
+		}
+
+		_, err = rs.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	h := sha256.New()
+	err = s.Put(key, io.TeeReader(src, h), size, contentType)
+	if err != nil {
+		err := fmt.Errorf("Failed to store uploaded file: %s", err)
+		return "", err
+	}
+
+	if !seekable {
+		hash = hex.EncodeToString(h.Sum(nil))
+		if urlPath, ok := existing(s, hash); ok {
+			err := s.Delete(key)
+			if err != nil {
+				log.Println("Couldn't remove duplicate of uploaded file:", key, err)
+			}
+
+			return urlPath, nil
+		}
+	}
+
+	urlPath := s.URL(key)
+	data.Set("path", urlPath)
+	data.Set("hash", hash)
+
+	// add upload information to db
+	storeFileInfo(data)
+
+	return urlPath, nil
+}
+
+// existing returns the URL path of the uploaded file with the content hash, if
+// it is still in storage
+func existing(s storage.Storage, hash string) (string, bool) {
+	j, err := db.UploadByHash(hash)
+	if err != nil {
+		log.Println("Error finding upload by hash:", err)
+		return "", false
+	}
+	if j == nil {
+		return "", false
+	}
+
+	var file item.FileUpload
+	err = json.Unmarshal(j, &file)
+	if err != nil || !storage.Exists(s, storage.Key(file.Path)) {
+		return "", false
+	}
+
+	return file.Path, true
+}
+
+func storeFileInfo(data url.Values) {
 	_, err := db.SetUpload("__uploads:-1", data)
 	if err != nil {
 		log.Println("Error saving file upload record to database:", err)
 	}
 }
+
+// prepareImage reads the EXIF metadata of JPEG and PNG images and, unless the
+// "upload_keep_metadata" config is set, copies them to a temporary file without
+// their private metadata. It returns the source and size of the file to store,
+// and a func to remove any temporary files once it is stored. Other files are
+// returned unchanged.
+func prepareImage(filename, contentType string, size int64, src io.Reader) (io.Reader, int64, imaging.Metadata, func(), error) {
+	var meta imaging.Metadata
+	var temps []*os.File
+	done := func() {
+		for _, f := range temps {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+
+	mt := mediaType(contentType)
+	if mt != "image/jpeg" && mt != "image/png" {
+		return src, size, meta, done, nil
+	}
+
+	temp := func() (*os.File, error) {
+		f, err := ioutil.TempFile("", "ponzu-upload-")
+		if err != nil {
+			return nil, err
+		}
+
+		temps = append(temps, f)
+		return f, nil
+	}
+
+	rs, ok := src.(io.ReadSeeker)
+	if !ok {
+		f, err := temp()
+		if err != nil {
+			return nil, 0, meta, done, err
+		}
+
+		_, err = io.Copy(f, src)
+		if err != nil {
+			done()
+			return nil, 0, meta, done, err
+		}
+
+		rs = f
+	}
+
+	_, err := rs.Seek(0, io.SeekStart)
+	if err != nil {
+		done()
+		return nil, 0, meta, done, err
+	}
+
+	meta, err = imaging.ReadMetadata(rs)
+	if err != nil {
+		log.Println("Couldn't read metadata of uploaded image:", filename, err)
+	}
+
+	_, err = rs.Seek(0, io.SeekStart)
+	if err != nil {
+		done()
+		return nil, 0, meta, done, err
+	}
+
+	if keep, _ := db.ConfigCache("upload_keep_metadata").(bool); keep {
+		return rs, size, meta, done, nil
+	}
+
+	f, err := temp()
+	if err != nil {
+		done()
+		return nil, 0, meta, done, err
+	}
+
+	err = imaging.Strip(f, rs)
+	if err != nil {
+		done()
+		return nil, 0, meta, done, &Error{
+			Status:   http.StatusUnprocessableEntity,
+			Filename: filename,
+			Message:  fmt.Sprintf("private metadata could not be removed: %s", err),
+		}
+	}
+
+	size, err = f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		done()
+		return nil, 0, meta, done, err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		done()
+		return nil, 0, meta, done, err
+	}
+
+	return f, size, meta, done, nil
+}
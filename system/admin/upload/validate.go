@@ -0,0 +1,308 @@
+package upload
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+)
+
+// Error describes an uploaded file which was rejected, and the HTTP status to
+// send in response
+type Error struct {
+	Status   int
+	Field    string
+	Filename string
+	Message  string
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return fmt.Sprintf("Upload of %s rejected: %s", e.Filename, e.Message)
+}
+
+// Scanner checks the content of an uploaded file before it is stored, such as
+// with a virus scanner. Returning an error rejects the file.
+type Scanner func(filename, contentType string, r io.Reader) error
+
+var (
+	scannersMu = &sync.RWMutex{}
+	scanners   []Scanner
+)
+
+// RegisterScanner adds a Scanner which is run on every uploaded file, in the
+// order they were registered
+func RegisterScanner(s Scanner) {
+	scannersMu.Lock()
+	scanners = append(scanners, s)
+	scannersMu.Unlock()
+}
+
+// Rule returns the UploadRule for the field of the content type, if it
+// implements item.Uploadable
+func Rule(post interface{}, field string) item.UploadRule {
+	u, ok := post.(item.Uploadable)
+	if !ok {
+		return item.UploadRule{}
+	}
+
+	rules := u.UploadRules()
+	if rule, ok := rules[field]; ok {
+		return rule
+	}
+
+	return rules["*"]
+}
+
+// MaxBytes returns the largest file size allowed by the rule, or the
+// "upload_max_size" config if the rule does not set one. Zero means unlimited.
+func MaxBytes(rule item.UploadRule) int64 {
+	if rule.MaxBytes > 0 {
+		return rule.MaxBytes
+	}
+
+	if mb, ok := db.ConfigCache("upload_max_size").(float64); ok && mb > 0 {
+		return int64(mb * 1024 * 1024)
+	}
+
+	return 0
+}
+
+// defaultMaxArchiveBytes is the largest zip archive which can be imported when
+// the "upload_import_max_size" config is not set
+const defaultMaxArchiveBytes = 1024 * 1024 * 1024
+
+// MaxArchiveBytes returns the largest zip archive which can be imported, from
+// the "upload_import_max_size" config in MB or 1GB if it is not set.
+func MaxArchiveBytes() int64 {
+	if mb, ok := db.ConfigCache("upload_import_max_size").(float64); ok && mb > 0 {
+		return int64(mb * 1024 * 1024)
+	}
+
+	return defaultMaxArchiveBytes
+}
+
+// maxFormBytes is the space allowed in a limited request body for the fields of
+// the form and the headers of its parts, in addition to the files
+const maxFormBytes = 10 * 1024 * 1024
+
+// LimitBody limits the request body to the size of the largest file allowed for
+// the content type post, or for any content type if post is nil, plus space for
+// the rest of the form, so larger uploads are rejected while they are read
+// rather than after. The body isn't limited if files may be of any size. It
+// returns the largest file size allowed, or zero if there is no limit.
+func LimitBody(res http.ResponseWriter, req *http.Request, post interface{}) int64 {
+	var posts []interface{}
+	if post != nil {
+		posts = append(posts, post)
+	} else {
+		for _, it := range item.Types {
+			posts = append(posts, it())
+		}
+	}
+
+	// files in fields without a rule are limited by the config alone
+	max := MaxBytes(item.UploadRule{})
+	if max == 0 {
+		return 0
+	}
+
+	for _, p := range posts {
+		u, ok := p.(item.Uploadable)
+		if !ok {
+			continue
+		}
+
+		for _, rule := range u.UploadRules() {
+			n := MaxBytes(rule)
+			if n == 0 {
+				return 0
+			}
+
+			if n > max {
+				max = n
+			}
+		}
+	}
+
+	req.Body = http.MaxBytesReader(res, req.Body, max+maxFormBytes)
+
+	return max
+}
+
+// TooLarge reports whether err was caused by reading more of a request body than
+// its limit allows. The error returned by http.MaxBytesReader has no type of its
+// own before Go 1.19, and may be wrapped by the multipart reader, so it is found
+// by its message.
+func TooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "http: request body too large")
+}
+
+// Validate checks the file against the rule, detecting its content type from
+// its first bytes, and runs the registered scanners. It returns the detected
+// content type, or an *Error if the file is rejected. The src is left at its
+// start.
+func Validate(rule item.UploadRule, field, filename string, size int64, src io.ReadSeeker) (string, error) {
+	reject := func(status int, format string, args ...interface{}) (string, error) {
+		return "", &Error{
+			Status:   status,
+			Field:    field,
+			Filename: filename,
+			Message:  fmt.Sprintf(format, args...),
+		}
+	}
+
+	err := checkSize(rule, field, filename, size)
+	if err != nil {
+		return "", err
+	}
+
+	ext := strings.ToLower(path.Ext(filename))
+	if len(rule.Extensions) > 0 && !allowedExtension(rule.Extensions, ext) {
+		return reject(http.StatusUnsupportedMediaType, "files with extension %q are not allowed", ext)
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	contentType, ok := sniff(ext, head[:n])
+	if !ok {
+		return reject(http.StatusUnsupportedMediaType, "content of type %s does not match extension %q", contentType, ext)
+	}
+
+	if len(rule.Types) > 0 && !allowedType(rule.Types, contentType) {
+		return reject(http.StatusUnsupportedMediaType, "files of type %s are not allowed", mediaType(contentType))
+	}
+
+	scannersMu.RLock()
+	scan := scanners
+	scannersMu.RUnlock()
+
+	for _, s := range scan {
+		_, err = src.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+
+		err = s(filename, contentType, src)
+		if err != nil {
+			return reject(http.StatusUnprocessableEntity, "%s", err)
+		}
+	}
+
+	_, err = src.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	return contentType, nil
+}
+
+// checkSize returns an *Error if the file is larger than the rule allows
+func checkSize(rule item.UploadRule, field, filename string, size int64) error {
+	max := MaxBytes(rule)
+	if max > 0 && size > max {
+		return &Error{
+			Status:   http.StatusRequestEntityTooLarge,
+			Field:    field,
+			Filename: filename,
+			Message:  fmt.Sprintf("file is larger than %s", item.FmtBytes(float64(max))),
+		}
+	}
+
+	return nil
+}
+
+// generic types are detected for content which could be any of several more
+// specific types, such as Office documents (zip) or SVG images (xml)
+var generic = map[string]bool{
+	"application/octet-stream": true,
+	"application/zip":          true,
+	"application/x-gzip":       true,
+	"text/plain":               true,
+	"text/xml":                 true,
+}
+
+// sniff detects the content type from the head of the file. The type of the
+// file's extension is used when it is consistent with the content, since many
+// formats can only be detected generically. It reports false when the content
+// does not match the extension, such as HTML uploaded as an image.
+func sniff(ext string, head []byte) (string, bool) {
+	detected := http.DetectContentType(head)
+	dt := mediaType(detected)
+
+	extType := mime.TypeByExtension(ext)
+	et := mediaType(extType)
+
+	switch {
+	case et == "" || et == dt:
+		return detected, true
+
+	case dt == "text/html":
+		return detected, false
+
+	case strings.HasPrefix(dt, "image/") && strings.HasPrefix(et, "image/"):
+		// images with the wrong extension are served by their content
+		return detected, true
+
+	case detectable[et]:
+		return detected, false
+
+	case generic[dt]:
+		return extType, true
+
+	default:
+		return detected, true
+	}
+}
+
+// detectable types would have been detected by their signature, if the content
+// was valid
+var detectable = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"application/pdf": true,
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(contentType)
+	}
+
+	return mt
+}
+
+func allowedType(types []string, contentType string) bool {
+	mt := mediaType(contentType)
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == mt || strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func allowedExtension(exts []string, ext string) bool {
+	for _, e := range exts {
+		if "."+strings.TrimPrefix(strings.ToLower(e), ".") == ext {
+			return true
+		}
+	}
+
+	return false
+}
@@ -55,12 +55,14 @@ func batchInsert(requests chan apiRequest) error {
 }
 
 // batchPrune takes a duration to evaluate apiRequest dates against. If any of
-// the apiRequest timestamps are before the threshold, they are removed.
+// the apiRequest timestamps are before the threshold, they are removed. Salts
+// for any day before today are also removed, so that client identifiers cannot
+// be recreated once the day has passed.
 // TODO: add feature to alternatively backup old analytics to cloud
 func batchPrune(threshold time.Duration) error {
 	now := time.Now()
 	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
-	max := today.Add(threshold)
+	max := today.Add(-threshold)
 
 	// iterate through all request data
 	err := store.Update(func(tx *bolt.Tx) error {
@@ -88,6 +90,27 @@ func batchPrune(threshold time.Duration) error {
 			return err
 		}
 
+		s := tx.Bucket([]byte("__salts"))
+		day := now.UTC().Format("2006-01-02")
+		var old [][]byte
+		err = s.ForEach(func(k, v []byte) error {
+			if string(k) != day {
+				old = append(old, k)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range old {
+			err := s.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
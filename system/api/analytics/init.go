@@ -15,15 +15,22 @@ import (
 )
 
 type apiRequest struct {
-	URL        string `json:"url"`
-	Method     string `json:"http_method"`
-	Origin     string `json:"origin"`
-	Proto      string `json:"http_protocol"`
-	RemoteAddr string `json:"ip_address"`
-	Timestamp  int64  `json:"timestamp"`
-	External   bool   `json:"external_content"`
+	URL         string  `json:"url"`
+	Method      string  `json:"http_method"`
+	Origin      string  `json:"origin"`
+	Proto       string  `json:"http_protocol"`
+	Client      string  `json:"client_id"`
+	Timestamp   int64   `json:"timestamp"`
+	External    bool    `json:"external_content"`
+	Endpoint    string  `json:"endpoint"`
+	ContentType string  `json:"content_type"`
+	Item        string  `json:"item"`
+	Status      int     `json:"status"`
+	Latency     float64 `json:"latency_ms"`
 }
 
+// apiMetric is the daily total cached by previous versions of Ponzu, which is
+// moved into the daily rollups by migrateMetrics
 type apiMetric struct {
 	Date   string `json:"date"`
 	Total  int    `json:"total"`
@@ -35,30 +42,79 @@ var (
 	requestChan chan apiRequest
 )
 
-// RANGE determines the number of days ponzu request analytics and metrics are
-// stored and displayed within the system
+// RANGE determines the default number of days ponzu request analytics and
+// metrics are stored and displayed within the system, see Retention
 const RANGE = 14
 
-// Record queues an apiRequest for metrics
-func Record(req *http.Request) {
+// Record queues an apiRequest for metrics, including the status code of the
+// response and the latency of the handler which served it. Requests from
+// clients which send a Do Not Track or Global Privacy Control header are not
+// recorded, and client IP addresses are never stored.
+func Record(req *http.Request, status int, latency time.Duration) {
+	if optOut(req) {
+		return
+	}
+
 	external := strings.Contains(req.URL.Path, "/external/")
 
-	ts := int64(time.Nanosecond) * time.Now().UnixNano() / int64(time.Millisecond)
+	now := time.Now()
+	ts := int64(time.Nanosecond) * now.UnixNano() / int64(time.Millisecond)
 
 	r := apiRequest{
-		URL:        req.URL.String(),
-		Method:     req.Method,
-		Origin:     req.Header.Get("Origin"),
-		Proto:      req.Proto,
-		RemoteAddr: req.RemoteAddr,
-		Timestamp:  ts,
-		External:   external,
+		URL:         req.URL.String(),
+		Method:      req.Method,
+		Origin:      req.Header.Get("Origin"),
+		Proto:       req.Proto,
+		Client:      clientID(req.RemoteAddr, now),
+		Timestamp:   ts,
+		External:    external,
+		Endpoint:    endpoint(req),
+		ContentType: req.URL.Query().Get("type"),
+		Item:        target(req),
+		Status:      status,
+		Latency:     float64(latency) / float64(time.Millisecond),
 	}
 
 	// put r on buffered requestChan to take advantage of batch insertion in DB
 	requestChan <- r
 }
 
+// Queue returns the number of requests waiting to be inserted into the db and
+// the capacity of the queue, beyond which recording requests will block
+func Queue() (int, int) {
+	return len(requestChan), cap(requestChan)
+}
+
+// endpoint returns the pattern of the route which handled the request, so that
+// requests for individual files are counted against "/api/uploads/"
+func endpoint(req *http.Request) string {
+	_, pattern := http.DefaultServeMux.Handler(req)
+	if pattern == "" {
+		return req.URL.Path
+	}
+
+	return pattern
+}
+
+// target returns the content item requested, as a Type:ID target when both the
+// type and id are known, or its slug, or the path to an uploaded file
+func target(req *http.Request) string {
+	q := req.URL.Query()
+	if q.Get("type") != "" && q.Get("id") != "" {
+		return q.Get("type") + ":" + q.Get("id")
+	}
+
+	if q.Get("slug") != "" {
+		return q.Get("slug")
+	}
+
+	if strings.HasPrefix(req.URL.Path, "/api/uploads/") {
+		return req.URL.Path
+	}
+
+	return ""
+}
+
 // Close exports the abillity to close our db file. Should be called with defer
 // after call to Init() from the same place.
 func Close() {
@@ -83,7 +139,14 @@ func Init() {
 			return err
 		}
 
-		_, err = tx.CreateBucketIfNotExists([]byte("__metrics"))
+		for _, name := range periodBuckets {
+			_, err = tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte("__salts"))
 		if err != nil {
 			return err
 		}
@@ -94,6 +157,21 @@ func Init() {
 		log.Fatalln("Error idempotently creating requests bucket in analytics.db:", err)
 	}
 
+	err = migrateRequests()
+	if err != nil {
+		log.Fatalln("Error removing IP addresses from requests in analytics.db:", err)
+	}
+
+	err = migrateMetrics()
+	if err != nil {
+		log.Fatalln("Error moving daily metrics to rollups in analytics.db:", err)
+	}
+
+	err = rollup()
+	if err != nil {
+		log.Println("Error rolling up requests in analytics.db:", err)
+	}
+
 	requestChan = make(chan apiRequest, 1024*64*runtime.NumCPU())
 
 	go serve()
@@ -108,11 +186,12 @@ func serve() {
 	// interval: 30 seconds
 	apiRequestTimer := time.NewTicker(time.Second * 30)
 
-	// make timer to notify select to remove analytics older than RANGE days
-	// interval: RANGE/2 days
+	// make timer to notify select to roll up complete days of requests, remove
+	// requests older than the retention period and to rotate the salt used to
+	// hash client identifiers
+	// interval: 1 hour
 	// TODO: enable analytics backup service to cloud
-	pruneThreshold := time.Hour * 24 * RANGE
-	pruneDBTimer := time.NewTicker(pruneThreshold / 2)
+	pruneDBTimer := time.NewTicker(time.Hour)
 
 	for {
 		select {
@@ -123,7 +202,14 @@ func serve() {
 			}
 
 		case <-pruneDBTimer.C:
-			err := batchPrune(pruneThreshold)
+			// requests must be rolled up before they can be pruned
+			err := rollup()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			err = batchPrune(time.Hour * 24 * time.Duration(Retention()))
 			if err != nil {
 				log.Println(err)
 			}
@@ -134,191 +220,43 @@ func serve() {
 	}
 }
 
-// ChartData returns the map containing decoded javascript needed to chart RANGE
-// days of data by day
-func ChartData() (map[string]interface{}, error) {
-	// set thresholds for today and the RANGE-1 days preceding
-	times := [RANGE]time.Time{}
-	dates := [RANGE]string{}
-	now := time.Now()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
-
-	ips := [RANGE]map[string]struct{}{}
-	for i := range ips {
-		ips[i] = make(map[string]struct{})
-	}
-
-	total := [RANGE]int{}
-	unique := [RANGE]int{}
-
-	for i := range times {
-		// subtract 24 * i hours to make days prior
-		dur := time.Duration(24 * i * -1)
-		day := today.Add(time.Hour * dur)
-
-		// day threshold is [...n-1-i, n-1, n]
-		times[len(times)-1-i] = day
-		dates[len(times)-1-i] = day.Format("01/02")
-	}
-
-	// get api request analytics and metrics from db
-	var requests = []apiRequest{}
-	currentMetrics := make(map[string]apiMetric)
+// ChartData returns the map containing decoded javascript needed to chart the
+// number of days of data provided by day, up to the retention period. Previous
+// days are read from their daily rollups, and today is calculated from the
+// requests recorded so far.
+func ChartData(days int) (map[string]interface{}, error) {
+	days = clampDays(days)
 
-	err := store.Update(func(tx *bolt.Tx) error {
-		m := tx.Bucket([]byte("__metrics"))
-		b := tx.Bucket([]byte("__requests"))
+	dates := make([]string, days)
+	total := make([]int, days)
+	unique := make([]int, days)
 
-		err := m.ForEach(func(k, v []byte) error {
-			var metric apiMetric
-			err := json.Unmarshal(v, &metric)
-			if err != nil {
-				log.Println("Error decoding api metric json from analytics db:", err)
-				return nil
-			}
-
-			// add metric to currentMetrics map
-			currentMetrics[metric.Date] = metric
-
-			return nil
-		})
-		if err != nil {
-			return err
-		}
-
-		err = b.ForEach(func(k, v []byte) error {
-			var r apiRequest
-			err := json.Unmarshal(v, &r)
-			if err != nil {
-				log.Println("Error decoding api request json from analytics db:", err)
-				return nil
-			}
-
-			// append request to requests for analysis if its timestamp is today
-			// or if its day is not already in cache, otherwise delete it
-			d := time.Unix(r.Timestamp/1000, 0)
-			_, inCache := currentMetrics[d.Format("01/02")]
-			if !d.Before(today) || !inCache {
-				requests = append(requests, r)
-			} else {
-				err := b.Delete(k)
-				if err != nil {
-					return err
-				}
-			}
-
-			return nil
-		})
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
+	today := dayStart(time.Now())
+	current, err := currentDay()
 	if err != nil {
 		return nil, err
 	}
 
-CHECK_REQUEST:
-	for i := range requests {
-		ts := time.Unix(requests[i].Timestamp/1000, 0)
-
-		for j := range times {
-			// if on today, there will be no next iteration to set values for
-			// day prior so all valid requests belong to today
-			if j == len(times)-1 {
-				if ts.After(times[j]) || ts.Equal(times[j]) {
-					// do all record keeping
-					total[j]++
-
-					if _, ok := ips[j][requests[i].RemoteAddr]; !ok {
-						unique[j]++
-						ips[j][requests[i].RemoteAddr] = struct{}{}
-					}
-
-					continue CHECK_REQUEST
-				}
-			}
-
-			if ts.Equal(times[j]) {
-				// increment total count for current time threshold (day)
-				total[j]++
-
-				// if no IP found for current threshold, increment unique and record IP
-				if _, ok := ips[j][requests[i].RemoteAddr]; !ok {
-					unique[j]++
-					ips[j][requests[i].RemoteAddr] = struct{}{}
-				}
-
-				continue CHECK_REQUEST
-			}
-
-			if ts.Before(times[j]) {
-				// check if older than earliest threshold
-				if j == 0 {
-					continue CHECK_REQUEST
-				}
-
-				// increment total count for previous time threshold (day)
-				total[j-1]++
-
-				// if no IP found for day prior, increment unique and record IP
-				if _, ok := ips[j-1][requests[i].RemoteAddr]; !ok {
-					unique[j-1]++
-					ips[j-1][requests[i].RemoteAddr] = struct{}{}
-				}
-			}
-		}
-	}
-
-	// add data to currentMetrics from total and unique
-	for i := range dates {
-		_, ok := currentMetrics[dates[i]]
-		if !ok {
-			m := apiMetric{
-				Date:   dates[i],
-				Total:  total[i],
-				Unique: unique[i],
-			}
-
-			currentMetrics[dates[i]] = m
-		}
-	}
-
-	// loop through total and unique to see which dates are accounted for and
-	// insert data from metrics array where dates are not
-	err = store.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("__metrics"))
+	err = store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("__daily"))
 
 		for i := range dates {
-			// populate total and unique with cached data if needed
-			if total[i] == 0 {
-				total[i] = currentMetrics[dates[i]].Total
-			}
-
-			if unique[i] == 0 {
-				unique[i] = currentMetrics[dates[i]].Unique
+			// day threshold is [...n-1-i, n-1, n]
+			day := today.AddDate(0, 0, i-(days-1))
+			dates[i] = day.Format("01/02")
+
+			r := current
+			if i != days-1 {
+				var err error
+				r, err = getRollup(b, periodKey(PeriodDay, day))
+				if err != nil {
+					return err
+				}
 			}
 
-			// check if we need to insert old data into cache - as long as it
-			// is not today's data
-			if dates[i] != today.Format("01/02") {
-				k := []byte(dates[i])
-				if b.Get(k) == nil {
-					// keep zero counts out of cache in case data is added from
-					// other sources
-					if currentMetrics[dates[i]].Total != 0 {
-						v, err := json.Marshal(currentMetrics[dates[i]])
-						if err != nil {
-							return err
-						}
-
-						err = b.Put(k, v)
-						if err != nil {
-							return err
-						}
-					}
-				}
+			if r != nil {
+				total[i] = r.Total
+				unique[i] = r.Unique
 			}
 		}
 
@@ -0,0 +1,244 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// IPModeHash records clients by a hash of their IP address using a salt
+	// which is rotated daily, so clients can be counted as unique within
+	// a day but cannot be identified or followed across days. It is the default.
+	IPModeHash = "hash"
+
+	// IPModeTruncate records clients by their truncated IP address, which is
+	// the IPv4 /24 or IPv6 /48 network the address belongs to
+	IPModeTruncate = "truncate"
+)
+
+var (
+	saltMu  = &sync.Mutex{}
+	saltDay string
+	salt    []byte
+)
+
+// Retention returns the number of days that raw API requests are stored, set
+// by the "analytics_retention" config (RANGE days by default)
+func Retention() int {
+	days, ok := db.ConfigCache("analytics_retention").(float64)
+	if !ok || days < 1 {
+		return RANGE
+	}
+
+	return int(days)
+}
+
+// Purge removes all of the raw API request data, including the salts used to
+// hash client identifiers. Any complete days are rolled up first, since rollups
+// contain no client data and are kept.
+func Purge() error {
+	err := rollup()
+	if err != nil {
+		return err
+	}
+
+	err = store.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{"__requests", "__salts"} {
+			err := tx.DeleteBucket([]byte(name))
+			if err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+
+			_, err = tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	saltMu.Lock()
+	saltDay = ""
+	salt = nil
+	saltMu.Unlock()
+
+	return nil
+}
+
+// optOut checks if the client has asked not to be tracked through either the
+// Do Not Track or Global Privacy Control headers
+func optOut(req *http.Request) bool {
+	return req.Header.Get("DNT") == "1" || req.Header.Get("Sec-GPC") == "1"
+}
+
+// clientID returns the identifier recorded for the client at the remote
+// address, according to the "analytics_ip_mode" config
+func clientID(remoteAddr string, ts time.Time) string {
+	if mode, _ := db.ConfigCache("analytics_ip_mode").(string); mode == IPModeTruncate {
+		return truncateIP(remoteAddr)
+	}
+
+	// the whole address is hashed, so clients sharing a network are still
+	// counted separately
+	ip := parseIP(remoteAddr)
+	if ip == nil {
+		return ""
+	}
+
+	s, err := dailySalt(ts.UTC().Format("2006-01-02"))
+	if err != nil {
+		log.Println("Error getting salt for analytics client id:", err)
+		return ""
+	}
+
+	return hashIP(s, ip.String())
+}
+
+func hashIP(salt []byte, ip string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(ip))
+
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// parseIP returns the IP of the address, without its port, or nil if it has
+// none
+func parseIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	return net.ParseIP(host)
+}
+
+// truncateIP removes the port from the address and zeroes the host portion of
+// the IP, leaving its IPv4 /24 or IPv6 /48 network
+func truncateIP(remoteAddr string) string {
+	ip := parseIP(remoteAddr)
+	if ip == nil {
+		return ""
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// dailySalt gets the salt for the day, creating it if it does not yet exist.
+// Salts for previous days are removed by batchPrune.
+func dailySalt(day string) ([]byte, error) {
+	saltMu.Lock()
+	defer saltMu.Unlock()
+
+	if day == saltDay {
+		return salt, nil
+	}
+
+	var s []byte
+	err := store.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("__salts"))
+		if err != nil {
+			return err
+		}
+
+		if v := b.Get([]byte(day)); v != nil {
+			s = append([]byte{}, v...)
+			return nil
+		}
+
+		s = make([]byte, 32)
+		_, err = rand.Read(s)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(day), s)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	saltDay = day
+	salt = s
+
+	return salt, nil
+}
+
+// migrateRequests replaces the IP address stored with requests recorded by
+// previous versions of Ponzu with a client identifier. A single salt is used
+// which is then discarded, so unique counts are kept without the IP addresses.
+func migrateRequests() error {
+	s := make([]byte, 32)
+	_, err := rand.Read(s)
+	if err != nil {
+		return err
+	}
+
+	return store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("__requests"))
+
+		type legacyRequest struct {
+			RemoteAddr string `json:"ip_address"`
+		}
+
+		updates := make(map[string][]byte)
+		err := b.ForEach(func(k, v []byte) error {
+			var legacy legacyRequest
+			err := json.Unmarshal(v, &legacy)
+			if err != nil || legacy.RemoteAddr == "" {
+				return nil
+			}
+
+			var r apiRequest
+			err = json.Unmarshal(v, &r)
+			if err != nil {
+				return nil
+			}
+
+			r.Client = ""
+			if ip := parseIP(legacy.RemoteAddr); ip != nil {
+				r.Client = hashIP(s, ip.String())
+			}
+
+			j, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+
+			updates[string(k)] = j
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for k, v := range updates {
+			err := b.Put([]byte(k), v)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
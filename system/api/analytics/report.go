@@ -0,0 +1,259 @@
+package analytics
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Count contains the number of requests recorded for a single key within a
+// Report, such as an endpoint, content type, item or status code
+type Count struct {
+	Key     string  `json:"key"`
+	Total   int     `json:"total"`
+	Unique  int     `json:"unique"`
+	Errors  int     `json:"errors"`
+	Latency float64 `json:"avg_latency_ms"`
+}
+
+// Latency contains the response times in milliseconds of the requests within
+// a Report
+type Latency struct {
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// Report contains the breakdown of API requests recorded over a range of days,
+// with the top requested endpoints, content types and items, and the status
+// codes of the responses. Errors are counted for any 4xx or 5xx status code.
+// Since client identifiers change daily, clients are counted as unique once for
+// each day they make requests.
+type Report struct {
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Days      int     `json:"days"`
+	Total     int     `json:"total"`
+	Unique    int     `json:"unique"`
+	Errors    int     `json:"errors"`
+	Latency   Latency `json:"latency"`
+	Endpoints []Count `json:"endpoints"`
+	Types     []Count `json:"content_types"`
+	Items     []Count `json:"items"`
+	Statuses  []Count `json:"status_codes"`
+}
+
+// Breakdown returns a Report of the requests recorded over the number of days
+// provided (including today, up to the retention period), limiting each of its lists to
+// the top limit entries by total requests
+func Breakdown(days, limit int) (*Report, error) {
+	days = clampDays(days)
+	if limit < 1 {
+		limit = 10
+	}
+
+	today := dayStart(time.Now())
+	from := today.AddDate(0, 0, 1-days)
+	min := from.UnixNano() / int64(time.Millisecond)
+
+	endpoints := newCounter()
+	types := newCounter()
+	items := newCounter()
+	statuses := newCounter()
+	clients := make(map[string]struct{})
+
+	report := &Report{
+		From: from.Format("01/02"),
+		To:   today.Format("01/02"),
+		Days: days,
+	}
+
+	var latencies []float64
+	err := store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("__requests"))
+
+		return b.ForEach(func(k, v []byte) error {
+			var r apiRequest
+			err := json.Unmarshal(v, &r)
+			if err != nil {
+				log.Println("Error decoding api request json from analytics db:", err)
+				return nil
+			}
+
+			if r.Timestamp < min {
+				return nil
+			}
+
+			report.Total++
+			if r.Client != "" {
+				clients[r.Client] = struct{}{}
+			}
+			if r.Status >= 400 {
+				report.Errors++
+			}
+
+			// requests recorded before status and latency were tracked
+			// are counted, but not included in latency calculations
+			if r.Status != 0 {
+				latencies = append(latencies, r.Latency)
+			}
+
+			endpoints.add(requestEndpoint(r), r)
+			types.add(r.ContentType, r)
+			items.add(r.Item, r)
+			if r.Status != 0 {
+				statuses.add(strconv.Itoa(r.Status), r)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Unique = len(clients)
+	report.Latency = latencyStats(latencies)
+	report.Endpoints = endpoints.top(limit)
+	report.Types = types.top(limit)
+	report.Items = items.top(limit)
+	report.Statuses = statuses.top(limit)
+
+	return report, nil
+}
+
+// requestEndpoint returns the endpoint which handled the request, or the path
+// of its URL for requests recorded before endpoints were tracked
+func requestEndpoint(r apiRequest) string {
+	if r.Endpoint != "" {
+		return r.Endpoint
+	}
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Path
+}
+
+// clampDays keeps the number of days requested within the range of days that
+// analytics are stored
+func clampDays(days int) int {
+	if days < 1 || days > Retention() {
+		return Retention()
+	}
+
+	return days
+}
+
+type count struct {
+	Count
+	clients map[string]struct{}
+	latency float64
+	timed   int
+}
+
+type counter map[string]*count
+
+func newCounter() counter {
+	return make(counter)
+}
+
+// add records the request against the key, ignoring empty keys
+func (c counter) add(key string, r apiRequest) {
+	if key == "" {
+		return
+	}
+
+	n, ok := c[key]
+	if !ok {
+		n = &count{
+			Count:   Count{Key: key},
+			clients: make(map[string]struct{}),
+		}
+		c[key] = n
+	}
+
+	n.Total++
+	if r.Client != "" {
+		n.clients[r.Client] = struct{}{}
+	}
+	if r.Status >= 400 {
+		n.Errors++
+	}
+	if r.Status != 0 {
+		n.latency += r.Latency
+		n.timed++
+	}
+}
+
+// top returns the limit number of Counts with the most total requests
+func (c counter) top(limit int) []Count {
+	counts := make([]Count, 0, len(c))
+	for _, n := range c {
+		n.Unique = len(n.clients)
+		if n.timed > 0 {
+			n.Latency = round(n.latency / float64(n.timed))
+		}
+
+		counts = append(counts, n.Count)
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Total == counts[j].Total {
+			return counts[i].Key < counts[j].Key
+		}
+
+		return counts[i].Total > counts[j].Total
+	})
+
+	if len(counts) > limit {
+		counts = counts[:limit]
+	}
+
+	return counts
+}
+
+func latencyStats(latencies []float64) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+
+	sort.Float64s(latencies)
+
+	var sum float64
+	for _, l := range latencies {
+		sum += l
+	}
+
+	percentile := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(latencies)))) - 1
+		if i < 0 {
+			i = 0
+		}
+
+		return round(latencies[i])
+	}
+
+	return Latency{
+		Avg: round(sum / float64(len(latencies))),
+		P50: percentile(0.50),
+		P95: percentile(0.95),
+		P99: percentile(0.99),
+		Max: round(latencies[len(latencies)-1]),
+	}
+}
+
+// round reduces a number of milliseconds to microsecond precision
+func round(ms float64) float64 {
+	return math.Floor(ms*1000+0.5) / 1000
+}
@@ -0,0 +1,427 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// PeriodDay rolls up requests by day, keyed by date (2006-01-02)
+	PeriodDay = "day"
+
+	// PeriodWeek rolls up requests by week, keyed by the date of the Monday
+	// the week begins on (2006-01-02)
+	PeriodWeek = "week"
+
+	// PeriodMonth rolls up requests by month, keyed by year and month (2006-01)
+	PeriodMonth = "month"
+)
+
+var periodBuckets = map[string]string{
+	PeriodDay:   "__daily",
+	PeriodWeek:  "__weekly",
+	PeriodMonth: "__monthly",
+}
+
+// Rollup contains the aggregated API requests for a day, week or month. Rollups
+// contain no client data, and are kept indefinitely after the raw requests are
+// pruned. Since client identifiers change daily, Unique for weeks and months is
+// the sum of the unique clients of each day.
+type Rollup struct {
+	Period    string         `json:"period"`
+	Date      string         `json:"date"`
+	Total     int            `json:"total"`
+	Unique    int            `json:"unique"`
+	Errors    int            `json:"errors"`
+	Latency   float64        `json:"avg_latency_ms"`
+	Timed     int            `json:"timed"`
+	Endpoints map[string]int `json:"endpoints"`
+	Types     map[string]int `json:"content_types"`
+	Statuses  map[string]int `json:"status_codes"`
+}
+
+func newRollup(period, date string) *Rollup {
+	return &Rollup{
+		Period:    period,
+		Date:      date,
+		Endpoints: make(map[string]int),
+		Types:     make(map[string]int),
+		Statuses:  make(map[string]int),
+	}
+}
+
+// add includes a raw request in a daily rollup, tracking unique clients in the
+// set provided
+func (r *Rollup) add(req apiRequest, clients map[string]struct{}) {
+	r.Total++
+	if req.Client != "" {
+		if _, ok := clients[req.Client]; !ok {
+			clients[req.Client] = struct{}{}
+			r.Unique++
+		}
+	}
+
+	if req.Status >= 400 {
+		r.Errors++
+	}
+
+	// requests recorded before status and latency were tracked have no status
+	if req.Status != 0 {
+		r.Latency = (r.Latency*float64(r.Timed) + req.Latency) / float64(r.Timed+1)
+		r.Timed++
+		r.Statuses[strconv.Itoa(req.Status)]++
+	}
+
+	if ep := requestEndpoint(req); ep != "" {
+		r.Endpoints[ep]++
+	}
+
+	if req.ContentType != "" {
+		r.Types[req.ContentType]++
+	}
+}
+
+// merge includes another rollup's counts, used to build weeks and months from
+// their days
+func (r *Rollup) merge(o *Rollup) {
+	if r.Timed+o.Timed > 0 {
+		r.Latency = (r.Latency*float64(r.Timed) + o.Latency*float64(o.Timed)) / float64(r.Timed+o.Timed)
+	}
+
+	r.Total += o.Total
+	r.Unique += o.Unique
+	r.Errors += o.Errors
+	r.Timed += o.Timed
+
+	for k, v := range o.Endpoints {
+		r.Endpoints[k] += v
+	}
+	for k, v := range o.Types {
+		r.Types[k] += v
+	}
+	for k, v := range o.Statuses {
+		r.Statuses[k] += v
+	}
+}
+
+// Rollups returns the rollups for the period (PeriodDay, PeriodWeek or
+// PeriodMonth) which begin within the dates from and to, inclusive. The current
+// day is not included until it has been rolled up after it ends.
+func Rollups(period string, from, to time.Time) ([]Rollup, error) {
+	bucket, ok := periodBuckets[period]
+	if !ok {
+		return nil, fmt.Errorf("Unknown analytics period: %s", period)
+	}
+
+	min, max := periodKey(period, from.UTC()), periodKey(period, to.UTC())
+
+	var rollups []Rollup
+	err := store.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(bucket)).Cursor()
+
+		for k, v := c.Seek([]byte(min)); k != nil && string(k) <= max; k, v = c.Next() {
+			var r Rollup
+			err := json.Unmarshal(v, &r)
+			if err != nil {
+				log.Println("Error decoding analytics rollup json from analytics db:", err)
+				continue
+			}
+
+			rollups = append(rollups, r)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rollups, nil
+}
+
+// rollup aggregates the raw requests of each complete day into daily rollups,
+// then rebuilds the weekly and monthly rollups containing those days. A daily
+// rollup is only replaced if it would not lose requests, since some of the raw
+// requests for a day may have been purged.
+func rollup() error {
+	today := dayStart(time.Now())
+
+	days := make(map[string]*Rollup)
+	clients := make(map[string]map[string]struct{})
+	err := store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("__requests"))
+
+		return b.ForEach(func(k, v []byte) error {
+			var r apiRequest
+			err := json.Unmarshal(v, &r)
+			if err != nil {
+				log.Println("Error decoding api request json from analytics db:", err)
+				return nil
+			}
+
+			ts := time.Unix(r.Timestamp/1000, 0)
+			if !ts.Before(today) {
+				return nil
+			}
+
+			day := periodKey(PeriodDay, ts)
+			if _, ok := days[day]; !ok {
+				days[day] = newRollup(PeriodDay, day)
+				clients[day] = make(map[string]struct{})
+			}
+			days[day].add(r, clients[day])
+
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(days) == 0 {
+		return nil
+	}
+
+	return store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("__daily"))
+
+		var updated []string
+		for day, r := range days {
+			existing, err := getRollup(b, day)
+			if err != nil {
+				return err
+			}
+
+			if existing != nil && existing.Total >= r.Total {
+				continue
+			}
+
+			err = putRollup(b, r)
+			if err != nil {
+				return err
+			}
+
+			updated = append(updated, day)
+		}
+
+		return rebuildPeriods(tx, updated)
+	})
+}
+
+// rebuildPeriods recalculates the weekly and monthly rollups which contain any
+// of the days provided from the daily rollups
+func rebuildPeriods(tx *bolt.Tx, days []string) error {
+	daily := tx.Bucket([]byte("__daily"))
+
+	weeks := make(map[string]bool)
+	months := make(map[string]bool)
+	for _, day := range days {
+		t, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			return err
+		}
+
+		weeks[periodKey(PeriodWeek, t)] = true
+		months[periodKey(PeriodMonth, t)] = true
+	}
+
+	for week := range weeks {
+		start, err := time.Parse("2006-01-02", week)
+		if err != nil {
+			return err
+		}
+
+		r := newRollup(PeriodWeek, week)
+		for i := 0; i < 7; i++ {
+			d, err := getRollup(daily, periodKey(PeriodDay, start.AddDate(0, 0, i)))
+			if err != nil {
+				return err
+			}
+
+			if d != nil {
+				r.merge(d)
+			}
+		}
+
+		err = putRollup(tx.Bucket([]byte("__weekly")), r)
+		if err != nil {
+			return err
+		}
+	}
+
+	for month := range months {
+		r := newRollup(PeriodMonth, month)
+
+		// daily keys within the month share its key as a prefix
+		prefix := month + "-"
+		c := daily.Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			var d Rollup
+			err := json.Unmarshal(v, &d)
+			if err != nil {
+				return err
+			}
+
+			r.merge(&d)
+		}
+
+		err := putRollup(tx.Bucket([]byte("__monthly")), r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateMetrics moves the daily totals cached by previous versions of Ponzu,
+// which were keyed by month and day only, into the daily rollups. Each date is
+// assumed to be within the past year.
+func migrateMetrics() error {
+	today := dayStart(time.Now())
+
+	return store.Update(func(tx *bolt.Tx) error {
+		m := tx.Bucket([]byte("__metrics"))
+		if m == nil {
+			return nil
+		}
+
+		b := tx.Bucket([]byte("__daily"))
+
+		var days []string
+		err := m.ForEach(func(k, v []byte) error {
+			var metric apiMetric
+			err := json.Unmarshal(v, &metric)
+			if err != nil {
+				log.Println("Error decoding api metric json from analytics db:", err)
+				return nil
+			}
+
+			date, err := time.Parse("01/02/2006", fmt.Sprintf("%s/%d", metric.Date, today.Year()))
+			if err != nil {
+				log.Println("Error parsing api metric date from analytics db:", err)
+				return nil
+			}
+
+			if date.After(today) {
+				date = date.AddDate(-1, 0, 0)
+			}
+
+			day := periodKey(PeriodDay, date)
+			existing, err := getRollup(b, day)
+			if err != nil {
+				return err
+			}
+
+			if existing != nil {
+				return nil
+			}
+
+			r := newRollup(PeriodDay, day)
+			r.Total = metric.Total
+			r.Unique = metric.Unique
+
+			days = append(days, day)
+
+			return putRollup(b, r)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = rebuildPeriods(tx, days)
+		if err != nil {
+			return err
+		}
+
+		return tx.DeleteBucket([]byte("__metrics"))
+	})
+}
+
+// currentDay returns a daily rollup of today's requests, which are read from
+// the recorded requests not yet rolled up
+func currentDay() (*Rollup, error) {
+	today := dayStart(time.Now())
+	r := newRollup(PeriodDay, periodKey(PeriodDay, today))
+	clients := make(map[string]struct{})
+
+	// request keys are ids which sort as strings, not in the order they were
+	// recorded, so every request is checked rather than stopping at the first
+	// from before today
+	err := store.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("__requests")).ForEach(func(k, v []byte) error {
+			var req apiRequest
+			err := json.Unmarshal(v, &req)
+			if err != nil {
+				log.Println("Error decoding api request json from analytics db:", err)
+				return nil
+			}
+
+			if time.Unix(req.Timestamp/1000, 0).Before(today) {
+				return nil
+			}
+
+			r.add(req, clients)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func getRollup(b *bolt.Bucket, key string) (*Rollup, error) {
+	v := b.Get([]byte(key))
+	if v == nil {
+		return nil, nil
+	}
+
+	r := newRollup("", "")
+	err := json.Unmarshal(v, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func putRollup(b *bolt.Bucket, r *Rollup) error {
+	j, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(r.Date), j)
+}
+
+// periodKey returns the key of the period containing the time provided
+func periodKey(period string, t time.Time) string {
+	t = t.UTC()
+
+	switch period {
+	case PeriodWeek:
+		// weeks begin on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return t.AddDate(0, 0, -offset).Format("2006-01-02")
+
+	case PeriodMonth:
+		return t.Format("2006-01")
+
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// dayStart returns the start of the day (UTC) containing the time provided
+func dayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
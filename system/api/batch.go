@@ -0,0 +1,440 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+)
+
+// maxBatchOperations limits the number of operations in a batch request
+const maxBatchOperations = 100
+
+// contentStore reads and writes content for API requests
+type contentStore interface {
+	Content(target string) ([]byte, error)
+	SetContentItem(target string, post interface{}) (int, error)
+	SetContentItemIf(target string, post interface{}, prev []byte) (int, error)
+	DeleteContentIf(target string, prev []byte) error
+}
+
+// dbStore is the contentStore which reads and writes the database directly
+type dbStore struct{}
+
+func (dbStore) Content(target string) ([]byte, error) {
+	return db.Content(target)
+}
+
+func (dbStore) SetContentItem(target string, post interface{}) (int, error) {
+	return db.SetContentItem(target, post)
+}
+
+func (dbStore) SetContentItemIf(target string, post interface{}, prev []byte) (int, error) {
+	return db.SetContentItemIf(target, post, prev)
+}
+
+func (dbStore) DeleteContentIf(target string, prev []byte) error {
+	return db.DeleteContentIf(target, prev)
+}
+
+// batchTxKey is the context key of the *db.Tx of a batch request, in which its
+// operations read and write content
+type batchTxKey struct{}
+
+// storeFor returns the contentStore for req, which is the transaction of the
+// batch request it is part of, if any
+func storeFor(req *http.Request) contentStore {
+	if tx, ok := req.Context().Value(batchTxKey{}).(*db.Tx); ok {
+		return tx
+	}
+
+	return dbStore{}
+}
+
+// afterBatch reports whether req is an operation in a batch transaction, and if
+// it is, calls hooks once the transaction is saved, rather than while changes
+// to the database are locked to it. By then the response has been sent, so the
+// response hooks write is discarded and their errors are only logged.
+func afterBatch(req *http.Request, hooks func(res *recordResponseWriter) bool) bool {
+	tx, ok := req.Context().Value(batchTxKey{}).(*db.Tx)
+	if !ok {
+		return false
+	}
+
+	tx.After(func() {
+		hooks(&recordResponseWriter{ResponseWriter: discardResponseWriter{}})
+	})
+
+	return true
+}
+
+// batchRequest is the JSON body of a batch request
+type batchRequest struct {
+	Transaction bool             `json:"transaction"`
+	Operations  []batchOperation `json:"operations"`
+}
+
+// batchOperation is an operation on content in a batch request, which is one
+// of get, create, update or delete. The id of content created by an earlier
+// operation can be used in the id or data as "$N.id", where N is the index of
+// the operation.
+type batchOperation struct {
+	Op   string          `json:"op"`
+	Type string          `json:"type"`
+	ID   json.RawMessage `json:"id"`
+	Data json.RawMessage `json:"data"`
+}
+
+// batchResult is the response to an operation in a batch request, as it would
+// be sent if the operation was requested alone
+type batchResult struct {
+	Status int             `json:"status"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors json.RawMessage `json:"errors,omitempty"`
+}
+
+// errBatchFailed is returned to roll back the transaction of a batch request
+// when one of its operations fails
+var errBatchFailed = errors.New("A batch operation failed")
+
+// batchRefPattern matches references to the id of content created by an
+// earlier operation in a batch request
+var batchRefPattern = regexp.MustCompile(`\$(\d+)\.id\b`)
+
+func batchHandler(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		res.Header().Set("Allow", "POST, OPTIONS")
+		sendErrors(res, http.StatusMethodNotAllowed, apiError{
+			Code:    "method_not_allowed",
+			Message: req.Method + " is not allowed for " + req.URL.Path,
+		})
+		return
+	}
+
+	if !requireJSON(res, req) {
+		return
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(req.Body, maxJSONBody+1))
+	if err != nil {
+		sendErrors(res, http.StatusBadRequest, apiError{Code: "invalid_body", Message: err.Error()})
+		return
+	}
+
+	if len(b) > maxJSONBody {
+		sendErrors(res, http.StatusRequestEntityTooLarge, apiError{
+			Code:    "body_too_large",
+			Message: fmt.Sprintf("Request body is larger than %d bytes", maxJSONBody),
+		})
+		return
+	}
+
+	var br batchRequest
+	err = json.Unmarshal(b, &br)
+	if err != nil {
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "invalid_json",
+			Message: "Request body must be a JSON object with a list of operations",
+		})
+		return
+	}
+
+	if len(br.Operations) == 0 || len(br.Operations) > maxBatchOperations {
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "invalid_operations",
+			Message: fmt.Sprintf("A batch must have between 1 and %d operations", maxBatchOperations),
+			Field:   "operations",
+		})
+		return
+	}
+
+	results := make([]batchResult, len(br.Operations))
+	if !br.Transaction {
+		for i := range br.Operations {
+			results[i] = runBatchOperation(req, br.Operations[i], results[:i])
+		}
+
+		sendBatch(res, results)
+		return
+	}
+
+	// each operation is run in the same transaction, and the first to fail
+	// rolls back the changes of the others
+	failed := -1
+	err = db.Batch(func(tx *db.Tx) error {
+		r := req.WithContext(context.WithValue(req.Context(), batchTxKey{}, tx))
+		for i := range br.Operations {
+			results[i] = runBatchOperation(r, br.Operations[i], results[:i])
+			if results[i].Status >= http.StatusBadRequest {
+				failed = i
+				return errBatchFailed
+			}
+		}
+
+		return nil
+	})
+	if err != nil && err != errBatchFailed {
+		log.Println("Error saving batch transaction:", err)
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	if failed >= 0 {
+		for i := range results {
+			if i < failed && br.Operations[i].Op != "get" {
+				results[i] = batchError(http.StatusFailedDependency, apiError{
+					Code:    "rolled_back",
+					Message: fmt.Sprintf("The operation was undone because operation %d failed", failed),
+				})
+			}
+
+			if i > failed {
+				results[i] = batchError(http.StatusFailedDependency, apiError{
+					Code:    "not_run",
+					Message: fmt.Sprintf("The operation was not run because operation %d failed", failed),
+				})
+			}
+		}
+	}
+
+	sendBatch(res, results)
+}
+
+// runBatchOperation runs op as a request to the v2 content API, where the
+// results of the operations before it are prev
+func runBatchOperation(req *http.Request, op batchOperation, prev []batchResult) batchResult {
+	if _, ok := item.Types[op.Type]; !ok {
+		return batchError(http.StatusNotFound, apiError{
+			Code:    "unknown_type",
+			Message: "Unknown content type: " + op.Type,
+			Field:   "type",
+		})
+	}
+
+	var method string
+	switch op.Op {
+	case "get":
+		method = http.MethodGet
+	case "create":
+		method = http.MethodPost
+	case "update":
+		method = http.MethodPatch
+	case "delete":
+		method = http.MethodDelete
+	default:
+		return batchError(http.StatusBadRequest, apiError{
+			Code:    "invalid_op",
+			Message: "The op must be get, create, update or delete",
+			Field:   "op",
+		})
+	}
+
+	path := v2Path + op.Type
+	if op.Op != "create" {
+		id, e := batchID(op.ID, prev)
+		if e != nil && e.Code == "failed_dependency" {
+			return batchError(http.StatusFailedDependency, *e)
+		}
+		if e != nil {
+			return batchError(http.StatusBadRequest, *e)
+		}
+		path += "/" + id
+	}
+
+	var body interface{}
+	if op.Op == "create" || op.Op == "update" {
+		if len(op.Data) == 0 {
+			return batchError(http.StatusBadRequest, apiError{
+				Code:    "missing_data",
+				Message: "The data to " + op.Op + " is required",
+				Field:   "data",
+			})
+		}
+
+		data, e := resolveBatchRefs(op.Data, prev)
+		if e != nil && e.Code == "failed_dependency" {
+			return batchError(http.StatusFailedDependency, *e)
+		}
+		if e != nil {
+			return batchError(http.StatusBadRequest, *e)
+		}
+		body = data
+	}
+
+	r, err := subRequest(req, method, path, nil, body)
+	if err != nil {
+		log.Println("Error creating batch operation request:", err)
+		return batchError(http.StatusInternalServerError, errInternal)
+	}
+
+	w := newCaptureResponseWriter()
+	v2Handler(w, r)
+
+	result := batchResult{Status: w.status}
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+
+	// the response of hooks which write their own may not be JSON
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors json.RawMessage `json:"errors"`
+	}
+	if json.Unmarshal(w.body.Bytes(), &resp) == nil {
+		result.Data, result.Errors = resp.Data, resp.Errors
+	}
+
+	return result
+}
+
+// batchID returns the id of the content in an operation, which is a number or
+// a reference to the id of content created by an earlier operation
+func batchID(raw json.RawMessage, prev []batchResult) (string, *apiError) {
+	invalid := &apiError{
+		Code:    "invalid_id",
+		Message: "The id must be a valid content id",
+		Field:   "id",
+	}
+
+	var id interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if dec.Decode(&id) != nil {
+		return "", invalid
+	}
+
+	if ref, ok := id.(string); ok {
+		v, e := resolveBatchRefs(json.RawMessage(strconv.Quote(ref)), prev)
+		if e != nil {
+			return "", e
+		}
+		id = v
+	}
+
+	s := fmt.Sprint(id)
+	if !db.IsValidID(s) {
+		return "", invalid
+	}
+
+	return s, nil
+}
+
+// resolveBatchRefs decodes the JSON value raw, replacing each "$N.id" in its
+// strings with the id of the content created by operation N. A string which is
+// only a reference is replaced by the id as a number.
+func resolveBatchRefs(raw json.RawMessage, prev []batchResult) (interface{}, *apiError) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, &apiError{Code: "invalid_json", Message: err.Error(), Field: "data"}
+	}
+
+	var e *apiError
+	var resolve func(v interface{}) interface{}
+	resolve = func(v interface{}) interface{} {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			for k := range val {
+				val[k] = resolve(val[k])
+			}
+
+		case []interface{}:
+			for i := range val {
+				val[i] = resolve(val[i])
+			}
+
+		case string:
+			if m := batchRefPattern.FindStringSubmatch(val); m != nil && m[0] == val {
+				id, err := batchRefID(m[1], prev)
+				if err != nil {
+					e = err
+					return val
+				}
+				return json.Number(id)
+			}
+
+			return batchRefPattern.ReplaceAllStringFunc(val, func(ref string) string {
+				id, err := batchRefID(batchRefPattern.FindStringSubmatch(ref)[1], prev)
+				if err != nil {
+					e = err
+					return ref
+				}
+				return id
+			})
+		}
+
+		return v
+	}
+
+	v = resolve(v)
+	if e != nil {
+		return nil, e
+	}
+
+	return v, nil
+}
+
+// batchRefID returns the id of the content created by the operation at index n
+func batchRefID(n string, prev []batchResult) (string, *apiError) {
+	i, err := strconv.Atoi(n)
+	if err != nil || i >= len(prev) {
+		return "", &apiError{
+			Code:    "failed_dependency",
+			Message: "Operation " + n + " must come before the operations which use its id",
+		}
+	}
+
+	var data []struct {
+		ID json.Number `json:"id"`
+	}
+	if prev[i].Status >= http.StatusBadRequest ||
+		json.Unmarshal(prev[i].Data, &data) != nil || len(data) == 0 || data[0].ID == "" {
+		return "", &apiError{
+			Code:    "failed_dependency",
+			Message: "Operation " + n + " didn't create content with an id",
+		}
+	}
+
+	return data[0].ID.String(), nil
+}
+
+// batchError returns the result of an operation which failed before it was
+// run, with the errors why
+func batchError(status int, errs ...apiError) batchResult {
+	j, err := json.Marshal(errs)
+	if err != nil {
+		log.Println("Failed to encode batch errors to JSON:", err)
+	}
+
+	return batchResult{Status: status, Errors: j}
+}
+
+func sendBatch(res http.ResponseWriter, results []batchResult) {
+	j, err := json.Marshal(map[string][]batchResult{
+		"data": results,
+	})
+	if err != nil {
+		log.Println("Failed to encode batch results to JSON:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	_, err = res.Write(j)
+	if err != nil {
+		log.Println("Error writing to response in sendBatch")
+	}
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/schema"
+)
+
+// maxJSONBody limits the size of JSON request bodies, like the maxMemory used to
+// parse multipart forms
+const maxJSONBody = 1024 * 1024 * 4 // 4MB
+
+// isJSON reports whether the body of req is JSON, from its Content-Type
+func isJSON(req *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// decodeJSON decodes the JSON object in the body of req into post, including
+// nested structs and arrays. The body's values are also set in req.PostForm, in
+// the same notation as forms use (e.g. author.name, tags), so the Hookable
+// methods can read them either way. If the body cannot be decoded, the returned
+// apiError describes why.
+func decodeJSON(req *http.Request, post interface{}) *apiError {
+	b, err := ioutil.ReadAll(io.LimitReader(req.Body, maxJSONBody+1))
+	if err != nil {
+		return &apiError{Code: "invalid_body", Message: err.Error()}
+	}
+
+	if len(b) > maxJSONBody {
+		return &apiError{
+			Code:    "body_too_large",
+			Message: fmt.Sprintf("Request body is larger than %d bytes", maxJSONBody),
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var body map[string]interface{}
+	err = dec.Decode(&body)
+	if err == nil && body == nil {
+		err = &json.UnmarshalTypeError{Value: "null"}
+	}
+	if err == nil {
+		err = json.Unmarshal(b, post)
+	}
+
+	switch e := err.(type) {
+	case nil:
+
+	case *json.SyntaxError:
+		return &apiError{
+			Code:    "invalid_json",
+			Message: fmt.Sprintf("%s (at byte %d)", e.Error(), e.Offset),
+		}
+
+	case *json.UnmarshalTypeError:
+		if e.Field == "" {
+			return &apiError{
+				Code:    "invalid_json",
+				Message: "Request body must be a JSON object",
+			}
+		}
+
+		return &apiError{
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("Expected %s to be %s, not %s", e.Field, e.Type, e.Value),
+			Field:   e.Field,
+		}
+
+	default:
+		if err == io.EOF {
+			return &apiError{Code: "invalid_json", Message: "Request body is empty"}
+		}
+
+		return &apiError{Code: "invalid_json", Message: err.Error()}
+	}
+
+	req.PostForm = make(url.Values)
+	formValues("", body, req.PostForm)
+	req.Form = req.PostForm
+
+	return nil
+}
+
+// formValues adds the decoded JSON value v to values, at the key prefix. Objects
+// add their keys as prefix.key, arrays of objects or arrays add each element as
+// prefix.N, and other arrays add their values to prefix, as checkbox fields do.
+func formValues(prefix string, v interface{}, values url.Values) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+
+			formValues(k, val, values)
+		}
+
+	case []interface{}:
+		for i, val := range v {
+			switch val.(type) {
+			case map[string]interface{}, []interface{}:
+				formValues(fmt.Sprintf("%s.%d", prefix, i), val, values)
+			default:
+				formValues(prefix, val, values)
+			}
+		}
+
+	case json.Number:
+		values.Add(prefix, v.String())
+
+	case string:
+		values.Add(prefix, v)
+
+	case bool:
+		values.Add(prefix, strconv.FormatBool(v))
+
+	case nil:
+		values.Add(prefix, "")
+	}
+}
+
+// copyForm returns a copy of the form values, to compare with them after they
+// were passed to the Hookable methods
+func copyForm(form url.Values) url.Values {
+	c := make(url.Values, len(form))
+	for k, v := range form {
+		c[k] = append([]string{}, v...)
+	}
+
+	return c
+}
+
+// decodeFormChanges decodes the values of req.PostForm which differ from prev
+// into post, so that changes the Hookable methods make to the form are saved,
+// as they are for requests sending a form. Values removed from the form are
+// reset.
+func decodeFormChanges(req *http.Request, post interface{}, prev url.Values) error {
+	changed := make(url.Values)
+	for k, v := range req.PostForm {
+		if !equalStrings(v, prev[k]) {
+			changed[k] = v
+		}
+	}
+
+	for k := range prev {
+		if _, ok := req.PostForm[k]; !ok {
+			changed[k] = []string{""}
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	dec := schema.NewDecoder()
+	dec.IgnoreUnknownKeys(true)
+	dec.SetAliasTag("json")
+	dec.ZeroEmpty(true)
+
+	return dec.Decode(post, changed)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hookError responds to a JSON request whose Createable, Updateable or Hookable
+// method returned err, unless the method already wrote a response
+func hookError(res *recordResponseWriter, err error) {
+	if res.status != 0 {
+		return
+	}
+
+	if err == ErrNoAuth {
+		sendErrors(res, http.StatusUnauthorized, apiError{
+			Code:    "unauthorized",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	sendErrors(res, http.StatusBadRequest, apiError{
+		Code:    "rejected",
+		Message: err.Error(),
+	})
+}
+
+// setItem sets fields of the item.Item embedded in post by their JSON names,
+// since it has no setters for them
+func setItem(post interface{}, fields map[string]interface{}) error {
+	j, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(j, post)
+}
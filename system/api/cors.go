@@ -56,9 +56,23 @@ func responseWithCORS(res http.ResponseWriter, req *http.Request) (http.Response
 	return res, true
 }
 
-// CORS wraps a HandlerFunc to respond to OPTIONS requests properly
+// CORS wraps a HandlerFunc to respond to OPTIONS requests properly, and sets the
+// cache policy of its responses, which are sent with their own ETags
 func CORS(next http.HandlerFunc) http.HandlerFunc {
-	return db.CacheControl(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Cache-Control", db.CachePolicy())
+		cors(next).ServeHTTP(res, req)
+	}
+}
+
+// FileCORS wraps a HandlerFunc serving files to apply CORS headers and respond
+// to preflight requests, leaving the caching headers for each file to it
+func FileCORS(next http.HandlerFunc) http.HandlerFunc {
+	return cors(next)
+}
+
+func cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
 		res, cors := responseWithCORS(res, req)
 		if !cors {
 			return
@@ -70,5 +84,19 @@ func CORS(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		next.ServeHTTP(res, req)
-	}))
+	}
+}
+
+// customCORS wraps a HandlerFunc to apply CORS headers, leaving it to respond
+// to OPTIONS requests, such as resumable uploads which use them for discovery,
+// and the v2 API which allows more methods and headers
+func customCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res, cors := responseWithCORS(res, req)
+		if !cors {
+			return
+		}
+
+		next.ServeHTTP(res, req)
+	}
 }
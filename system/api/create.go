@@ -2,7 +2,6 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -35,7 +34,24 @@ func createContentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if isJSON(req) {
+		createContentJSON(res, req)
+		return
+	}
+
+	// uploads larger than the type allows are rejected before they are read
+	var rules interface{}
+	if p, ok := item.Types[req.URL.Query().Get("type")]; ok {
+		rules = p()
+	}
+	upload.LimitBody(res, req, rules)
+
 	err := req.ParseMultipartForm(1024 * 1024 * 4) // maxMemory 4MB
+	if upload.TooLarge(err) {
+		log.Println("[Create] request body too large from:", req.RemoteAddr)
+		res.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		log.Println("[Create] error:", err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -68,7 +84,12 @@ func createContentHandler(res http.ResponseWriter, req *http.Request) {
 	req.PostForm.Set("timestamp", ts)
 	req.PostForm.Set("updated", ts)
 
-	urlPaths, err := upload.StoreFiles(req)
+	urlPaths, err := upload.StoreFilesFor(req, post)
+	if e, ok := err.(*upload.Error); ok {
+		log.Println(err, "from:", req.RemoteAddr)
+		http.Error(res, e.Error(), e.Status)
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -204,41 +225,165 @@ func createContentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// create JSON response to send data back to client
-	var data map[string]interface{}
-	if spec != "" {
-		spec = strings.TrimPrefix(spec, "__")
-		data = map[string]interface{}{
-			"status": spec,
-			"type":   t,
+	sendSaved(res, http.StatusOK, t, spec, id)
+}
+
+// createContentJSON is the createContentHandler for requests with a JSON body,
+// which is decoded into the content type, and errors are described as JSON
+func createContentJSON(res http.ResponseWriter, req *http.Request) {
+	t := req.URL.Query().Get("type")
+	if t == "" {
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "missing_type",
+			Message: "The type query parameter is required",
+		})
+		return
+	}
+
+	id, spec, ok := createJSON(res, req, t)
+	if !ok {
+		return
+	}
+
+	sendSaved(res, http.StatusOK, t, spec, id)
+}
+
+// createJSON decodes the JSON body of req into new content of type t and saves
+// it, calling the same interfaces and hooks as form requests. It returns the id
+// and bucket specifier of the content, or false if the request failed, in which
+// case the response was already written.
+func createJSON(res http.ResponseWriter, req *http.Request, t string) (int, string, bool) {
+	p, found := item.Types[t]
+	if !found {
+		log.Println("[Create] attempt to submit unknown type:", t, "from:", req.RemoteAddr)
+		sendErrors(res, http.StatusNotFound, apiError{
+			Code:    "unknown_type",
+			Message: "Unknown content type: " + t,
+		})
+		return 0, "", false
+	}
+
+	post := p()
+
+	ext, ok := post.(Createable)
+	if !ok {
+		log.Println("[Create] rejected non-createable type:", t, "from:", req.RemoteAddr)
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "not_createable",
+			Message: "Content of type " + t + " cannot be created",
+		})
+		return 0, "", false
+	}
+
+	hook, ok := post.(item.Hookable)
+	if !ok {
+		log.Println("[Create] error: Type", t, "does not implement item.Hookable or embed item.Item.")
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "not_createable",
+			Message: "Content of type " + t + " cannot be created",
+		})
+		return 0, "", false
+	}
+
+	e := decodeJSON(req, post)
+	if e != nil {
+		log.Println("[Create] error decoding JSON body for type:", t, e.Message)
+		sendErrors(res, http.StatusBadRequest, *e)
+		return 0, "", false
+	}
+
+	ts := int64(time.Nanosecond) * time.Now().UnixNano() / int64(time.Millisecond)
+	err := setItem(post, map[string]interface{}{
+		"timestamp": ts,
+		"updated":   ts,
+	})
+	if err != nil {
+		log.Println("[Create] error setting timestamps for type:", t, err)
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return 0, "", false
+	}
+	req.PostForm.Set("timestamp", fmt.Sprintf("%d", ts))
+	req.PostForm.Set("updated", fmt.Sprintf("%d", ts))
+	form := copyForm(req.PostForm)
+
+	// hooks may write their own response, otherwise their error is sent
+	rec := &recordResponseWriter{ResponseWriter: res}
+
+	err = hook.BeforeAPICreate(rec, req)
+	if err != nil {
+		log.Println("[Create] error calling BeforeCreate:", err)
+		hookError(rec, err)
+		return 0, "", false
+	}
+
+	err = ext.Create(rec, req)
+	if err != nil {
+		log.Println("[Create] error calling Accept:", err)
+		hookError(rec, err)
+		return 0, "", false
+	}
+
+	err = hook.BeforeSave(rec, req)
+	if err != nil {
+		log.Println("[Create] error calling BeforeSave:", err)
+		hookError(rec, err)
+		return 0, "", false
+	}
+
+	// set specifier for db bucket in case content is/isn't Trustable
+	var spec string
+
+	trusted, ok := post.(Trustable)
+	if ok {
+		err := trusted.AutoApprove(rec, req)
+		if err != nil {
+			log.Println("[Create] error calling AutoApprove:", err)
+			hookError(rec, err)
+			return 0, "", false
 		}
 	} else {
-		spec = "public"
-		data = map[string]interface{}{
-			"id":     id,
-			"status": spec,
-			"type":   t,
-		}
+		spec = "__pending"
 	}
 
-	resp := map[string]interface{}{
-		"data": []map[string]interface{}{
-			data,
-		},
+	err = decodeFormChanges(req, post, form)
+	if err != nil {
+		log.Println("[Create] error decoding post form changed by hooks for type:", t, err)
+		sendErrors(rec, http.StatusInternalServerError, errInternal)
+		return 0, "", false
 	}
 
-	j, err := json.Marshal(resp)
+	id, err := storeFor(req).SetContentItem(t+spec+":-1", post)
 	if err != nil {
-		log.Println("[Create] error marshalling response to JSON:", err)
-		res.WriteHeader(http.StatusInternalServerError)
-		return
+		log.Println("[Create] error calling SetContentItem:", err)
+		sendErrors(rec, http.StatusInternalServerError, errInternal)
+		return 0, "", false
 	}
 
-	res.Header().Set("Content-Type", "application/json")
-	_, err = res.Write(j)
-	if err != nil {
-		log.Println("[Create] error writing response:", err)
-		return
+	// set the target in the context so user can get saved value from db in hook
+	ctx := context.WithValue(req.Context(), "target", fmt.Sprintf("%s:%d", t, id))
+	req = req.WithContext(ctx)
+
+	after := func(res *recordResponseWriter) bool {
+		err := hook.AfterSave(res, req)
+		if err != nil {
+			log.Println("[Create] error calling AfterSave:", err)
+			hookError(res, err)
+			return false
+		}
+
+		err = hook.AfterAPICreate(res, req)
+		if err != nil {
+			log.Println("[Create] error calling AfterAccept:", err)
+			hookError(res, err)
+			return false
+		}
+
+		return true
+	}
+
+	if !afterBatch(req, after) && !after(rec) {
+		return 0, "", false
 	}
 
+	return id, spec, true
 }
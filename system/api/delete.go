@@ -122,6 +122,133 @@ func deleteContentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	sendDeleted(res, t, id)
+}
+
+// deleteJSON deletes the content of type t with the id, calling the same
+// interfaces and hooks as deleteContentHandler, but describing errors as JSON.
+// If the request has an If-Match header, the content is only deleted if its ETag
+// matches. It returns false if the request failed, in which case the response
+// was already written.
+func deleteJSON(res http.ResponseWriter, req *http.Request, t, id string) bool {
+	post := item.Types[t]()
+
+	ext, ok := post.(Deleteable)
+	if !ok {
+		log.Println("[Delete] rejected non-deleteable type:", t, "from:", req.RemoteAddr)
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "not_deleteable",
+			Message: "Content of type " + t + " cannot be deleted",
+		})
+		return false
+	}
+
+	hook, ok := post.(item.Hookable)
+	if !ok {
+		log.Println("[Delete] error: Type", t, "does not implement item.Hookable or embed item.Item.")
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "not_deleteable",
+			Message: "Content of type " + t + " cannot be deleted",
+		})
+		return false
+	}
+
+	store := storeFor(req)
+
+	b, err := store.Content(t + ":" + id)
+	if err != nil {
+		log.Println("Error in db.Content ", t+":"+id, err)
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return false
+	}
+
+	if len(b) == 0 {
+		sendErrors(res, http.StatusNotFound, apiError{
+			Code:    "not_found",
+			Message: "No " + t + " content with id " + id,
+		})
+		return false
+	}
+
+	ifMatch := req.Header.Get("If-Match")
+	if ifMatch != "" && !matchETag(ifMatch, contentETag(b)) {
+		sendErrors(res, http.StatusPreconditionFailed, errChanged)
+		return false
+	}
+
+	err = json.Unmarshal(b, post)
+	if err != nil {
+		log.Println("Error unmarshalling ", t, "=", id, err)
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return false
+	}
+
+	// hooks may write their own response, otherwise their error is sent
+	rec := &recordResponseWriter{ResponseWriter: res}
+
+	err = hook.BeforeAPIDelete(rec, req)
+	if err != nil {
+		log.Println("[Delete] error calling BeforeAPIDelete:", err)
+		hookError(rec, err)
+		return false
+	}
+
+	err = ext.Delete(rec, req)
+	if err != nil {
+		log.Println("[Delete] error calling Delete:", err)
+		hookError(rec, err)
+		return false
+	}
+
+	err = hook.BeforeDelete(rec, req)
+	if err != nil {
+		log.Println("[Delete] error calling BeforeDelete:", err)
+		hookError(rec, err)
+		return false
+	}
+
+	// the content is only deleted if it is still the version the If-Match
+	// header was checked against, even if it changed while the hooks ran
+	var prev []byte
+	if ifMatch != "" {
+		prev = b
+	}
+
+	err = store.DeleteContentIf(t+":"+id, prev)
+	if err == db.ErrContentChanged {
+		sendErrors(rec, http.StatusPreconditionFailed, errChanged)
+		return false
+	}
+	if err != nil {
+		log.Println("[Delete] error calling DeleteContentIf:", err)
+		sendErrors(rec, http.StatusInternalServerError, errInternal)
+		return false
+	}
+
+	after := func(res *recordResponseWriter) bool {
+		err := hook.AfterDelete(res, req)
+		if err != nil {
+			log.Println("[Delete] error calling AfterDelete:", err)
+			hookError(res, err)
+			return false
+		}
+
+		err = hook.AfterAPIDelete(res, req)
+		if err != nil {
+			log.Println("[Delete] error calling AfterAPIDelete:", err)
+			hookError(res, err)
+			return false
+		}
+
+		return true
+	}
+
+	return afterBatch(req, after) || after(rec)
+}
+
+// sendDeleted responds to a delete request with the id, status and type of the
+// deleted content
+func sendDeleted(res http.ResponseWriter, t, id string) {
 	// create JSON response to send data back to client
 	var data = map[string]interface{}{
 		"id":     id,
@@ -142,11 +269,12 @@ func deleteContentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	j = withMeta(res, j, nil)
+
 	res.Header().Set("Content-Type", "application/json")
 	_, err = res.Write(j)
 	if err != nil {
 		log.Println("[Delete] error writing response:", err)
 		return
 	}
-
 }
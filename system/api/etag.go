@@ -0,0 +1,131 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+
+	"github.com/tidwall/gjson"
+)
+
+// errChanged is sent when the content of a request with an If-Match header was
+// changed since the client read it
+var errChanged = apiError{
+	Code:    "precondition_failed",
+	Message: "The content was changed since it was read, fetch it and try again",
+}
+
+// contentETag returns a strong ETag for the JSON encoded content j, which only
+// changes when the content does
+func contentETag(j []byte) string {
+	sum := sha1.Sum(j)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// matchETag reports whether the If-Match or If-None-Match header value, a list
+// of ETags or "*", includes etag
+func matchETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchWeakETag reports whether the If-None-Match header value, a list of ETags
+// or "*", includes etag, ignoring whether either is weak
+func matchWeakETag(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// itemETag returns the ETag of a response with the JSON encoded content j, for
+// the request params q, and when the content was last updated. Responses which
+// only include some fields have their own weak ETag. Responses with expanded
+// references also change with the content they reference, so have no ETag
+// until they are encoded.
+func itemETag(j []byte, q url.Values) (string, time.Time) {
+	if q.Get("expand") != "" {
+		return "", time.Time{}
+	}
+
+	if fields := q.Get("fields"); fields != "" {
+		return "W/" + contentETag(append(append([]byte{}, j...), "\x00fields="+fields...)), updated(j)
+	}
+
+	return contentETag(j), updated(j)
+}
+
+// collectionETag returns a weak ETag for a response listing content of type t,
+// for the request params q, which changes when any content of the type does,
+// and when it last changed. Responses with expanded references have no ETag
+// until they are encoded.
+func collectionETag(t string, q url.Values) (string, time.Time) {
+	if q.Get("expand") != "" {
+		return "", time.Time{}
+	}
+
+	version, modified := db.ContentVersion(t)
+
+	return "W/" + contentETag([]byte(fmt.Sprintf("%s:%d?%s", t, version, q.Encode()))), modified
+}
+
+// updated returns the time the JSON encoded content j was last updated, or the
+// zero time if it isn't known
+func updated(j []byte) time.Time {
+	ms := gjson.GetBytes(j, "updated").Int()
+	if ms <= 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// notModified sets the ETag and Last-Modified headers of a response, when they
+// are known, and responds 304 Not Modified to GET requests whose If-None-Match
+// or If-Modified-Since header shows the client has the current response.
+func notModified(res http.ResponseWriter, req *http.Request, etag string, modified time.Time) bool {
+	if etag != "" {
+		res.Header().Set("ETag", etag)
+	}
+
+	if !modified.IsZero() {
+		res.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	// If-Modified-Since is ignored when If-None-Match is sent, as it is more
+	// precise
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		if etag == "" || !matchWeakETag(match, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+		if err != nil || modified.IsZero() || modified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	res.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// maxExpandDepth is the number of levels of references which can be expanded,
+// e.g. expand=author.company.country
+const maxExpandDepth = 3
+
+// parseExpand reads the comma separated list of reference fields in the
+// "expand" query param, where the fields to expand within the referenced
+// content are separated by dots
+func parseExpand(param string) (fieldTree, error) {
+	tree := fieldTree{}
+	if param == "" {
+		return tree, nil
+	}
+
+	for _, path := range strings.Split(param, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		names := strings.Split(path, ".")
+		if len(names) > maxExpandDepth {
+			return nil, fmt.Errorf("Can't expand %s, references can only be expanded %d levels deep", path, maxExpandDepth)
+		}
+
+		node := tree
+		for _, name := range names {
+			if !validFieldName(name) {
+				return nil, fmt.Errorf("Can't expand %s, it isn't a field name", path)
+			}
+
+			if node[name] == nil {
+				node[name] = fieldTree{}
+			}
+			node = node[name]
+		}
+	}
+
+	return tree, nil
+}
+
+// validFieldName reports if name can be used as a field in a gjson path
+func validFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, r := range name {
+		if !(r == '_' || r == '-' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expander replaces the references in content API responses with the content
+// they reference, as it would be sent to the request
+type expander struct {
+	req    *http.Request
+	loaded map[string]json.RawMessage
+}
+
+// expand replaces the reference fields in the tree, of each content item in
+// the top-level "data" array of a response
+func expand(req *http.Request, data []byte, tree fieldTree) ([]byte, error) {
+	if len(tree) == 0 {
+		return data, nil
+	}
+
+	e := &expander{
+		req:    req,
+		loaded: make(map[string]json.RawMessage),
+	}
+
+	var err error
+	n := int(gjson.GetBytes(data, "data.#").Int())
+	for i := 0; i < n; i++ {
+		data, err = e.expand(data, fmt.Sprintf("data.%d", i), tree)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// expand replaces the reference fields in the tree of the object at path.
+// A single reference to content which was deleted or is hidden becomes null,
+// and is left out of a list of references. Fields which aren't references are
+// left as they are.
+func (e *expander) expand(data []byte, path string, tree fieldTree) ([]byte, error) {
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fieldPath := path + "." + name
+		value := gjson.GetBytes(data, fieldPath)
+
+		switch {
+		case value.Type == gjson.String:
+			post, ok, err := e.reference(value.Str)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				continue
+			}
+
+			if post == nil {
+				post = json.RawMessage("null")
+			}
+
+			data, err = sjson.SetRawBytes(data, fieldPath, post)
+			if err != nil {
+				return nil, err
+			}
+
+			if string(post) != "null" && len(tree[name]) > 0 {
+				data, err = e.expand(data, fieldPath, tree[name])
+				if err != nil {
+					return nil, err
+				}
+			}
+
+		case value.Type == gjson.JSON && strings.HasPrefix(value.Raw, "["):
+			refs := value.Array()
+			posts := []json.RawMessage{}
+			isRefs := true
+			for i := range refs {
+				if refs[i].Type != gjson.String {
+					isRefs = false
+					break
+				}
+
+				post, ok, err := e.reference(refs[i].Str)
+				if err != nil {
+					return nil, err
+				}
+
+				if !ok {
+					isRefs = false
+					break
+				}
+
+				if post != nil {
+					posts = append(posts, post)
+				}
+			}
+
+			if !isRefs {
+				continue
+			}
+
+			list, err := json.Marshal(posts)
+			if err != nil {
+				return nil, err
+			}
+
+			data, err = sjson.SetRawBytes(data, fieldPath, list)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(tree[name]) > 0 {
+				for i := range posts {
+					data, err = e.expand(data, fmt.Sprintf("%s.%d", fieldPath, i), tree[name])
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// reference loads the content referenced by ref, a content API URL like
+// /api/content?type=Author&id=1. It returns false if ref isn't a reference,
+// and nil content if there is none or it is hidden.
+func (e *expander) reference(ref string) (json.RawMessage, bool, error) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Path != "/api/content" {
+		return nil, false, nil
+	}
+
+	q := u.Query()
+	t, id := q.Get("type"), q.Get("id")
+	it, ok := item.Types[t]
+	if !ok || !db.IsValidID(id) {
+		return nil, false, nil
+	}
+
+	key := t + ":" + id
+	if post, ok := e.loaded[key]; ok {
+		return post, true, nil
+	}
+
+	post, err := e.content(it, key)
+	if err != nil {
+		return nil, true, err
+	}
+
+	e.loaded[key] = post
+	return post, true, nil
+}
+
+// content loads the content with the key, with the fields its type omits
+// from the request removed
+func (e *expander) content(it func() interface{}, key string) (json.RawMessage, error) {
+	b, err := db.Content(key)
+	if err != nil {
+		log.Println("Error getting referenced content:", key, err)
+		return nil, errors.New("The referenced content could not be loaded")
+	}
+
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	p := it()
+	err = json.Unmarshal(b, p)
+	if err != nil {
+		log.Println("Error unmarshalling referenced content:", key, err)
+		return nil, errors.New("The referenced content could not be loaded")
+	}
+
+	hidden, err := isHidden(discardResponseWriter{}, e.req, p)
+	if err != nil || hidden {
+		return nil, nil
+	}
+
+	j, err := fmtJSON(json.RawMessage(b))
+	if err != nil {
+		return nil, err
+	}
+
+	j, err = omit(discardResponseWriter{}, e.req, p, j)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(gjson.GetBytes(j, "data.0").Raw), nil
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// fieldTree holds the names of fields in a content item, and the fields within
+// each of them
+type fieldTree map[string]fieldTree
+
+// parseFields reads the comma separated list of fields in the "fields" query
+// param, where fields of nested objects are separated by dots. A field with no
+// fields within it is selected whole.
+func parseFields(param string) (fieldTree, error) {
+	tree := fieldTree{}
+	for _, path := range strings.Split(param, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		names := strings.Split(path, ".")
+		for _, name := range names {
+			if !validFieldName(name) {
+				return nil, fmt.Errorf("Can't select %s, it isn't a field name", path)
+			}
+		}
+
+		node := tree
+		for i, name := range names {
+			if i == len(names)-1 {
+				// the whole field is selected, including any fields within it
+				// which were selected before
+				node[name] = fieldTree{}
+				break
+			}
+
+			child, ok := node[name]
+			if ok && len(child) == 0 {
+				// the whole field was selected before
+				break
+			}
+
+			if !ok {
+				child = fieldTree{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+
+	return tree, nil
+}
+
+// project keeps only the fields in the tree of each content item in the
+// top-level "data" array of a response. It is called after omit(), so fields
+// which are omitted can't be selected.
+func project(data []byte, tree fieldTree) ([]byte, error) {
+	if len(tree) == 0 {
+		return data, nil
+	}
+
+	var result = []json.RawMessage{}
+	for _, post := range gjson.GetBytes(data, "data").Array() {
+		result = append(result, projectObject(post, tree))
+	}
+
+	return fmtJSON(result...)
+}
+
+// projectObject returns the fields of the JSON object in the tree, in the order
+// they are in the object
+func projectObject(obj gjson.Result, tree fieldTree) json.RawMessage {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	obj.ForEach(func(key, value gjson.Result) bool {
+		fields, ok := tree[key.Str]
+		if !ok {
+			return true
+		}
+
+		var raw string
+		switch {
+		case len(fields) == 0:
+			raw = value.Raw
+
+		case value.Type == gjson.JSON && strings.HasPrefix(value.Raw, "{"):
+			raw = string(projectObject(value, fields))
+
+		default:
+			// fields can only be selected from within objects
+			return true
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(key.Raw)
+		buf.WriteByte(':')
+		buf.WriteString(raw)
+		return true
+	})
+	buf.WriteByte('}')
+
+	return json.RawMessage(buf.Bytes())
+}
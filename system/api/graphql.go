@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ponzu-cms/ponzu/system/api/graphql"
+	"github.com/ponzu-cms/ponzu/system/db"
+)
+
+func graphqlHandler(res http.ResponseWriter, req *http.Request) {
+	if enabled, _ := db.ConfigCache("graphql_enabled").(bool); !enabled {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	gr, status, err := graphqlRequest(req)
+	if err != nil {
+		if status == http.StatusMethodNotAllowed {
+			res.Header().Set("Allow", "GET, HEAD, POST, OPTIONS")
+		}
+
+		sendGraphQL(res, status, &graphql.Result{
+			Errors: []*graphql.ResponseError{graphql.NewResponseError(err)},
+		})
+		return
+	}
+
+	schema, err := newGraphQLSchema(req)
+	if err != nil {
+		log.Println("Error generating GraphQL schema:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// without a query, GET requests are sent the schema, so developers can see
+	// what they can query
+	if gr.Query == "" && req.Method != http.MethodPost {
+		res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, err = io.WriteString(res, schema.String())
+		if err != nil {
+			log.Println("Error writing to response in graphqlHandler")
+		}
+		return
+	}
+
+	doc, err := graphql.Parse(gr.Query)
+	if err != nil {
+		sendGraphQL(res, http.StatusBadRequest, &graphql.Result{
+			Errors: []*graphql.ResponseError{graphql.NewResponseError(err)},
+		})
+		return
+	}
+
+	op, errs := schema.Validate(doc, gr.OperationName)
+	if len(errs) > 0 {
+		sendGraphQL(res, http.StatusBadRequest, &graphql.Result{Errors: errs})
+		return
+	}
+
+	// GET requests may be repeated or prefetched, so must not change content
+	if op.Type == "mutation" && req.Method != http.MethodPost {
+		res.Header().Set("Allow", "POST")
+		sendGraphQL(res, http.StatusMethodNotAllowed, &graphql.Result{
+			Errors: []*graphql.ResponseError{{Message: "Mutations must be sent in POST requests"}},
+		})
+		return
+	}
+
+	result := schema.Execute(doc, op, gr.Variables)
+	if result.Data == nil {
+		sendGraphQL(res, http.StatusBadRequest, result)
+		return
+	}
+
+	sendGraphQL(res, http.StatusOK, result)
+}
+
+// graphqlRequest reads the GraphQL request from the query string of GET
+// requests, or the body of POST requests. If it can't, it returns the status
+// code to respond with, and why.
+func graphqlRequest(req *http.Request) (*graphql.Request, int, error) {
+	gr := &graphql.Request{}
+	q := req.URL.Query()
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		gr.Query = q.Get("query")
+
+	case http.MethodPost:
+		mt, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if mt != "application/graphql" && !isJSON(req) {
+			return nil, http.StatusUnsupportedMediaType, errors.New("Request body must be sent with Content-Type: application/json")
+		}
+
+		b, err := ioutil.ReadAll(io.LimitReader(req.Body, maxJSONBody+1))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		if len(b) > maxJSONBody {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("Request body is larger than %d bytes", maxJSONBody)
+		}
+
+		if mt == "application/graphql" {
+			gr.Query = string(b)
+			break
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+
+		err = dec.Decode(gr)
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("Request body must be a JSON object with a query")
+		}
+
+		if gr.Query == "" {
+			return nil, http.StatusBadRequest, errors.New("The query is required")
+		}
+
+		return gr, 0, nil
+
+	default:
+		return nil, http.StatusMethodNotAllowed, errors.New(req.Method + " is not allowed for " + req.URL.Path)
+	}
+
+	gr.OperationName = q.Get("operationName")
+	if v := q.Get("variables"); v != "" {
+		dec := json.NewDecoder(strings.NewReader(v))
+		dec.UseNumber()
+
+		err := dec.Decode(&gr.Variables)
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("The variables must be a JSON object")
+		}
+	}
+
+	return gr, 0, nil
+}
+
+func sendGraphQL(res http.ResponseWriter, status int, result *graphql.Result) {
+	j, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Failed to encode GraphQL result to JSON:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Vary", "Accept-Encoding")
+	res.WriteHeader(status)
+
+	_, err = res.Write(j)
+	if err != nil {
+		log.Println("Error writing to response in sendGraphQL")
+	}
+}
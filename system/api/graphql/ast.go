@@ -0,0 +1,222 @@
+// Package graphql parses GraphQL query documents, for the GraphQL API to
+// execute against the content types registered with Ponzu.
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Document is a parsed GraphQL query document
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query or mutation within a Document
+type Operation struct {
+	Type       string // query, mutation or subscription
+	Name       string
+	Variables  []*VariableDefinition
+	Directives []*Directive
+	Selections []*Selection
+	Location
+}
+
+// Operation returns the operation with the name, or the only operation in the
+// document if name is empty
+func (d *Document) Operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) != 1 {
+			return nil, fmt.Errorf("An operation name is required when the document has %d operations", len(d.Operations))
+		}
+
+		return d.Operations[0], nil
+	}
+
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Unknown operation named %q", name)
+}
+
+// VariableDefinition declares a variable of an Operation
+type VariableDefinition struct {
+	Name    string
+	Type    *TypeRef
+	Default *Value
+	Location
+}
+
+// TypeRef is a reference to a type, such as [Int!]!
+type TypeRef struct {
+	Name    string   // empty if a list
+	Elem    *TypeRef // the type of the list's elements
+	NonNull bool
+}
+
+func (t *TypeRef) String() string {
+	s := t.Name
+	if t.Elem != nil {
+		s = "[" + t.Elem.String() + "]"
+	}
+
+	if t.NonNull {
+		s += "!"
+	}
+
+	return s
+}
+
+// Selection is a field, fragment spread or inline fragment within a selection
+// set. Field is set for fields, Fragment for fragment spreads, and Selections
+// for inline fragments.
+type Selection struct {
+	Field         *Field
+	Fragment      string
+	TypeCondition string
+	Selections    []*Selection
+	Directives    []*Directive
+	Location
+}
+
+// Field is a field selected from an object
+type Field struct {
+	Alias      string
+	Name       string
+	Arguments  []*Argument
+	Selections []*Selection
+	Location
+}
+
+// Key returns the name of the field in the response
+func (f *Field) Key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+
+	return f.Name
+}
+
+// Argument returns the field's argument with the name, or nil
+func (f *Field) Argument(name string) *Argument {
+	for _, a := range f.Arguments {
+		if a.Name == name {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// Fragment is a named fragment
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Directives    []*Directive
+	Selections    []*Selection
+	Location
+}
+
+// Directive is a directive such as @skip(if: true)
+type Directive struct {
+	Name      string
+	Arguments []*Argument
+	Location
+}
+
+// Argument is a named value passed to a field or directive, or a field of an
+// object value
+type Argument struct {
+	Name  string
+	Value *Value
+	Location
+}
+
+// ValueKind is the kind of a Value
+type ValueKind int
+
+// The kinds of Value
+const (
+	Variable ValueKind = iota
+	IntValue
+	FloatValue
+	StringValue
+	BooleanValue
+	NullValue
+	EnumValue
+	ListValue
+	ObjectValue
+)
+
+// Value is a literal value or variable
+type Value struct {
+	Kind   ValueKind
+	Raw    string // the name of a variable or enum value, or the literal
+	List   []*Value
+	Fields []*Argument
+	Location
+}
+
+// Interface returns the value as a Go value, with variables replaced by their
+// values in vars. Ints are int64, floats are float64, enum values are strings,
+// lists are []interface{} and objects are map[string]interface{}.
+func (v *Value) Interface(vars map[string]interface{}) interface{} {
+	switch v.Kind {
+	case Variable:
+		return vars[v.Raw]
+
+	case IntValue:
+		i, err := strconv.ParseInt(v.Raw, 10, 64)
+		if err != nil {
+			f, _ := strconv.ParseFloat(v.Raw, 64)
+			return f
+		}
+		return i
+
+	case FloatValue:
+		f, _ := strconv.ParseFloat(v.Raw, 64)
+		return f
+
+	case StringValue, EnumValue:
+		return v.Raw
+
+	case BooleanValue:
+		return v.Raw == "true"
+
+	case ListValue:
+		list := make([]interface{}, 0, len(v.List))
+		for _, e := range v.List {
+			list = append(list, e.Interface(vars))
+		}
+		return list
+
+	case ObjectValue:
+		obj := make(map[string]interface{}, len(v.Fields))
+		for _, f := range v.Fields {
+			obj[f.Name] = f.Value.Interface(vars)
+		}
+		return obj
+	}
+
+	return nil
+}
+
+// Location is the position of a token in the query document, from 1
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is a syntax error in a query document
+type Error struct {
+	Message string
+	Location
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Syntax Error: %s (line %d, column %d)", e.Message, e.Line, e.Column)
+}
@@ -0,0 +1,529 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// maxResolved limits the number of fields resolved for a request, since a
+// small query can select a very large response through nested lists
+const maxResolved = 1000000
+
+// Request is a GraphQL request, as sent in the body of a POST request
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Result is the response to a Request. Data is nil if the request failed before
+// it was executed, such as for invalid variables, so it is omitted from the
+// response, and is otherwise an object, or null if a non-null root field failed.
+type Result struct {
+	Data   interface{}      `json:"data,omitempty"`
+	Errors []*ResponseError `json:"errors,omitempty"`
+}
+
+type executor struct {
+	schema   *Schema
+	doc      *Document
+	vars     map[string]interface{}
+	errs     []*ResponseError
+	resolved int
+}
+
+// errTooComplex ends execution when too many fields are resolved
+type errTooComplex struct{}
+
+// Execute executes the operation op of doc, which must have been validated by
+// Validate, with the variables
+func (s *Schema) Execute(doc *Document, op *Operation, variables map[string]interface{}) *Result {
+	ex := &executor{
+		schema: s,
+		doc:    doc,
+		vars:   make(map[string]interface{}),
+	}
+
+	for _, def := range op.Variables {
+		t := s.typeOf(def.Type)
+
+		v, ok := variables[def.Name]
+		if !ok {
+			if def.Default != nil {
+				ex.vars[def.Name], _ = coerce(t, def.Default.Interface(nil))
+				continue
+			}
+
+			if t.Kind == NonNull {
+				ex.errorf(def.Location, "Variable \"$%s\" of required type %q was not provided.", def.Name, def.Type)
+			}
+			continue
+		}
+
+		cv, err := coerce(t, v)
+		if err != nil {
+			ex.errorf(def.Location, "Variable \"$%s\" got invalid value %s; %s", def.Name, describe(v), err)
+			continue
+		}
+
+		ex.vars[def.Name] = cv
+	}
+
+	if len(ex.errs) > 0 {
+		return &Result{Errors: ex.errs}
+	}
+
+	root := s.Query
+	if op.Type == "mutation" {
+		root = s.Mutation
+	}
+
+	data, failed := ex.run(root, op.Selections)
+	if failed {
+		data = nil
+	}
+
+	return &Result{Data: data, Errors: ex.errs}
+}
+
+// run executes the root selections, recovering if too many fields are resolved
+func (ex *executor) run(root *Type, sels []*Selection) (data *orderedMap, failed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(errTooComplex); !ok {
+				panic(r)
+			}
+
+			ex.errs = append(ex.errs, &ResponseError{Message: "The query selects too many fields"})
+			data, failed = nil, true
+		}
+	}()
+
+	return ex.executeSelections(root, ex.schema, sels, nil)
+}
+
+func (ex *executor) errorf(loc Location, format string, args ...interface{}) {
+	ex.errs = append(ex.errs, &ResponseError{
+		Message:   fmt.Sprintf(format, args...),
+		Locations: []Location{loc},
+	})
+}
+
+func (ex *executor) fieldError(f *Field, path []interface{}, err error) {
+	ex.errs = append(ex.errs, &ResponseError{
+		Message:   err.Error(),
+		Locations: []Location{f.Location},
+		Path:      path,
+	})
+}
+
+// executeSelections returns the fields selected from source, an object of type
+// t. It reports whether a non-null field was null, so the object must be too.
+func (ex *executor) executeSelections(t *Type, source interface{}, sels []*Selection, path []interface{}) (*orderedMap, bool) {
+	var keys []string
+	groups := make(map[string][]*Field)
+	ex.collectFields(t, sels, make(map[string]bool), &keys, groups)
+
+	m := &orderedMap{values: make(map[string]interface{}, len(keys))}
+	for _, key := range keys {
+		fields := groups[key]
+		fieldPath := appendPath(path, key)
+
+		v, failed := ex.executeField(t, source, fields, fieldPath)
+		if failed {
+			return nil, true
+		}
+
+		m.keys = append(m.keys, key)
+		m.values[key] = v
+	}
+
+	return m, false
+}
+
+// collectFields groups the fields selected by sels from an object of type t by
+// their response keys, in the order they are first selected
+func (ex *executor) collectFields(t *Type, sels []*Selection, visited map[string]bool, keys *[]string, groups map[string][]*Field) {
+	for _, sel := range sels {
+		if ex.skip(sel.Directives) {
+			continue
+		}
+
+		switch {
+		case sel.Field != nil:
+			key := sel.Field.Key()
+			if _, ok := groups[key]; !ok {
+				*keys = append(*keys, key)
+			}
+			groups[key] = append(groups[key], sel.Field)
+
+		case sel.Fragment != "":
+			if visited[sel.Fragment] {
+				continue
+			}
+			visited[sel.Fragment] = true
+
+			f := ex.doc.Fragments[sel.Fragment]
+			if f.TypeCondition != t.Name {
+				continue
+			}
+
+			ex.collectFields(t, f.Selections, visited, keys, groups)
+
+		default:
+			if sel.TypeCondition != "" && sel.TypeCondition != t.Name {
+				continue
+			}
+
+			ex.collectFields(t, sel.Selections, visited, keys, groups)
+		}
+	}
+}
+
+// skip reports whether the @skip or @include directives exclude a selection
+func (ex *executor) skip(dirs []*Directive) bool {
+	for _, d := range dirs {
+		if len(d.Arguments) == 0 {
+			continue
+		}
+
+		cond, _ := d.Arguments[0].Value.Interface(ex.vars).(bool)
+		switch d.Name {
+		case "skip":
+			if cond {
+				return true
+			}
+		case "include":
+			if !cond {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// executeField resolves the value of the fields with the same response key
+// from source, reporting whether it was null although the field is non-null
+func (ex *executor) executeField(t *Type, source interface{}, fields []*Field, path []interface{}) (interface{}, bool) {
+	ex.resolved++
+	if ex.resolved > maxResolved {
+		panic(errTooComplex{})
+	}
+
+	f := fields[0]
+	if f.Name == "__typename" {
+		return t.Name, false
+	}
+
+	def := ex.schema.fieldDef(t, f.Name)
+	if def == schemaField || def == typeField {
+		source = ex.schema
+	}
+
+	args, err := ex.coerceArguments(def.Args, f.Arguments)
+	if err != nil {
+		ex.fieldError(f, path, err)
+		return nil, def.Type.Kind == NonNull
+	}
+
+	v, err := ex.resolve(def, source, args)
+	if err != nil {
+		ex.fieldError(f, path, err)
+		return nil, def.Type.Kind == NonNull
+	}
+
+	return ex.complete(def.Type, fields, v, path)
+}
+
+// resolve calls the field's resolver, or gets the field from a map source
+func (ex *executor) resolve(def *FieldDef, source interface{}, args map[string]interface{}) (v interface{}, err error) {
+	if def.Resolve == nil {
+		m, _ := source.(map[string]interface{})
+		return m[def.Name], nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(errTooComplex); ok {
+				panic(r)
+			}
+
+			v, err = nil, fmt.Errorf("Internal error resolving %s: %v", def.Name, r)
+		}
+	}()
+
+	return def.Resolve(source, args)
+}
+
+// complete converts the resolved value v to the response value of type t,
+// reporting whether it was null although t is non-null
+func (ex *executor) complete(t *Type, fields []*Field, v interface{}, path []interface{}) (interface{}, bool) {
+	if t.Kind != NonNull {
+		// a nullable value is null when a non-null value within it is, and
+		// the error was already added
+		r, _ := ex.completeValue(t, fields, v, path)
+		return r, false
+	}
+
+	r, failed := ex.completeValue(t.OfType, fields, v, path)
+	if failed {
+		return nil, true
+	}
+
+	if r == nil {
+		ex.fieldError(fields[0], path, fmt.Errorf("Cannot return null for non-nullable field %s.", fields[0].Name))
+		return nil, true
+	}
+
+	return r, false
+}
+
+// completeValue converts v to the response value of the nullable type t,
+// reporting whether a non-null value within it was null, so it must be too
+func (ex *executor) completeValue(t *Type, fields []*Field, v interface{}, path []interface{}) (interface{}, bool) {
+	if isNull(v) {
+		return nil, false
+	}
+
+	switch t.Kind {
+	case Scalar, Enum:
+		var r interface{}
+		var err error
+		if t.Kind == Enum {
+			r, err = serializeEnum(t, v)
+		} else {
+			r, err = t.Serialize(v)
+		}
+
+		if err != nil {
+			ex.fieldError(fields[0], path, err)
+			return nil, false
+		}
+
+		return r, false
+
+	case List:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			ex.fieldError(fields[0], path, fmt.Errorf("Expected a list for field %s", fields[0].Name))
+			return nil, false
+		}
+
+		list := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			r, failed := ex.complete(t.OfType, fields, rv.Index(i).Interface(), appendPath(path, i))
+			if failed {
+				return nil, true
+			}
+
+			list = append(list, r)
+		}
+
+		return list, false
+
+	case Object:
+		var sels []*Selection
+		for _, f := range fields {
+			sels = append(sels, f.Selections...)
+		}
+
+		m, failed := ex.executeSelections(t, v, sels, path)
+		if failed {
+			return nil, true
+		}
+
+		return m, false
+	}
+
+	return nil, false
+}
+
+func serializeEnum(t *Type, v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok || !hasEnumValue(t, s) {
+		return nil, fmt.Errorf("Enum %q cannot represent value %s", t.Name, describe(v))
+	}
+
+	return s, nil
+}
+
+// isNull reports whether v is nil, or a nil pointer, slice or map
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return rv.IsNil()
+	}
+
+	return false
+}
+
+// coerceArguments returns the values of the arguments defined by defs, from the
+// args given or their defaults
+func (ex *executor) coerceArguments(defs []*InputValue, args []*Argument) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(defs))
+	for _, def := range defs {
+		var arg *Argument
+		for _, a := range args {
+			if a.Name == def.Name {
+				arg = a
+			}
+		}
+
+		given := arg != nil
+		if given && arg.Value.Kind == Variable {
+			_, given = ex.vars[arg.Value.Raw]
+		}
+
+		if !given {
+			if def.Default != nil {
+				values[def.Name] = def.Default
+			} else if def.Type.Kind == NonNull {
+				return nil, fmt.Errorf("Argument %q of required type %q was not provided.", def.Name, def.Type)
+			}
+			continue
+		}
+
+		v, err := coerce(def.Type, arg.Value.Interface(ex.vars))
+		if err != nil {
+			return nil, fmt.Errorf("Argument %q has invalid value %s; %s", def.Name, formatLiteral(arg.Value), err)
+		}
+
+		values[def.Name] = v
+	}
+
+	return values, nil
+}
+
+// coerce converts the input value v to type t
+func coerce(t *Type, v interface{}) (interface{}, error) {
+	if t.Kind == NonNull {
+		if v == nil {
+			return nil, fmt.Errorf("Expected non-nullable type %q not to be null", t)
+		}
+
+		return coerce(t.OfType, v)
+	}
+
+	if v == nil {
+		return nil, nil
+	}
+
+	switch t.Kind {
+	case List:
+		list, ok := v.([]interface{})
+		if !ok {
+			item, err := coerce(t.OfType, v)
+			if err != nil {
+				return nil, err
+			}
+
+			return []interface{}{item}, nil
+		}
+
+		items := make([]interface{}, 0, len(list))
+		for i, item := range list {
+			cv, err := coerce(t.OfType, item)
+			if err != nil {
+				return nil, fmt.Errorf("at index %d: %s", i, err)
+			}
+
+			items = append(items, cv)
+		}
+
+		return items, nil
+
+	case InputObject:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Expected type %q to be an object", t.Name)
+		}
+
+		for name := range obj {
+			if inputValue(t.InputFields, name) == nil {
+				return nil, fmt.Errorf("Field %q is not defined by type %q", name, t.Name)
+			}
+		}
+
+		values := make(map[string]interface{}, len(obj))
+		for _, def := range t.InputFields {
+			fv, ok := obj[def.Name]
+			if !ok {
+				if def.Default != nil {
+					values[def.Name] = def.Default
+				} else if def.Type.Kind == NonNull {
+					return nil, fmt.Errorf("Field %q of required type %q was not provided", def.Name, def.Type)
+				}
+				continue
+			}
+
+			cv, err := coerce(def.Type, fv)
+			if err != nil {
+				return nil, fmt.Errorf("at %q: %s", def.Name, err)
+			}
+
+			values[def.Name] = cv
+		}
+
+		return values, nil
+
+	case Enum:
+		s, ok := v.(string)
+		if !ok || !hasEnumValue(t, s) {
+			return nil, fmt.Errorf("Value %s does not exist in %q enum", describe(v), t.Name)
+		}
+
+		return s, nil
+	}
+
+	return t.ParseValue(v)
+}
+
+func appendPath(path []interface{}, elem interface{}) []interface{} {
+	p := make([]interface{}, len(path), len(path)+1)
+	copy(p, path)
+
+	return append(p, elem)
+}
+
+// orderedMap is an object in the response, which keeps its fields in the order
+// they were selected
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,248 @@
+package graphql
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// execute parses, validates and executes the query, returning the result as
+// JSON
+func execute(t *testing.T, s *Schema, query string, variables string) string {
+	doc, err := Parse(query)
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+
+	op, errs := s.Validate(doc, "")
+	if len(errs) > 0 {
+		t.Fatalf("%s: %s", query, errs[0])
+	}
+
+	var vars map[string]interface{}
+	if variables != "" {
+		dec := json.NewDecoder(strings.NewReader(variables))
+		dec.UseNumber()
+		err = dec.Decode(&vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	j, err := json.Marshal(s.Execute(doc, op, vars))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(j)
+}
+
+func TestExecute(t *testing.T) {
+	cases := []struct {
+		query     string
+		variables string
+		expected  string
+	}{
+		{
+			`{ song(id: 1) { id title rating genre tags author { name } } }`, ``,
+			`{"data":{"song":{"id":1,"title":"One","rating":5,"genre":"POP","tags":["a","b"],"author":{"name":"Ann"}}}}`,
+		},
+		{
+			`{ song(id: 2) { rating tags author { name } } missing: song(id: 9) { id } }`, ``,
+			`{"data":{"song":{"rating":null,"tags":null,"author":null},"missing":null}}`,
+		},
+		{
+			`{ first: songs(limit: 1) { id } rock: songs(genre: ROCK) { title, __typename } }`, ``,
+			`{"data":{"first":[{"id":1}],"rock":[{"title":"Two","__typename":"Song"}]}}`,
+		},
+		{
+			`{ song(id: 1) { ...A ... on Song { title } id } } fragment A on Song { id genre }`, ``,
+			`{"data":{"song":{"id":1,"genre":"POP","title":"One"}}}`,
+		},
+		{
+			`{ song(id: 1) { author { name } author { n: name } } }`, ``,
+			`{"data":{"song":{"author":{"name":"Ann","n":"Ann"}}}}`,
+		},
+		{
+			`query ($skip: Boolean!) { song(id: 1) { id @skip(if: $skip) title @include(if: $skip) } }`, `{"skip": true}`,
+			`{"data":{"song":{"title":"One"}}}`,
+		},
+		{
+			`query ($skip: Boolean!) { song(id: 1) { id @skip(if: $skip) title @include(if: $skip) } }`, `{"skip": false}`,
+			`{"data":{"song":{"id":1}}}`,
+		},
+		{
+			`query ($id: Int!) { song(id: $id) { title } }`, `{"id": 2}`,
+			`{"data":{"song":{"title":"Two"}}}`,
+		},
+		{
+			`mutation { createSong(input: {title: "New", genre: ROCK}) { id title rating genre tags } }`, ``,
+			`{"data":{"createSong":{"id":4,"title":"New","rating":3,"genre":"ROCK","tags":null}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		s := testSchema(t)
+		got := execute(t, s, c.query, c.variables)
+		if got != c.expected {
+			t.Errorf("%s:\nexpected %s\ngot      %s", c.query, c.expected, got)
+		}
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{
+			// errors are added at the path of the field, which is null
+			`{ song(id: 1) { title fail } }`,
+			`{"data":{"song":{"title":"One","fail":null}},"errors":[{"message":"The field failed","locations":[{"line":1,"column":23}],"path":["song","fail"]}]}`,
+		},
+		{
+			// a null non-null field makes its parent null
+			`{ song(id: 1) { title required } }`,
+			`{"data":{"song":null},"errors":[{"message":"Cannot return null for non-nullable field required.","locations":[{"line":1,"column":23}],"path":["song","required"]}]}`,
+		},
+		{
+			// nullable list items are null on their own
+			`{ song(id: 1) { repeat(n: 2) { required } } }`,
+			`{"data":{"song":{"repeat":[null,null]}},"errors":[{"message":"Cannot return null for non-nullable field required.","locations":[{"line":1,"column":32}],"path":["song","repeat",0,"required"]},{"message":"Cannot return null for non-nullable field required.","locations":[{"line":1,"column":32}],"path":["song","repeat",1,"required"]}]}`,
+		},
+		{
+			// up to the root, if every field on the way is non-null
+			`{ songs { required } }`,
+			`{"data":null,"errors":[{"message":"Cannot return null for non-nullable field required.","locations":[{"line":1,"column":11}],"path":["songs",0,"required"]}]}`,
+		},
+		{
+			`{ song(id: 3) { genre } }`,
+			`{"data":{"song":{"genre":null}},"errors":[{"message":"Enum \"Genre\" cannot represent value \"JAZZ\"","locations":[{"line":1,"column":17}],"path":["song","genre"]}]}`,
+		},
+		{
+			`{ panic }`,
+			`{"data":{"panic":null},"errors":[{"message":"Internal error resolving panic: unexpected","locations":[{"line":1,"column":3}],"path":["panic"]}]}`,
+		},
+	}
+
+	for _, c := range cases {
+		s := testSchema(t)
+		got := execute(t, s, c.query, "")
+		if got != c.expected {
+			t.Errorf("%s:\nexpected %s\ngot      %s", c.query, c.expected, got)
+		}
+	}
+}
+
+func TestExecuteVariables(t *testing.T) {
+	echo := `query ($in: SongInput, $ids: [Int!], $id: ID) { echo(input: $in, ids: $ids, id: $id) }`
+	required := `query ($in: SongInput!) { echo(input: $in) }`
+	defaults := `query ($limit: Int = 1) { songs(limit: $limit) { id } }`
+
+	cases := []struct {
+		query     string
+		variables string
+		expected  string
+	}{
+		{
+			echo, `{"in": {"title": "x", "rating": 4, "genre": "POP", "tags": ["a"]}, "ids": [1, 2], "id": 7}`,
+			`{"data":{"echo":{"id":"7","ids":[1,2],"input":{"genre":"POP","rating":4,"tags":["a"],"title":"x"}}}}`,
+		},
+		{
+			// input object defaults are used, and single values coerced to lists
+			echo, `{"in": {"title": "x", "tags": "a"}, "ids": 1}`,
+			`{"data":{"echo":{"ids":[1],"input":{"rating":3,"tags":["a"],"title":"x"}}}}`,
+		},
+		{
+			// nullable variables which aren't provided leave the argument out
+			echo, `{}`,
+			`{"data":{"echo":{}}}`,
+		},
+		{
+			echo, `{"in": null, "id": "abc"}`,
+			`{"data":{"echo":{"id":"abc","input":null}}}`,
+		},
+		{defaults, ``, `{"data":{"songs":[{"id":1}]}}`},
+		{defaults, `{"limit": 2}`, `{"data":{"songs":[{"id":1},{"id":2}]}}`},
+		{
+			required, ``,
+			`{"errors":[{"message":"Variable \"$in\" of required type \"SongInput!\" was not provided.","locations":[{"line":1,"column":8}]}]}`,
+		},
+		{
+			required, `{"in": null}`,
+			`{"errors":[{"message":"Variable \"$in\" got invalid value null; Expected non-nullable type \"SongInput!\" not to be null","locations":[{"line":1,"column":8}]}]}`,
+		},
+		{
+			required, `{"in": {"rating": 1}}`,
+			`{"errors":[{"message":"Variable \"$in\" got invalid value {\"rating\":1}; Field \"title\" of required type \"String!\" was not provided","locations":[{"line":1,"column":8}]}]}`,
+		},
+		{
+			required, `{"in": {"title": "x", "album": "y"}}`,
+			`{"errors":[{"message":"Variable \"$in\" got invalid value {\"album\":\"y\",\"title\":\"x\"}; Field \"album\" is not defined by type \"SongInput\"","locations":[{"line":1,"column":8}]}]}`,
+		},
+		{
+			required, `{"in": {"title": 1}}`,
+			`{"errors":[{"message":"Variable \"$in\" got invalid value {\"title\":1}; at \"title\": String cannot represent 1","locations":[{"line":1,"column":8}]}]}`,
+		},
+		{
+			required, `{"in": {"title": "x", "genre": "JAZZ"}}`,
+			`{"errors":[{"message":"Variable \"$in\" got invalid value {\"genre\":\"JAZZ\",\"title\":\"x\"}; at \"genre\": Value \"JAZZ\" does not exist in \"Genre\" enum","locations":[{"line":1,"column":8}]}]}`,
+		},
+		{
+			echo, `{"ids": [1, 2.5]}`,
+			`{"errors":[{"message":"Variable \"$ids\" got invalid value [1,2.5]; at index 1: Int cannot represent 2.5","locations":[{"line":1,"column":24}]}]}`,
+		},
+		{
+			echo, `{"ids": [3000000000]}`,
+			`{"errors":[{"message":"Variable \"$ids\" got invalid value [3000000000]; at index 0: Int cannot represent 3000000000","locations":[{"line":1,"column":24}]}]}`,
+		},
+		{
+			echo, `{"in": "x", "id": true}`,
+			`{"errors":[{"message":"Variable \"$in\" got invalid value \"x\"; Expected type \"SongInput\" to be an object","locations":[{"line":1,"column":8}]},{"message":"Variable \"$id\" got invalid value true; ID cannot represent true","locations":[{"line":1,"column":38}]}]}`,
+		},
+	}
+
+	for _, c := range cases {
+		s := testSchema(t)
+		got := execute(t, s, c.query, c.variables)
+		if got != c.expected {
+			t.Errorf("%s with %s:\nexpected %s\ngot      %s", c.query, c.variables, c.expected, got)
+		}
+	}
+}
+
+func TestExecuteTooComplex(t *testing.T) {
+	s := testSchema(t)
+
+	got := execute(t, s, `{ song(id: 1) { repeat(n: 1000) { repeat(n: 1000) { id } } } }`, "")
+	expected := `{"data":null,"errors":[{"message":"The query selects too many fields"}]}`
+	if got != expected {
+		t.Errorf("Expected %s, got %.200s", expected, got)
+	}
+
+	got = execute(t, s, `{ song(id: 1) { repeat(n: 2) { repeat(n: 2) { id } } } }`, "")
+	expected = `{"data":{"song":{"repeat":[{"repeat":[{"id":1},{"id":1}]},{"repeat":[{"id":1},{"id":1}]}]}}}`
+	if got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestExecuteIntrospection(t *testing.T) {
+	s := testSchema(t)
+
+	got := execute(t, s, `{
+		__schema { queryType { name } mutationType { name } }
+		__type(name: "Genre") { kind name enumValues { name } }
+		song: __type(name: "Song") { fields { name type { kind ofType { name } } } }
+	}`, "")
+
+	for _, part := range []string{
+		`"__schema":{"queryType":{"name":"Query"},"mutationType":{"name":"Mutation"}}`,
+		`"__type":{"kind":"ENUM","name":"Genre","enumValues":[{"name":"POP"},{"name":"ROCK"}]}`,
+		`{"name":"id","type":{"kind":"NON_NULL","ofType":{"name":"Int"}}}`,
+	} {
+		if !strings.Contains(got, part) {
+			t.Errorf("Expected the result to contain %s, got %s", part, got)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package graphql
+
+import "sort"
+
+// The introspection types describe a Schema to clients querying its __schema
+// and __type fields, so tools can discover the types and fields they can query
+var (
+	schemaType     = &Type{Kind: Object, Name: "__Schema"}
+	typeType       = &Type{Kind: Object, Name: "__Type"}
+	fieldType      = &Type{Kind: Object, Name: "__Field"}
+	inputValueType = &Type{Kind: Object, Name: "__InputValue"}
+	enumValueType  = &Type{Kind: Object, Name: "__EnumValue"}
+	directiveType  = &Type{Kind: Object, Name: "__Directive"}
+
+	typeKindType = &Type{
+		Kind:       Enum,
+		Name:       "__TypeKind",
+		EnumValues: []string{"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"},
+	}
+
+	directiveLocationType = &Type{
+		Kind: Enum,
+		Name: "__DirectiveLocation",
+		EnumValues: []string{
+			"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION",
+			"FRAGMENT_SPREAD", "INLINE_FRAGMENT", "VARIABLE_DEFINITION", "SCHEMA",
+			"SCALAR", "OBJECT", "FIELD_DEFINITION", "ARGUMENT_DEFINITION", "INTERFACE",
+			"UNION", "ENUM", "ENUM_VALUE", "INPUT_OBJECT", "INPUT_FIELD_DEFINITION",
+		},
+	}
+)
+
+// directive is a directive which can be used in queries
+type directive struct {
+	Name        string
+	Description string
+	Locations   []string
+	Args        []*InputValue
+}
+
+var directives = []*directive{
+	{
+		Name:        "skip",
+		Description: "Skips the field or fragment when the if argument is true",
+		Locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+		Args:        []*InputValue{{Name: "if", Type: NewNonNull(Boolean)}},
+	},
+	{
+		Name:        "include",
+		Description: "Includes the field or fragment only when the if argument is true",
+		Locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+		Args:        []*InputValue{{Name: "if", Type: NewNonNull(Boolean)}},
+	},
+}
+
+// schemaField and typeField are the fields added to the query type to
+// introspect the schema. Their source is the Schema being queried.
+var (
+	schemaField = &FieldDef{
+		Name:        "__schema",
+		Description: "Describes the schema",
+		Type:        NewNonNull(schemaType),
+		Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source, nil
+		},
+	}
+
+	typeField = &FieldDef{
+		Name:        "__type",
+		Description: "Describes the type with the name, if there is one",
+		Type:        typeType,
+		Args:        []*InputValue{{Name: "name", Type: NewNonNull(String)}},
+		Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+			t, ok := source.(*Schema).Types[args["name"].(string)]
+			if !ok {
+				return nil, nil
+			}
+
+			return t, nil
+		},
+	}
+)
+
+// enumValue is the source of __EnumValue fields
+type enumValue string
+
+// resolve returns a ResolveFunc calling f with the source, for fields without
+// arguments
+func resolve(f func(source interface{}) interface{}) ResolveFunc {
+	return func(source interface{}, args map[string]interface{}) (interface{}, error) {
+		return f(source), nil
+	}
+}
+
+// optional returns nil for the empty string, so it is null in responses
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+
+	return s
+}
+
+func deprecation() []*FieldDef {
+	return []*FieldDef{
+		{
+			Name:    "isDeprecated",
+			Type:    NewNonNull(Boolean),
+			Resolve: resolve(func(interface{}) interface{} { return false }),
+		},
+		{
+			Name:    "deprecationReason",
+			Type:    String,
+			Resolve: resolve(func(interface{}) interface{} { return nil }),
+		},
+	}
+}
+
+func includeDeprecated() []*InputValue {
+	return []*InputValue{{Name: "includeDeprecated", Type: Boolean, Default: false}}
+}
+
+func init() {
+	nonNullType := NewNonNull(typeType)
+
+	schemaType.Fields = []*FieldDef{
+		{
+			Name:    "description",
+			Type:    String,
+			Resolve: resolve(func(interface{}) interface{} { return nil }),
+		},
+		{
+			Name: "types",
+			Type: NewNonNull(NewList(nonNullType)),
+			Resolve: resolve(func(source interface{}) interface{} {
+				s := source.(*Schema)
+				types := make([]*Type, 0, len(s.Types))
+				for _, t := range s.Types {
+					types = append(types, t)
+				}
+				sort.Slice(types, func(i, j int) bool {
+					return types[i].Name < types[j].Name
+				})
+				return types
+			}),
+		},
+		{
+			Name:    "queryType",
+			Type:    nonNullType,
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*Schema).Query }),
+		},
+		{
+			Name:    "mutationType",
+			Type:    typeType,
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*Schema).Mutation }),
+		},
+		{
+			Name:    "subscriptionType",
+			Type:    typeType,
+			Resolve: resolve(func(interface{}) interface{} { return nil }),
+		},
+		{
+			Name:    "directives",
+			Type:    NewNonNull(NewList(NewNonNull(directiveType))),
+			Resolve: resolve(func(interface{}) interface{} { return directives }),
+		},
+	}
+
+	typeType.Fields = []*FieldDef{
+		{
+			Name:    "kind",
+			Type:    NewNonNull(typeKindType),
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*Type).Kind.String() }),
+		},
+		{
+			Name:    "name",
+			Type:    String,
+			Resolve: resolve(func(source interface{}) interface{} { return optional(source.(*Type).Name) }),
+		},
+		{
+			Name:    "description",
+			Type:    String,
+			Resolve: resolve(func(source interface{}) interface{} { return optional(source.(*Type).Description) }),
+		},
+		{
+			Name:    "specifiedByURL",
+			Type:    String,
+			Resolve: resolve(func(interface{}) interface{} { return nil }),
+		},
+		{
+			Name: "fields",
+			Type: NewList(NewNonNull(fieldType)),
+			Args: includeDeprecated(),
+			Resolve: resolve(func(source interface{}) interface{} {
+				t := source.(*Type)
+				if t.Kind != Object {
+					return nil
+				}
+				return t.Fields
+			}),
+		},
+		{
+			Name: "interfaces",
+			Type: NewList(nonNullType),
+			Resolve: resolve(func(source interface{}) interface{} {
+				if source.(*Type).Kind != Object {
+					return nil
+				}
+				return []*Type{}
+			}),
+		},
+		{
+			Name:    "possibleTypes",
+			Type:    NewList(nonNullType),
+			Resolve: resolve(func(interface{}) interface{} { return nil }),
+		},
+		{
+			Name: "enumValues",
+			Type: NewList(NewNonNull(enumValueType)),
+			Args: includeDeprecated(),
+			Resolve: resolve(func(source interface{}) interface{} {
+				t := source.(*Type)
+				if t.Kind != Enum {
+					return nil
+				}
+
+				values := make([]enumValue, 0, len(t.EnumValues))
+				for _, v := range t.EnumValues {
+					values = append(values, enumValue(v))
+				}
+				return values
+			}),
+		},
+		{
+			Name: "inputFields",
+			Type: NewList(NewNonNull(inputValueType)),
+			Args: includeDeprecated(),
+			Resolve: resolve(func(source interface{}) interface{} {
+				t := source.(*Type)
+				if t.Kind != InputObject {
+					return nil
+				}
+				return t.InputFields
+			}),
+		},
+		{
+			Name:    "ofType",
+			Type:    typeType,
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*Type).OfType }),
+		},
+	}
+
+	fieldType.Fields = append([]*FieldDef{
+		{
+			Name:    "name",
+			Type:    NewNonNull(String),
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*FieldDef).Name }),
+		},
+		{
+			Name:    "description",
+			Type:    String,
+			Resolve: resolve(func(source interface{}) interface{} { return optional(source.(*FieldDef).Description) }),
+		},
+		{
+			Name:    "args",
+			Type:    NewNonNull(NewList(NewNonNull(inputValueType))),
+			Args:    includeDeprecated(),
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*FieldDef).Args }),
+		},
+		{
+			Name:    "type",
+			Type:    nonNullType,
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*FieldDef).Type }),
+		},
+	}, deprecation()...)
+
+	inputValueType.Fields = append([]*FieldDef{
+		{
+			Name:    "name",
+			Type:    NewNonNull(String),
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*InputValue).Name }),
+		},
+		{
+			Name:    "description",
+			Type:    String,
+			Resolve: resolve(func(source interface{}) interface{} { return optional(source.(*InputValue).Description) }),
+		},
+		{
+			Name:    "type",
+			Type:    nonNullType,
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*InputValue).Type }),
+		},
+		{
+			Name: "defaultValue",
+			Type: String,
+			Resolve: resolve(func(source interface{}) interface{} {
+				v := source.(*InputValue)
+				if v.Default == nil {
+					return nil
+				}
+				return formatValue(v.Type, v.Default)
+			}),
+		},
+	}, deprecation()...)
+
+	enumValueType.Fields = append([]*FieldDef{
+		{
+			Name:    "name",
+			Type:    NewNonNull(String),
+			Resolve: resolve(func(source interface{}) interface{} { return string(source.(enumValue)) }),
+		},
+		{
+			Name:    "description",
+			Type:    String,
+			Resolve: resolve(func(interface{}) interface{} { return nil }),
+		},
+	}, deprecation()...)
+
+	directiveType.Fields = []*FieldDef{
+		{
+			Name:    "name",
+			Type:    NewNonNull(String),
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*directive).Name }),
+		},
+		{
+			Name:    "description",
+			Type:    String,
+			Resolve: resolve(func(source interface{}) interface{} { return optional(source.(*directive).Description) }),
+		},
+		{
+			Name:    "locations",
+			Type:    NewNonNull(NewList(NewNonNull(directiveLocationType))),
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*directive).Locations }),
+		},
+		{
+			Name:    "args",
+			Type:    NewNonNull(NewList(NewNonNull(inputValueType))),
+			Args:    includeDeprecated(),
+			Resolve: resolve(func(source interface{}) interface{} { return source.(*directive).Args }),
+		},
+		{
+			Name:    "isRepeatable",
+			Type:    NewNonNull(Boolean),
+			Resolve: resolve(func(interface{}) interface{} { return false }),
+		},
+	}
+}
@@ -0,0 +1,655 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDepth limits the nesting of selection sets, lists and objects, so a query
+// can't exhaust the stack
+const maxDepth = 64
+
+type tokenKind int
+
+const (
+	eof tokenKind = iota
+	punct
+	name
+	intToken
+	floatToken
+	stringToken
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	Location
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case eof:
+		return "<EOF>"
+	case stringToken:
+		return strconv.Quote(t.value)
+	}
+
+	return t.value
+}
+
+type parser struct {
+	src   string
+	pos   int
+	line  int
+	col   int
+	tok   token
+	depth int
+}
+
+// Parse parses the GraphQL query document src
+func Parse(src string) (doc *Document, err error) {
+	p := &parser{src: src, line: 1, col: 1}
+
+	// errors are raised as panics within the parser, to unwind from any depth
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+
+			doc, err = nil, e
+		}
+	}()
+
+	p.next()
+	doc = &Document{Fragments: make(map[string]*Fragment)}
+	for p.tok.kind != eof {
+		if p.tok.kind == name && p.tok.value == "fragment" {
+			f := p.parseFragment()
+			if _, ok := doc.Fragments[f.Name]; ok {
+				p.errorAt(f.Location, "There can be only one fragment named %q", f.Name)
+			}
+
+			doc.Fragments[f.Name] = f
+			continue
+		}
+
+		doc.Operations = append(doc.Operations, p.parseOperation())
+	}
+
+	if len(doc.Operations) == 0 {
+		p.errorAt(p.tok.Location, "The document has no operations")
+	}
+
+	return doc, nil
+}
+
+func (p *parser) errorAt(loc Location, format string, args ...interface{}) {
+	panic(&Error{Message: fmt.Sprintf(format, args...), Location: loc})
+}
+
+// expect consumes the punctuator s, or fails
+func (p *parser) expect(s string) token {
+	t := p.tok
+	if t.kind != punct || t.value != s {
+		p.errorAt(t.Location, "Expected %q, found %s", s, t)
+	}
+
+	p.next()
+	return t
+}
+
+// skip consumes the punctuator s if it is next, reporting whether it was
+func (p *parser) skip(s string) bool {
+	if p.tok.kind == punct && p.tok.value == s {
+		p.next()
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) peek(s string) bool {
+	return p.tok.kind == punct && p.tok.value == s
+}
+
+func (p *parser) parseName() string {
+	t := p.tok
+	if t.kind != name {
+		p.errorAt(t.Location, "Expected a name, found %s", t)
+	}
+
+	p.next()
+	return t.value
+}
+
+func (p *parser) enter(loc Location) {
+	p.depth++
+	if p.depth > maxDepth {
+		p.errorAt(loc, "The document is nested more than %d levels deep", maxDepth)
+	}
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) parseOperation() *Operation {
+	op := &Operation{Type: "query", Location: p.tok.Location}
+
+	// a lone selection set is shorthand for a query
+	if p.peek("{") {
+		op.Selections = p.parseSelectionSet()
+		return op
+	}
+
+	if p.tok.kind != name {
+		p.errorAt(p.tok.Location, "Expected an operation, found %s", p.tok)
+	}
+
+	op.Type = p.parseName()
+	switch op.Type {
+	case "query", "mutation", "subscription":
+	default:
+		p.errorAt(op.Location, "Unknown operation type %q", op.Type)
+	}
+
+	if p.tok.kind == name {
+		op.Name = p.parseName()
+	}
+
+	if p.skip("(") {
+		for !p.skip(")") {
+			v := &VariableDefinition{Location: p.tok.Location}
+			p.expect("$")
+			v.Name = p.parseName()
+			p.expect(":")
+			v.Type = p.parseType()
+
+			if p.skip("=") {
+				v.Default = p.parseValue(true)
+			}
+
+			op.Variables = append(op.Variables, v)
+		}
+	}
+
+	op.Directives = p.parseDirectives()
+	op.Selections = p.parseSelectionSet()
+
+	return op
+}
+
+func (p *parser) parseFragment() *Fragment {
+	f := &Fragment{Location: p.tok.Location}
+	p.next() // fragment
+
+	f.Name = p.parseName()
+	if f.Name == "on" {
+		p.errorAt(f.Location, "A fragment can't be named \"on\"")
+	}
+
+	if p.parseName() != "on" {
+		p.errorAt(f.Location, "Expected \"on\" after the fragment name")
+	}
+
+	f.TypeCondition = p.parseName()
+	f.Directives = p.parseDirectives()
+	f.Selections = p.parseSelectionSet()
+
+	return f
+}
+
+func (p *parser) parseSelectionSet() []*Selection {
+	loc := p.expect("{").Location
+	p.enter(loc)
+	defer p.leave()
+
+	var sels []*Selection
+	for !p.skip("}") {
+		sels = append(sels, p.parseSelection())
+	}
+
+	if len(sels) == 0 {
+		p.errorAt(loc, "A selection set must select at least one field")
+	}
+
+	return sels
+}
+
+func (p *parser) parseSelection() *Selection {
+	sel := &Selection{Location: p.tok.Location}
+
+	if p.skip("...") {
+		if p.tok.kind == name && p.tok.value != "on" {
+			sel.Fragment = p.parseName()
+			sel.Directives = p.parseDirectives()
+			return sel
+		}
+
+		if p.tok.kind == name && p.tok.value == "on" {
+			p.next()
+			sel.TypeCondition = p.parseName()
+		}
+
+		sel.Directives = p.parseDirectives()
+		sel.Selections = p.parseSelectionSet()
+		return sel
+	}
+
+	f := &Field{Location: p.tok.Location}
+	f.Name = p.parseName()
+	if p.skip(":") {
+		f.Alias = f.Name
+		f.Name = p.parseName()
+	}
+
+	f.Arguments = p.parseArguments(false)
+	sel.Directives = p.parseDirectives()
+
+	if p.peek("{") {
+		f.Selections = p.parseSelectionSet()
+	}
+
+	sel.Field = f
+	return sel
+}
+
+func (p *parser) parseArguments(constant bool) []*Argument {
+	if !p.skip("(") {
+		return nil
+	}
+
+	var args []*Argument
+	for !p.skip(")") {
+		a := &Argument{Location: p.tok.Location}
+		a.Name = p.parseName()
+		p.expect(":")
+		a.Value = p.parseValue(constant)
+
+		args = append(args, a)
+	}
+
+	return args
+}
+
+func (p *parser) parseDirectives() []*Directive {
+	var dirs []*Directive
+	for p.peek("@") {
+		d := &Directive{Location: p.tok.Location}
+		p.next()
+		d.Name = p.parseName()
+		d.Arguments = p.parseArguments(false)
+
+		dirs = append(dirs, d)
+	}
+
+	return dirs
+}
+
+func (p *parser) parseType() *TypeRef {
+	t := &TypeRef{}
+	if p.peek("[") {
+		loc := p.expect("[").Location
+		p.enter(loc)
+		t.Elem = p.parseType()
+		p.leave()
+		p.expect("]")
+	} else {
+		t.Name = p.parseName()
+	}
+
+	t.NonNull = p.skip("!")
+
+	return t
+}
+
+// parseValue parses a value, which can't be a variable if constant
+func (p *parser) parseValue(constant bool) *Value {
+	t := p.tok
+	v := &Value{Location: t.Location, Raw: t.value}
+
+	switch t.kind {
+	case intToken:
+		v.Kind = IntValue
+		p.next()
+
+	case floatToken:
+		v.Kind = FloatValue
+		p.next()
+
+	case stringToken:
+		v.Kind = StringValue
+		p.next()
+
+	case name:
+		switch t.value {
+		case "true", "false":
+			v.Kind = BooleanValue
+		case "null":
+			v.Kind = NullValue
+		default:
+			v.Kind = EnumValue
+		}
+		p.next()
+
+	case punct:
+		switch t.value {
+		case "$":
+			if constant {
+				p.errorAt(t.Location, "Unexpected variable in a constant value")
+			}
+
+			p.next()
+			v.Kind = Variable
+			v.Raw = p.parseName()
+
+		case "[":
+			p.next()
+			p.enter(t.Location)
+			v.Kind = ListValue
+			for !p.skip("]") {
+				v.List = append(v.List, p.parseValue(constant))
+			}
+			p.leave()
+
+		case "{":
+			p.next()
+			p.enter(t.Location)
+			v.Kind = ObjectValue
+			for !p.skip("}") {
+				f := &Argument{Location: p.tok.Location}
+				f.Name = p.parseName()
+				p.expect(":")
+				f.Value = p.parseValue(constant)
+
+				v.Fields = append(v.Fields, f)
+			}
+			p.leave()
+
+		default:
+			p.errorAt(t.Location, "Unexpected %s", t)
+		}
+
+	default:
+		p.errorAt(t.Location, "Unexpected %s", t)
+	}
+
+	return v
+}
+
+// next reads the next token from the source into p.tok
+func (p *parser) next() {
+	p.skipIgnored()
+
+	loc := Location{Line: p.line, Column: p.col}
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: eof, Location: loc}
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c == '.':
+		if !strings.HasPrefix(p.src[p.pos:], "...") {
+			p.errorAt(loc, "Unexpected \".\", did you mean \"...\"?")
+		}
+
+		p.advance(3)
+		p.tok = token{kind: punct, value: "...", Location: loc}
+
+	case strings.IndexByte("!$&()/:=@[]{|}", c) >= 0:
+		p.advance(1)
+		p.tok = token{kind: punct, value: string(c), Location: loc}
+
+	case c == '_' || isLetter(c):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.advance(1)
+		}
+
+		p.tok = token{kind: name, value: p.src[start:p.pos], Location: loc}
+
+	case c == '-' || isDigit(c):
+		p.tok = p.readNumber(loc)
+
+	case c == '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			p.tok = p.readBlockString(loc)
+		} else {
+			p.tok = p.readString(loc)
+		}
+
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.errorAt(loc, "Unexpected character %q", r)
+	}
+}
+
+// skipIgnored skips whitespace, commas and comments
+func (p *parser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '\n':
+			p.pos++
+			p.line++
+			p.col = 1
+
+		case c == '\r':
+			p.pos++
+			if p.pos < len(p.src) && p.src[p.pos] == '\n' {
+				p.pos++
+			}
+			p.line++
+			p.col = 1
+
+		case c == ' ' || c == '\t' || c == ',':
+			p.advance(1)
+
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.advance(1)
+			}
+
+		case strings.HasPrefix(p.src[p.pos:], "\uFEFF"):
+			p.pos += len("\uFEFF")
+
+		default:
+			return
+		}
+	}
+}
+
+// advance moves n bytes forward on the current line
+func (p *parser) advance(n int) {
+	p.pos += n
+	p.col += n
+}
+
+func (p *parser) readNumber(loc Location) token {
+	start := p.pos
+	kind := intToken
+
+	if p.src[p.pos] == '-' {
+		p.advance(1)
+	}
+
+	digits := func() {
+		if p.pos >= len(p.src) || !isDigit(p.src[p.pos]) {
+			p.errorAt(Location{Line: p.line, Column: p.col}, "Invalid number, expected a digit")
+		}
+
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.advance(1)
+		}
+	}
+
+	if p.pos < len(p.src) && p.src[p.pos] == '0' {
+		p.advance(1)
+		if p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.errorAt(loc, "Invalid number, unexpected digit after 0")
+		}
+	} else {
+		digits()
+	}
+
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		kind = floatToken
+		p.advance(1)
+		digits()
+	}
+
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		kind = floatToken
+		p.advance(1)
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.advance(1)
+		}
+		digits()
+	}
+
+	if p.pos < len(p.src) && (p.src[p.pos] == '_' || p.src[p.pos] == '.' || isLetter(p.src[p.pos])) {
+		p.errorAt(Location{Line: p.line, Column: p.col}, "Invalid number, unexpected %q", p.src[p.pos])
+	}
+
+	return token{kind: kind, value: p.src[start:p.pos], Location: loc}
+}
+
+func (p *parser) readString(loc Location) token {
+	p.advance(1) // opening quote
+
+	var b []byte
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			p.errorAt(loc, "Unterminated string")
+		}
+
+		c := p.src[p.pos]
+		if c == '"' {
+			p.advance(1)
+			return token{kind: stringToken, value: string(b), Location: loc}
+		}
+
+		if c != '\\' {
+			_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			b = append(b, p.src[p.pos:p.pos+size]...)
+			p.advance(size)
+			continue
+		}
+
+		esc := Location{Line: p.line, Column: p.col}
+		if p.pos+1 >= len(p.src) {
+			p.errorAt(loc, "Unterminated string")
+		}
+
+		switch e := p.src[p.pos+1]; e {
+		case '"', '\\', '/':
+			b = append(b, e)
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'u':
+			if p.pos+6 > len(p.src) {
+				p.errorAt(esc, "Invalid unicode escape sequence")
+			}
+
+			r, err := strconv.ParseUint(p.src[p.pos+2:p.pos+6], 16, 32)
+			if err != nil {
+				p.errorAt(esc, "Invalid unicode escape sequence")
+			}
+
+			b = append(b, string(rune(r))...)
+			p.advance(4)
+		default:
+			p.errorAt(esc, "Invalid escape sequence \\%c", e)
+		}
+
+		p.advance(2)
+	}
+}
+
+func (p *parser) readBlockString(loc Location) token {
+	p.advance(3) // opening quotes
+
+	var raw []byte
+	for {
+		if p.pos >= len(p.src) {
+			p.errorAt(loc, "Unterminated block string")
+		}
+
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], `"""`):
+			p.advance(3)
+			return token{kind: stringToken, value: blockStringValue(string(raw)), Location: loc}
+
+		case strings.HasPrefix(p.src[p.pos:], `\"""`):
+			raw = append(raw, `"""`...)
+			p.advance(4)
+
+		case p.src[p.pos] == '\n' || p.src[p.pos] == '\r':
+			raw = append(raw, '\n')
+			if p.src[p.pos] == '\r' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '\n' {
+				p.pos++
+			}
+			p.pos++
+			p.line++
+			p.col = 1
+
+		default:
+			raw = append(raw, p.src[p.pos])
+			p.advance(1)
+		}
+	}
+}
+
+// blockStringValue removes the common indentation of a block string's lines,
+// and its leading and trailing blank lines
+func blockStringValue(raw string) string {
+	lines := strings.Split(raw, "\n")
+
+	common := -1
+	for _, line := range lines[1:] {
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < len(line) && (common == -1 || indent < common) {
+			common = indent
+		}
+	}
+
+	if common > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= common {
+				lines[i] = lines[i][common:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
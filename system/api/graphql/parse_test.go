@@ -0,0 +1,169 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# operations may be named, with variables and defaults
+		query Songs($genre: Genre = POP, $ids: [Int!]!) {
+			first: songs(genre: $genre, limit: 1) { ...SongFields }
+			songs(ids: $ids, filter: {title: "a\"bé", tags: ["x", "y"]}) @include(if: true) {
+				... on Song { id }
+			}
+		}
+
+		fragment SongFields on Song { id, title }
+
+		mutation { createSong(input: {title: """
+			Block
+			  string
+		"""}) { id } }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Operations) != 2 || doc.Fragments["SongFields"] == nil {
+		t.Fatalf("Expected 2 operations and a fragment, got %d and %v", len(doc.Operations), doc.Fragments)
+	}
+
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "Songs" || len(op.Variables) != 2 {
+		t.Fatalf("Unexpected operation %s %q with %d variables", op.Type, op.Name, len(op.Variables))
+	}
+
+	if got := op.Variables[1].Type.String(); got != "[Int!]!" {
+		t.Errorf("Expected variable type [Int!]!, got %s", got)
+	}
+
+	if got := op.Variables[0].Default; got == nil || got.Kind != EnumValue || got.Raw != "POP" {
+		t.Errorf("Expected enum default POP, got %+v", got)
+	}
+
+	first := op.Selections[0].Field
+	if first.Key() != "first" || first.Name != "songs" || len(first.Arguments) != 2 {
+		t.Errorf("Unexpected aliased field %+v", first)
+	}
+
+	filter := op.Selections[1].Field.Argument("filter").Value.Interface(nil)
+	expected := map[string]interface{}{"title": "a\"bé", "tags": []interface{}{"x", "y"}}
+	if describe(filter) != describe(expected) {
+		t.Errorf("Expected filter %s, got %s", describe(expected), describe(filter))
+	}
+
+	if sel := op.Selections[1].Field.Selections[0]; sel.TypeCondition != "Song" || len(sel.Selections) != 1 {
+		t.Errorf("Expected an inline fragment on Song, got %+v", sel)
+	}
+
+	mutation := doc.Operations[1]
+	title := mutation.Selections[0].Field.Argument("input").Value.Fields[0].Value.Raw
+	if mutation.Type != "mutation" || title != "Block\n  string" {
+		t.Errorf("Unexpected mutation %s with title %q", mutation.Type, title)
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected interface{}
+	}{
+		{`1`, int64(1)},
+		{`-0`, int64(0)},
+		{`1.5e3`, 1500.0},
+		{`true`, true},
+		{`null`, nil},
+		{`"\t\\\/"`, "\t\\/"},
+		{`RED`, "RED"},
+		{`[1, [2]]`, []interface{}{int64(1), []interface{}{int64(2)}}},
+		{`{a: {b: "c"}}`, map[string]interface{}{"a": map[string]interface{}{"b": "c"}}},
+		{`$v`, "from variable"},
+	}
+
+	vars := map[string]interface{}{"v": "from variable"}
+	for _, c := range cases {
+		doc, err := Parse(`{ f(a: ` + c.value + `) }`)
+		if err != nil {
+			t.Errorf("%s: %s", c.value, err)
+			continue
+		}
+
+		got := doc.Operations[0].Selections[0].Field.Argument("a").Value.Interface(vars)
+		if describe(got) != describe(c.expected) {
+			t.Errorf("%s: expected %s, got %s", c.value, describe(c.expected), describe(got))
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		query   string
+		message string
+		line    int
+		column  int
+	}{
+		{``, `The document has no operations`, 1, 1},
+		{`{`, `Expected a name, found <EOF>`, 1, 2},
+		{`{}`, `A selection set must select at least one field`, 1, 1},
+		{"{\n  a(b: )\n}", `Unexpected )`, 2, 8},
+		{`{ a } }`, `Expected an operation, found }`, 1, 7},
+		{`subscribe { a }`, `Unknown operation type "subscribe"`, 1, 1},
+		{`query ($a: Int = $b) { a }`, `Unexpected variable in a constant value`, 1, 18},
+		{`{ a(s: "abc) }`, `Unterminated string`, 1, 8},
+		{`{ a(s: "\q") }`, `Invalid escape sequence \q`, 1, 9},
+		{`{ a(s: "\u00zz") }`, `Invalid unicode escape sequence`, 1, 9},
+		{`{ a(s: """abc) }`, `Unterminated block string`, 1, 8},
+		{`{ a(n: 01) }`, `Invalid number, unexpected digit after 0`, 1, 8},
+		{`{ a(n: 1.) }`, `Invalid number, expected a digit`, 1, 10},
+		{`{ a(n: 1a) }`, `Invalid number, unexpected 'a'`, 1, 9},
+		{`{ a . b }`, `Unexpected ".", did you mean "..."?`, 1, 5},
+		{`{ a ? }`, `Unexpected character '?'`, 1, 5},
+		{`fragment on on Song { a } { a }`, `A fragment can't be named "on"`, 1, 1},
+		{`fragment F Song { a } { a }`, `Expected "on" after the fragment name`, 1, 1},
+		{`fragment F on Song { a } fragment F on Song { b } { ...F }`, `There can be only one fragment named "F"`, 1, 26},
+	}
+
+	for _, c := range cases {
+		_, err := Parse(c.query)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%q: expected a syntax error, got %v", c.query, err)
+			continue
+		}
+
+		if e.Message != c.message || e.Line != c.line || e.Column != c.column {
+			t.Errorf("%q: expected %q at %d:%d, got %q at %d:%d", c.query, c.message, c.line, c.column, e.Message, e.Line, e.Column)
+		}
+	}
+}
+
+func TestParseDepth(t *testing.T) {
+	nested := func(open, close string, n int) string {
+		return strings.Repeat(open, n) + strings.Repeat(close, n)
+	}
+
+	cases := []struct {
+		query string
+		ok    bool
+	}{
+		{nested("{ a ", "}", maxDepth), true},
+		{nested("{ a ", "}", maxDepth+1), false},
+		{`{ a(v: ` + nested("[", "]", maxDepth-1) + `) }`, true},
+		{`{ a(v: ` + nested("[", "]", maxDepth) + `) }`, false},
+		{`{ a(v: ` + nested("{a: ", "}", maxDepth) + `) }`, false},
+		{`query ($v: ` + nested("[", "]", maxDepth+1) + `Int) { a }`, false},
+	}
+
+	for i, c := range cases {
+		_, err := Parse(c.query)
+		if c.ok && err != nil {
+			t.Errorf("%d: expected no error, got %s", i, err)
+		}
+
+		if !c.ok && (err == nil || !strings.Contains(err.Error(), "nested more than")) {
+			t.Errorf("%d: expected the document to be too deep, got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of a Type
+type Kind int
+
+// The kinds of Type. Interfaces and unions are not supported.
+const (
+	Scalar Kind = iota
+	Object
+	Enum
+	InputObject
+	List
+	NonNull
+)
+
+var kindNames = []string{"SCALAR", "OBJECT", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Type is a type within a Schema. Named types have a Name, and lists and
+// non-null types wrap the type in OfType.
+type Type struct {
+	Kind        Kind
+	Name        string
+	Description string
+	OfType      *Type
+
+	// Fields are the fields of an Object, and InputFields of an InputObject
+	Fields      []*FieldDef
+	InputFields []*InputValue
+
+	// EnumValues are the values of an Enum
+	EnumValues []string
+
+	// Serialize converts a resolved value to the JSON value of a Scalar, and
+	// ParseValue converts an input value to a Scalar. Input values are decoded
+	// from JSON with json.Number, or from literals with ints as int64 and floats
+	// as float64.
+	Serialize  func(v interface{}) (interface{}, error)
+	ParseValue func(v interface{}) (interface{}, error)
+}
+
+// NewList returns a list of t
+func NewList(t *Type) *Type {
+	return &Type{Kind: List, OfType: t}
+}
+
+// NewNonNull returns a non-null t
+func NewNonNull(t *Type) *Type {
+	return &Type{Kind: NonNull, OfType: t}
+}
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case List:
+		return "[" + t.OfType.String() + "]"
+	case NonNull:
+		return t.OfType.String() + "!"
+	}
+
+	return t.Name
+}
+
+// Field returns the field of an Object with the name, or nil
+func (t *Type) Field(name string) *FieldDef {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// named returns the named type wrapped by any lists or non-null types
+func (t *Type) named() *Type {
+	for t.OfType != nil {
+		t = t.OfType
+	}
+
+	return t
+}
+
+func (t *Type) isLeaf() bool {
+	k := t.named().Kind
+	return k == Scalar || k == Enum
+}
+
+func (t *Type) isInput() bool {
+	k := t.named().Kind
+	return k == Scalar || k == Enum || k == InputObject
+}
+
+// ResolveFunc returns the value of a field of the source object, from the
+// field's arguments
+type ResolveFunc func(source interface{}, args map[string]interface{}) (interface{}, error)
+
+// FieldDef is a field of an Object. Without a Resolve func, the field's value is
+// the value of the same key when the source is a map[string]interface{}.
+type FieldDef struct {
+	Name        string
+	Description string
+	Type        *Type
+	Args        []*InputValue
+	Resolve     ResolveFunc
+}
+
+// InputValue is an argument of a field, or a field of an InputObject. Default
+// is the value used when none is given, if it isn't nil.
+type InputValue struct {
+	Name        string
+	Description string
+	Type        *Type
+	Default     interface{}
+}
+
+// Schema holds the types which can be queried, starting from Query, and changed,
+// starting from Mutation
+type Schema struct {
+	Query    *Type
+	Mutation *Type
+	Types    map[string]*Type
+}
+
+// NewSchema returns a Schema with the types reachable from the query and
+// mutation types, which may be nil. Each type must have a distinct name.
+func NewSchema(query, mutation *Type) (*Schema, error) {
+	s := &Schema{
+		Query:    query,
+		Mutation: mutation,
+		Types:    make(map[string]*Type),
+	}
+
+	roots := []*Type{query, String, Boolean, schemaType}
+	if mutation != nil {
+		roots = append(roots, mutation)
+	}
+
+	for _, t := range roots {
+		err := s.add(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Schema) add(t *Type) error {
+	t = t.named()
+	if t.Name == "" {
+		return fmt.Errorf("A %s type has no name", t.Kind)
+	}
+
+	if other, ok := s.Types[t.Name]; ok {
+		if other != t {
+			return fmt.Errorf("There is more than one type named %q", t.Name)
+		}
+
+		return nil
+	}
+
+	s.Types[t.Name] = t
+	for _, f := range t.Fields {
+		err := s.add(f.Type)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range f.Args {
+			err = s.add(a.Type)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, f := range t.InputFields {
+		err := s.add(f.Type)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// typeOf returns the schema type referred to by ref, or nil if it is unknown
+func (s *Schema) typeOf(ref *TypeRef) *Type {
+	var t *Type
+	if ref.Elem != nil {
+		elem := s.typeOf(ref.Elem)
+		if elem == nil {
+			return nil
+		}
+
+		t = NewList(elem)
+	} else {
+		t = s.Types[ref.Name]
+		if t == nil {
+			return nil
+		}
+	}
+
+	if ref.NonNull {
+		t = NewNonNull(t)
+	}
+
+	return t
+}
+
+// String returns the schema in the GraphQL schema definition language
+func (s *Schema) String() string {
+	var names []string
+	for name, t := range s.Types {
+		if strings.HasPrefix(name, "__") || (t.Kind == Scalar && specifiedScalars[name]) {
+			continue
+		}
+
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		t := s.Types[name]
+		writeDescription(buf, t.Description, "")
+
+		switch t.Kind {
+		case Scalar:
+			fmt.Fprintf(buf, "scalar %s\n", name)
+
+		case Enum:
+			fmt.Fprintf(buf, "enum %s {\n", name)
+			for _, v := range t.EnumValues {
+				fmt.Fprintf(buf, "  %s\n", v)
+			}
+			buf.WriteString("}\n")
+
+		case InputObject:
+			fmt.Fprintf(buf, "input %s {\n", name)
+			for _, f := range t.InputFields {
+				writeDescription(buf, f.Description, "  ")
+				fmt.Fprintf(buf, "  %s\n", formatInputValue(f))
+			}
+			buf.WriteString("}\n")
+
+		case Object:
+			fmt.Fprintf(buf, "type %s {\n", name)
+			for _, f := range t.Fields {
+				writeDescription(buf, f.Description, "  ")
+				fmt.Fprintf(buf, "  %s", f.Name)
+
+				if len(f.Args) > 0 {
+					args := make([]string, 0, len(f.Args))
+					for _, a := range f.Args {
+						args = append(args, formatInputValue(a))
+					}
+					fmt.Fprintf(buf, "(%s)", strings.Join(args, ", "))
+				}
+
+				fmt.Fprintf(buf, ": %s\n", f.Type)
+			}
+			buf.WriteString("}\n")
+		}
+	}
+
+	return buf.String()
+}
+
+func writeDescription(buf *bytes.Buffer, description, indent string) {
+	if description == "" {
+		return
+	}
+
+	description = strings.Replace(description, `"""`, `\"""`, -1)
+	fmt.Fprintf(buf, "%s\"\"\"%s\"\"\"\n", indent, description)
+}
+
+func formatInputValue(v *InputValue) string {
+	s := v.Name + ": " + v.Type.String()
+	if v.Default != nil {
+		s += " = " + formatValue(v.Type, v.Default)
+	}
+
+	return s
+}
+
+// formatValue returns the GraphQL literal of the value v of type t
+func formatValue(t *Type, v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+
+	switch t.Kind {
+	case NonNull:
+		return formatValue(t.OfType, v)
+
+	case List:
+		list, ok := v.([]interface{})
+		if !ok {
+			return formatValue(t.OfType, v)
+		}
+
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			items = append(items, formatValue(t.OfType, item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+
+	case Enum:
+		return fmt.Sprint(v)
+
+	case InputObject:
+		obj, _ := v.(map[string]interface{})
+		var fields []string
+		for _, f := range t.InputFields {
+			if fv, ok := obj[f.Name]; ok {
+				fields = append(fields, f.Name+": "+formatValue(f.Type, fv))
+			}
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+
+	return string(b)
+}
+
+// specifiedScalars are the scalars defined by the GraphQL specification, which
+// aren't declared in the schema definition language
+var specifiedScalars = map[string]bool{
+	"Int":     true,
+	"Float":   true,
+	"String":  true,
+	"Boolean": true,
+	"ID":      true,
+}
+
+// The scalar types. Int64 and JSON are not defined by the GraphQL specification,
+// but hold the values of Go's int64 and interface{} types.
+var (
+	Int = &Type{
+		Kind:        Scalar,
+		Name:        "Int",
+		Description: "A signed 32-bit integer",
+		Serialize:   serializeInt(math.MinInt32, math.MaxInt32, "Int"),
+		ParseValue:  serializeInt(math.MinInt32, math.MaxInt32, "Int"),
+	}
+
+	Int64 = &Type{
+		Kind:        Scalar,
+		Name:        "Int64",
+		Description: "A signed 64-bit integer, such as a timestamp in milliseconds",
+		Serialize:   serializeInt(math.MinInt64, math.MaxInt64, "Int64"),
+		ParseValue:  serializeInt(math.MinInt64, math.MaxInt64, "Int64"),
+	}
+
+	Float = &Type{
+		Kind:        Scalar,
+		Name:        "Float",
+		Description: "A double-precision floating point number",
+		Serialize:   serializeFloat,
+		ParseValue:  serializeFloat,
+	}
+
+	String = &Type{
+		Kind:        Scalar,
+		Name:        "String",
+		Description: "A UTF-8 string",
+		Serialize:   serializeString,
+		ParseValue:  parseString,
+	}
+
+	Boolean = &Type{
+		Kind:        Scalar,
+		Name:        "Boolean",
+		Description: "true or false",
+		Serialize:   parseBoolean,
+		ParseValue:  parseBoolean,
+	}
+
+	ID = &Type{
+		Kind:        Scalar,
+		Name:        "ID",
+		Description: "A unique identifier, serialized as a string",
+		Serialize:   parseID,
+		ParseValue:  parseID,
+	}
+
+	JSON = &Type{
+		Kind:        Scalar,
+		Name:        "JSON",
+		Description: "Any JSON value",
+		Serialize:   identity,
+		ParseValue:  identity,
+	}
+)
+
+// toFloat returns v as a float64 if it is a number
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	}
+
+	return 0, false
+}
+
+func serializeInt(min, max int64, name string) func(v interface{}) (interface{}, error) {
+	return func(v interface{}) (interface{}, error) {
+		var i int64
+
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i = rv.Int()
+
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if rv.Uint() > uint64(math.MaxInt64) {
+				return nil, fmt.Errorf("%s cannot represent %v", name, v)
+			}
+			i = int64(rv.Uint())
+
+		default:
+			if n, ok := v.(json.Number); ok {
+				var err error
+				i, err = strconv.ParseInt(string(n), 10, 64)
+				if err == nil {
+					break
+				}
+			}
+
+			f, ok := toFloat(v)
+			if !ok || f != math.Trunc(f) || f < float64(min) || f > float64(max) {
+				return nil, fmt.Errorf("%s cannot represent %s", name, describe(v))
+			}
+			i = int64(f)
+		}
+
+		if i < min || i > max {
+			return nil, fmt.Errorf("%s cannot represent %d", name, i)
+		}
+
+		return i, nil
+	}
+}
+
+func serializeFloat(v interface{}) (interface{}, error) {
+	f, ok := toFloat(v)
+	if !ok || math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("Float cannot represent %s", describe(v))
+	}
+
+	return f, nil
+}
+
+func serializeString(v interface{}) (interface{}, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case bool:
+		return strconv.FormatBool(s), nil
+	case fmt.Stringer:
+		return s.String(), nil
+	}
+
+	if f, ok := toFloat(v); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+
+	return nil, fmt.Errorf("String cannot represent %s", describe(v))
+}
+
+func parseString(v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("String cannot represent %s", describe(v))
+	}
+
+	return s, nil
+}
+
+func parseBoolean(v interface{}) (interface{}, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("Boolean cannot represent %s", describe(v))
+	}
+
+	return b, nil
+}
+
+func parseID(v interface{}) (interface{}, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+
+	i, err := Int64.ParseValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("ID cannot represent %s", describe(v))
+	}
+
+	return strconv.FormatInt(i.(int64), 10), nil
+}
+
+func identity(v interface{}) (interface{}, error) {
+	return v, nil
+}
+
+// describe returns v as it would appear in a query, for error messages
+func describe(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(b)
+}
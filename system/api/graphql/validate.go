@@ -0,0 +1,489 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResponseError is an error in the response to a request, at the locations in
+// the query which caused it and, for errors during execution, the path to the
+// field in the response
+type ResponseError struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"`
+}
+
+func (e *ResponseError) Error() string {
+	return e.Message
+}
+
+// NewResponseError returns a ResponseError for err, including the location of
+// a syntax error
+func NewResponseError(err error) *ResponseError {
+	if e, ok := err.(*Error); ok {
+		return &ResponseError{Message: "Syntax Error: " + e.Message, Locations: []Location{e.Location}}
+	}
+
+	return &ResponseError{Message: err.Error()}
+}
+
+type validator struct {
+	schema *Schema
+	doc    *Document
+	errs   []*ResponseError
+
+	// the variables of the operation being validated, and those it uses
+	vars     map[string]*VariableDefinition
+	usedVars map[string]bool
+
+	// the fragments spread by any operation, those validated in the operation
+	// being validated, and those being spread
+	usedFragments map[string]bool
+	validated     map[string]bool
+	spreading     map[string]bool
+}
+
+// Validate checks that the operations of doc can be executed against the schema,
+// and returns the operation with the name, which may be empty when the document
+// only has one
+func (s *Schema) Validate(doc *Document, operationName string) (*Operation, []*ResponseError) {
+	v := &validator{
+		schema:        s,
+		doc:           doc,
+		usedFragments: make(map[string]bool),
+		spreading:     make(map[string]bool),
+	}
+
+	names := make(map[string]bool)
+	for _, op := range doc.Operations {
+		if op.Name == "" && len(doc.Operations) > 1 {
+			v.errorf(op.Location, "This anonymous operation must be the only defined operation.")
+		}
+
+		if op.Name != "" && names[op.Name] {
+			v.errorf(op.Location, "There can be only one operation named %q.", op.Name)
+		}
+		names[op.Name] = true
+
+		v.validateOperation(op)
+	}
+
+	for name, f := range doc.Fragments {
+		if !v.usedFragments[name] {
+			v.errorf(f.Location, "Fragment %q is never used.", name)
+		}
+	}
+
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+
+	op, err := doc.Operation(operationName)
+	if err != nil {
+		return nil, []*ResponseError{{Message: err.Error()}}
+	}
+
+	return op, nil
+}
+
+func (v *validator) errorf(loc Location, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ResponseError{
+		Message:   fmt.Sprintf(format, args...),
+		Locations: []Location{loc},
+	})
+}
+
+func (v *validator) validateOperation(op *Operation) {
+	var root *Type
+	switch op.Type {
+	case "query":
+		root = v.schema.Query
+	case "mutation":
+		root = v.schema.Mutation
+	}
+
+	if root == nil {
+		v.errorf(op.Location, "Schema is not configured for %s operations.", op.Type)
+		return
+	}
+
+	v.vars = make(map[string]*VariableDefinition)
+	v.usedVars = make(map[string]bool)
+	v.validated = make(map[string]bool)
+
+	for _, def := range op.Variables {
+		if _, ok := v.vars[def.Name]; ok {
+			v.errorf(def.Location, "There can be only one variable named \"$%s\".", def.Name)
+		}
+		v.vars[def.Name] = def
+
+		t := v.schema.typeOf(def.Type)
+		if t == nil || !t.isInput() {
+			v.errorf(def.Location, "Variable \"$%s\" cannot be of non-input type %q.", def.Name, def.Type)
+			continue
+		}
+
+		if def.Default != nil {
+			v.validateValue(t, def.Default, false)
+		}
+	}
+
+	for _, d := range op.Directives {
+		v.errorf(d.Location, "Directive \"@%s\" may not be used on %s.", d.Name, strings.ToUpper(op.Type))
+	}
+
+	v.validateSelections(root, op.Selections, make(map[string]*Field))
+
+	for _, def := range op.Variables {
+		if !v.usedVars[def.Name] {
+			v.errorf(def.Location, "Variable \"$%s\" is never used.", def.Name)
+		}
+	}
+}
+
+// validateSelections validates sels, selected from values of type t. The fields
+// selected so far from the same values are in keys, by their response keys.
+func (v *validator) validateSelections(t *Type, sels []*Selection, keys map[string]*Field) {
+	for _, sel := range sels {
+		v.validateDirectives(sel.Directives)
+
+		switch {
+		case sel.Field != nil:
+			v.validateField(t, sel.Field, keys)
+
+		case sel.Fragment != "":
+			f, ok := v.doc.Fragments[sel.Fragment]
+			if !ok {
+				v.errorf(sel.Location, "Unknown fragment %q.", sel.Fragment)
+				continue
+			}
+
+			v.usedFragments[f.Name] = true
+			if v.spreading[f.Name] {
+				v.errorf(sel.Location, "Cannot spread fragment %q within itself.", f.Name)
+				continue
+			}
+
+			if !v.validateTypeCondition(t, f.TypeCondition, f.Location) {
+				continue
+			}
+
+			// a fragment's type is the same wherever it is spread, so it is
+			// only validated once, however many times it is spread
+			if v.validated[f.Name] {
+				continue
+			}
+			v.validated[f.Name] = true
+
+			v.validateDirectives(f.Directives)
+
+			v.spreading[f.Name] = true
+			v.validateSelections(t, f.Selections, keys)
+			delete(v.spreading, f.Name)
+
+		default:
+			if sel.TypeCondition != "" && !v.validateTypeCondition(t, sel.TypeCondition, sel.Location) {
+				continue
+			}
+
+			v.validateSelections(t, sel.Selections, keys)
+		}
+	}
+}
+
+// validateTypeCondition reports whether a fragment on the type named cond can
+// be spread within a selection from t. Since there are no interfaces or unions,
+// it must be t.
+func (v *validator) validateTypeCondition(t *Type, cond string, loc Location) bool {
+	ct, ok := v.schema.Types[cond]
+	if !ok {
+		v.errorf(loc, "Unknown type %q.", cond)
+		return false
+	}
+
+	if ct != t {
+		v.errorf(loc, "Fragment cannot be spread here as objects of type %q can never be of type %q.", t.Name, cond)
+		return false
+	}
+
+	return true
+}
+
+func (v *validator) validateField(t *Type, f *Field, keys map[string]*Field) {
+	if prev, ok := keys[f.Key()]; ok && prev != f {
+		if prev.Name != f.Name {
+			v.errorf(f.Location, "Fields %q conflict because %q and %q are different fields. Use different aliases on the fields to fetch both if this was intentional.", f.Key(), prev.Name, f.Name)
+		} else if formatArguments(prev.Arguments) != formatArguments(f.Arguments) {
+			v.errorf(f.Location, "Fields %q conflict because they have differing arguments. Use different aliases on the fields to fetch both if this was intentional.", f.Key())
+		}
+	} else {
+		keys[f.Key()] = f
+	}
+
+	def := v.schema.fieldDef(t, f.Name)
+	if def == nil {
+		v.errorf(f.Location, "Cannot query field %q on type %q.", f.Name, t.Name)
+		return
+	}
+
+	v.validateArguments(def.Args, f.Arguments, f.Location, fmt.Sprintf("Field %q", f.Name))
+
+	named := def.Type.named()
+	if named.Kind != Object {
+		if len(f.Selections) > 0 {
+			v.errorf(f.Location, "Field %q must not have a selection since type %q has no subfields.", f.Name, def.Type)
+		}
+		return
+	}
+
+	if len(f.Selections) == 0 {
+		v.errorf(f.Location, "Field %q of type %q must have a selection of subfields.", f.Name, def.Type)
+		return
+	}
+
+	v.validateSelections(named, f.Selections, make(map[string]*Field))
+}
+
+func (v *validator) validateDirectives(dirs []*Directive) {
+	seen := make(map[string]bool)
+	for _, d := range dirs {
+		var def *directive
+		for _, dd := range directives {
+			if dd.Name == d.Name {
+				def = dd
+			}
+		}
+
+		if def == nil {
+			v.errorf(d.Location, "Unknown directive \"@%s\".", d.Name)
+			continue
+		}
+
+		if seen[d.Name] {
+			v.errorf(d.Location, "The directive \"@%s\" can only be used once at this location.", d.Name)
+		}
+		seen[d.Name] = true
+
+		v.validateArguments(def.Args, d.Arguments, d.Location, fmt.Sprintf("Directive \"@%s\"", d.Name))
+	}
+}
+
+func (v *validator) validateArguments(defs []*InputValue, args []*Argument, loc Location, of string) {
+	seen := make(map[string]bool)
+	for _, a := range args {
+		if seen[a.Name] {
+			v.errorf(a.Location, "There can be only one argument named %q.", a.Name)
+		}
+		seen[a.Name] = true
+
+		def := inputValue(defs, a.Name)
+		if def == nil {
+			v.errorf(a.Location, "Unknown argument %q on %s.", a.Name, strings.ToLower(of[:1])+of[1:])
+			continue
+		}
+
+		v.validateValue(def.Type, a.Value, def.Default != nil)
+	}
+
+	for _, def := range defs {
+		if def.Type.Kind == NonNull && def.Default == nil && !seen[def.Name] {
+			v.errorf(loc, "%s argument %q of type %q is required, but it was not provided.", of, def.Name, def.Type)
+		}
+	}
+}
+
+// validateValue checks the value can be coerced to t. A null value is allowed
+// in place of a non-null type if the argument or field has a default.
+func (v *validator) validateValue(t *Type, val *Value, hasDefault bool) {
+	if val.Kind == Variable {
+		v.usedVars[val.Raw] = true
+
+		def, ok := v.vars[val.Raw]
+		if !ok {
+			v.errorf(val.Location, "Variable \"$%s\" is not defined.", val.Raw)
+			return
+		}
+
+		vt := v.schema.typeOf(def.Type)
+		if vt != nil && !allowedVariable(vt, t, def.Default != nil || hasDefault) {
+			v.errorf(val.Location, "Variable \"$%s\" of type %q used in position expecting type %q.", val.Raw, def.Type, t)
+		}
+		return
+	}
+
+	// errors describe the expected type as it was declared, even if non-null
+	expected := t
+	if t.Kind == NonNull {
+		if val.Kind == NullValue {
+			v.errorf(val.Location, "Expected value of type %q, found null.", t)
+			return
+		}
+
+		t = t.OfType
+	}
+
+	if val.Kind == NullValue {
+		return
+	}
+
+	switch t.Kind {
+	case List:
+		if val.Kind != ListValue {
+			v.validateValue(t.OfType, val, false)
+			return
+		}
+
+		for _, item := range val.List {
+			v.validateValue(t.OfType, item, false)
+		}
+
+	case InputObject:
+		if val.Kind != ObjectValue {
+			v.errorf(val.Location, "Expected value of type %q, found %s.", expected, formatLiteral(val))
+			return
+		}
+
+		seen := make(map[string]bool)
+		for _, f := range val.Fields {
+			if seen[f.Name] {
+				v.errorf(f.Location, "There can be only one input field named %q.", f.Name)
+			}
+			seen[f.Name] = true
+
+			def := inputValue(t.InputFields, f.Name)
+			if def == nil {
+				v.errorf(f.Location, "Field %q is not defined by type %q.", f.Name, t.Name)
+				continue
+			}
+
+			v.validateValue(def.Type, f.Value, def.Default != nil)
+		}
+
+		for _, def := range t.InputFields {
+			if def.Type.Kind == NonNull && def.Default == nil && !seen[def.Name] {
+				v.errorf(val.Location, "Field \"%s.%s\" of required type %q was not provided.", t.Name, def.Name, def.Type)
+			}
+		}
+
+	case Enum:
+		if val.Kind != EnumValue || !hasEnumValue(t, val.Raw) {
+			v.errorf(val.Location, "Value %s does not exist in %q enum.", formatLiteral(val), t.Name)
+		}
+
+	case Scalar:
+		if val.Kind == EnumValue || val.Kind == ListValue || (val.Kind == ObjectValue && t != JSON) {
+			v.errorf(val.Location, "Expected value of type %q, found %s.", expected, formatLiteral(val))
+			return
+		}
+
+		_, err := t.ParseValue(val.Interface(nil))
+		if err != nil {
+			v.errorf(val.Location, "Expected value of type %q, found %s; %s", expected, formatLiteral(val), err)
+		}
+	}
+}
+
+// allowedVariable reports whether a variable of type vt can be used where a
+// value of type t is expected
+func allowedVariable(vt, t *Type, hasDefault bool) bool {
+	if t.Kind == NonNull && vt.Kind != NonNull {
+		if !hasDefault {
+			return false
+		}
+
+		t = t.OfType
+	}
+
+	if t.Kind == NonNull {
+		return allowedVariable(vt.OfType, t.OfType, false)
+	}
+
+	if vt.Kind == NonNull {
+		return allowedVariable(vt.OfType, t, false)
+	}
+
+	if t.Kind == List {
+		return vt.Kind == List && allowedVariable(vt.OfType, t.OfType, false)
+	}
+
+	return vt.Kind != List && vt.Name == t.Name
+}
+
+// fieldDef returns the definition of the field of t with the name, including
+// the fields to introspect the schema
+func (s *Schema) fieldDef(t *Type, name string) *FieldDef {
+	switch {
+	case name == "__typename":
+		return typenameField
+
+	case t == s.Query && name == schemaField.Name:
+		return schemaField
+
+	case t == s.Query && name == typeField.Name:
+		return typeField
+	}
+
+	return t.Field(name)
+}
+
+// typenameField can be selected from any object, for the name of its type
+var typenameField = &FieldDef{
+	Name: "__typename",
+	Type: NewNonNull(String),
+}
+
+func inputValue(defs []*InputValue, name string) *InputValue {
+	for _, def := range defs {
+		if def.Name == name {
+			return def
+		}
+	}
+
+	return nil
+}
+
+func hasEnumValue(t *Type, value string) bool {
+	for _, ev := range t.EnumValues {
+		if ev == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// formatLiteral returns the literal val as it appears in a query
+func formatLiteral(val *Value) string {
+	switch val.Kind {
+	case Variable:
+		return "$" + val.Raw
+
+	case StringValue:
+		return describe(val.Raw)
+
+	case ListValue:
+		items := make([]string, 0, len(val.List))
+		for _, item := range val.List {
+			items = append(items, formatLiteral(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+
+	case ObjectValue:
+		return "{" + formatArguments(val.Fields) + "}"
+
+	case NullValue:
+		return "null"
+	}
+
+	return val.Raw
+}
+
+func formatArguments(args []*Argument) string {
+	fields := make([]string, 0, len(args))
+	for _, a := range args {
+		fields = append(fields, a.Name+": "+formatLiteral(a.Value))
+	}
+
+	return strings.Join(fields, ", ")
+}
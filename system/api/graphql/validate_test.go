@@ -0,0 +1,260 @@
+package graphql
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testSchema returns a schema of songs, with fields to test how values are
+// coerced and completed, and how errors are handled
+func testSchema(t *testing.T) *Schema {
+	genre := &Type{Kind: Enum, Name: "Genre", EnumValues: []string{"POP", "ROCK"}}
+	author := &Type{Kind: Object, Name: "Author", Fields: []*FieldDef{
+		{Name: "name", Type: String},
+	}}
+
+	song := &Type{Kind: Object, Name: "Song"}
+	song.Fields = []*FieldDef{
+		{Name: "id", Type: NewNonNull(Int)},
+		{Name: "title", Type: NewNonNull(String)},
+		{Name: "rating", Type: Int},
+		{Name: "genre", Type: genre},
+		{Name: "tags", Type: NewList(String)},
+		{Name: "author", Type: author},
+		{
+			Name: "fail",
+			Type: String,
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				return nil, errors.New("The field failed")
+			},
+		},
+		{
+			Name: "required",
+			Type: NewNonNull(String),
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				return nil, nil
+			},
+		},
+		{
+			Name: "repeat",
+			Type: NewList(song),
+			Args: []*InputValue{{Name: "n", Type: NewNonNull(Int)}},
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				list := make([]interface{}, args["n"].(int64))
+				for i := range list {
+					list[i] = source
+				}
+				return list, nil
+			},
+		},
+	}
+
+	input := &Type{Kind: InputObject, Name: "SongInput", InputFields: []*InputValue{
+		{Name: "title", Type: NewNonNull(String)},
+		{Name: "rating", Type: Int, Default: int64(3)},
+		{Name: "genre", Type: genre},
+		{Name: "tags", Type: NewList(NewNonNull(String))},
+	}}
+
+	songs := []map[string]interface{}{
+		{"id": 1, "title": "One", "rating": 5, "genre": "POP", "tags": []string{"a", "b"}, "author": map[string]interface{}{"name": "Ann"}},
+		{"id": 2, "title": "Two", "genre": "ROCK"},
+		{"id": 3, "title": "Three", "genre": "JAZZ"},
+	}
+
+	query := &Type{Kind: Object, Name: "Query", Fields: []*FieldDef{
+		{
+			Name: "song",
+			Type: song,
+			Args: []*InputValue{{Name: "id", Type: NewNonNull(Int)}},
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				for _, s := range songs {
+					if int64(s["id"].(int)) == args["id"] {
+						return s, nil
+					}
+				}
+				return nil, nil
+			},
+		},
+		{
+			Name: "songs",
+			Type: NewNonNull(NewList(NewNonNull(song))),
+			Args: []*InputValue{
+				{Name: "genre", Type: genre},
+				{Name: "limit", Type: Int, Default: int64(10)},
+			},
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				var list []map[string]interface{}
+				for _, s := range songs {
+					if g, ok := args["genre"]; ok && g != s["genre"] {
+						continue
+					}
+					if int64(len(list)) < args["limit"].(int64) {
+						list = append(list, s)
+					}
+				}
+				return list, nil
+			},
+		},
+		{
+			Name: "echo",
+			Type: JSON,
+			Args: []*InputValue{
+				{Name: "input", Type: input},
+				{Name: "ids", Type: NewList(NewNonNull(Int))},
+				{Name: "id", Type: ID},
+			},
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				return args, nil
+			},
+		},
+		{
+			Name: "panic",
+			Type: String,
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				panic("unexpected")
+			},
+		},
+	}}
+
+	mutation := &Type{Kind: Object, Name: "Mutation", Fields: []*FieldDef{
+		{
+			Name: "createSong",
+			Type: song,
+			Args: []*InputValue{{Name: "input", Type: NewNonNull(input)}},
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				in := args["input"].(map[string]interface{})
+				s := map[string]interface{}{"id": len(songs) + 1}
+				for k, v := range in {
+					s[k] = v
+				}
+				songs = append(songs, s)
+				return s, nil
+			},
+		},
+	}}
+
+	s, err := NewSchema(query, mutation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestNewSchema(t *testing.T) {
+	a := &Type{Kind: Object, Name: "Song", Fields: []*FieldDef{{Name: "id", Type: Int}}}
+	b := &Type{Kind: Object, Name: "Song", Fields: []*FieldDef{{Name: "id", Type: Int}}}
+	query := &Type{Kind: Object, Name: "Query", Fields: []*FieldDef{
+		{Name: "a", Type: a},
+		{Name: "b", Type: b},
+	}}
+
+	_, err := NewSchema(query, nil)
+	if err == nil || err.Error() != `There is more than one type named "Song"` {
+		t.Errorf("Expected an error for the duplicate type, got %v", err)
+	}
+
+	s := testSchema(t)
+	sdl := s.String()
+	for _, def := range []string{"type Song {", "input SongInput {", "enum Genre {", "scalar JSON"} {
+		if !strings.Contains(sdl, def) {
+			t.Errorf("Expected the schema to contain %q:\n%s", def, sdl)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := testSchema(t)
+
+	cases := []struct {
+		query  string
+		errors []string
+	}{
+		{`{ song(id: 1) { title ...F } } fragment F on Song { id }`, nil},
+		{`query ($id: Int = 1) { song(id: $id) { id } }`, nil},
+		{`mutation { createSong(input: {title: "x", tags: "single"}) { id } }`, nil},
+
+		{`{ song(id: 1) { name } }`, []string{`Cannot query field "name" on type "Song".`}},
+		{`{ song { id } }`, []string{`Field "song" argument "id" of type "Int!" is required, but it was not provided.`}},
+		{`{ song(id: 1, id: 2) { id } }`, []string{`There can be only one argument named "id".`}},
+		{`{ song(id: 1, slug: "a") { id } }`, []string{`Unknown argument "slug" on field "song".`}},
+		{`{ song(id: "1") { id } }`, []string{`Expected value of type "Int!", found "1"; Int cannot represent "1"`}},
+		{`{ song(id: 1.5) { id } }`, []string{`Expected value of type "Int!", found 1.5; Int cannot represent 1.5`}},
+		{`{ song(id: 3000000000) { id } }`, []string{`Expected value of type "Int!", found 3000000000; Int cannot represent 3000000000`}},
+		{`{ song(id: null) { id } }`, []string{`Expected value of type "Int!", found null.`}},
+		{`{ songs(genre: JAZZ) { id } }`, []string{`Value JAZZ does not exist in "Genre" enum.`}},
+		{`{ songs(genre: "POP") { id } }`, []string{`Value "POP" does not exist in "Genre" enum.`}},
+		{`{ echo(input: {rating: 1}) }`, []string{`Field "SongInput.title" of required type "String!" was not provided.`}},
+		{`{ echo(input: {title: "x", album: "y"}) }`, []string{`Field "album" is not defined by type "SongInput".`}},
+		{`{ echo(input: "x") }`, []string{`Expected value of type "SongInput", found "x".`}},
+		{`{ echo(ids: [1, null]) }`, []string{`Expected value of type "Int!", found null.`}},
+		{`{ song(id: 1) }`, []string{`Field "song" of type "Song" must have a selection of subfields.`}},
+		{`{ song(id: 1) { title { length } } }`, []string{`Field "title" must not have a selection since type "String!" has no subfields.`}},
+		{`{ a: song(id: 1) { id } a: songs { id } }`, []string{`Fields "a" conflict because "song" and "songs" are different fields. Use different aliases on the fields to fetch both if this was intentional.`}},
+		{`{ song(id: 1) { id } song(id: 2) { id } }`, []string{`Fields "song" conflict because they have differing arguments. Use different aliases on the fields to fetch both if this was intentional.`}},
+
+		{`{ song(id: $id) { id } }`, []string{`Variable "$id" is not defined.`}},
+		{`query ($id: Int) { song(id: $id) { id } }`, []string{`Variable "$id" of type "Int" used in position expecting type "Int!".`}},
+		{`query ($id: String!) { song(id: $id) { id } }`, []string{`Variable "$id" of type "String!" used in position expecting type "Int!".`}},
+		{`query ($id: Int!, $unused: Int) { song(id: $id) { id } }`, []string{`Variable "$unused" is never used.`}},
+		{`query ($id: Int!, $id: Int!) { song(id: $id) { id } }`, []string{`There can be only one variable named "$id".`}},
+		{`query ($s: Song) { song(id: 1) { id } }`, []string{`Variable "$s" cannot be of non-input type "Song".`, `Variable "$s" is never used.`}},
+		{`query ($g: Genre = JAZZ) { songs(genre: $g) { id } }`, []string{`Value JAZZ does not exist in "Genre" enum.`}},
+
+		{`{ song(id: 1) { ...F } }`, []string{`Unknown fragment "F".`}},
+		{`{ song(id: 1) { id } } fragment F on Song { id }`, []string{`Fragment "F" is never used.`}},
+		{`{ song(id: 1) { ...F } } fragment F on Author { name }`, []string{`Fragment cannot be spread here as objects of type "Song" can never be of type "Author".`}},
+		{`{ song(id: 1) { ... on Album { id } } }`, []string{`Unknown type "Album".`}},
+		{`{ song(id: 1) { ...F } } fragment F on Song { ...G } fragment G on Song { ...F }`, []string{`Cannot spread fragment "F" within itself.`}},
+
+		{`{ song(id: 1) { id @cached } }`, []string{`Unknown directive "@cached".`}},
+		{`{ song(id: 1) { id @skip } }`, []string{`Directive "@skip" argument "if" of type "Boolean!" is required, but it was not provided.`}},
+		{`{ song(id: 1) { id @skip(if: true) @skip(if: false) } }`, []string{`The directive "@skip" can only be used once at this location.`}},
+		{`query @skip(if: true) { song(id: 1) { id } }`, []string{`Directive "@skip" may not be used on QUERY.`}},
+
+		{`{ song(id: 1) { id } } { songs { id } }`, []string{`This anonymous operation must be the only defined operation.`, `This anonymous operation must be the only defined operation.`}},
+		{`query A { song(id: 1) { id } } query A { songs { id } }`, []string{`There can be only one operation named "A".`}},
+		{`subscription { songs { id } }`, []string{`Schema is not configured for subscription operations.`}},
+	}
+
+	for _, c := range cases {
+		doc, err := Parse(c.query)
+		if err != nil {
+			t.Errorf("%s: %s", c.query, err)
+			continue
+		}
+
+		_, errs := s.Validate(doc, "")
+
+		var got []string
+		for _, e := range errs {
+			got = append(got, e.Message)
+		}
+
+		if strings.Join(got, "\n") != strings.Join(c.errors, "\n") {
+			t.Errorf("%s:\nexpected errors:\n%s\ngot:\n%s", c.query, strings.Join(c.errors, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestValidateOperationName(t *testing.T) {
+	s := testSchema(t)
+	doc, err := Parse(`query A { song(id: 1) { id } } query B { songs { id } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op, errs := s.Validate(doc, "B")
+	if len(errs) > 0 || op.Name != "B" {
+		t.Errorf("Expected operation B, got %v %v", op, errs)
+	}
+
+	for _, name := range []string{"", "C"} {
+		_, errs = s.Validate(doc, name)
+		if len(errs) != 1 {
+			t.Errorf("Expected an error for operation name %q, got %v", name, errs)
+		}
+	}
+}
@@ -0,0 +1,966 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ponzu-cms/ponzu/system/api/graphql"
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+)
+
+// graphqlSchema generates the GraphQL schema of the content types for a
+// request, since types may be hidden from it or have fields omitted, and
+// resolves its queries and mutations
+type graphqlSchema struct {
+	req *http.Request
+
+	// the object and input types of content and the structs within it, and
+	// the names already given to types
+	objects  map[reflect.Type]*graphql.Type
+	inputs   map[reflect.Type]*graphql.Type
+	names    map[string]bool
+	contents map[string]*graphql.Type
+
+	// content loaded while resolving references, by type:id
+	loaded map[string]interface{}
+}
+
+var sortOrder = &graphql.Type{
+	Kind:        graphql.Enum,
+	Name:        "SortOrder",
+	Description: "The order of content by timestamp",
+	EnumValues:  []string{"ASC", "DESC"},
+}
+
+var mutationResult = &graphql.Type{
+	Kind:        graphql.Object,
+	Name:        "MutationResult",
+	Description: "The content changed by a mutation. Content pending approval has no id.",
+	Fields: []*graphql.FieldDef{
+		{Name: "id", Type: graphql.Int},
+		{Name: "type", Type: graphql.NewNonNull(graphql.String)},
+		{Name: "status", Type: graphql.NewNonNull(graphql.String)},
+	},
+}
+
+// newGraphQLSchema returns the schema of the content types for req. Types which
+// are hidden from it can't be queried, but can still be changed by mutations if
+// they implement the interfaces to.
+func newGraphQLSchema(req *http.Request) (*graphql.Schema, error) {
+	s := &graphqlSchema{
+		req:      req,
+		objects:  make(map[reflect.Type]*graphql.Type),
+		inputs:   make(map[reflect.Type]*graphql.Type),
+		names:    make(map[string]bool),
+		contents: make(map[string]*graphql.Type),
+		loaded:   make(map[string]interface{}),
+	}
+
+	for _, name := range []string{"Query", "Mutation", "SortOrder", "MutationResult", "Int", "Int64", "Float", "String", "Boolean", "ID", "JSON"} {
+		s.names[name] = true
+	}
+
+	var names []string
+	for name := range item.Types {
+		// types named like those the schema declares itself are left out
+		if s.names[name] || strings.HasPrefix(name, "__") {
+			continue
+		}
+
+		names = append(names, name)
+		s.names[name] = true
+	}
+	sort.Strings(names)
+
+	// content types are declared before their fields are added, so that any
+	// type can reference any other
+	var visible []string
+	for _, name := range names {
+		it := item.Types[name]()
+
+		hidden, err := isHidden(discardResponseWriter{}, req, it)
+		if err != nil || hidden {
+			continue
+		}
+
+		visible = append(visible, name)
+		s.contents[name] = &graphql.Type{Kind: graphql.Object, Name: name}
+		s.objects[reflect.TypeOf(it).Elem()] = s.contents[name]
+	}
+
+	query := &graphql.Type{Kind: graphql.Object, Name: "Query"}
+	for _, name := range visible {
+		s.addContentFields(name)
+		s.addQueries(query, name)
+	}
+
+	mutation := &graphql.Type{Kind: graphql.Object, Name: "Mutation"}
+	for _, name := range names {
+		s.addMutations(mutation, name)
+	}
+
+	if len(mutation.Fields) == 0 {
+		mutation = nil
+	}
+
+	return graphql.NewSchema(query, mutation)
+}
+
+// addContentFields adds the fields of the content type name to its object
+// type. Fields which are always omitted from the request are left out, and
+// item.Referenceable fields are objects of the type they reference.
+func (s *graphqlSchema) addContentFields(name string) {
+	it := item.Types[name]()
+	t := s.contents[name]
+
+	omitted := make(map[string]bool)
+	if om, ok := it.(item.Omittable); ok {
+		fields, err := om.Omit(discardResponseWriter{}, s.req)
+		if err != nil {
+			log.Println("Error calling Omit for GraphQL schema:", err)
+		}
+
+		for _, f := range fields {
+			omitted[f] = true
+		}
+	}
+
+	var refs map[string]string
+	if r, ok := it.(item.Referenceable); ok {
+		refs = r.References()
+	}
+
+	for _, f := range jsonFields(reflect.TypeOf(it).Elem()) {
+		if omitted[f.name] || graphqlName(f.name) == "" {
+			continue
+		}
+
+		ref, ok := s.contents[refs[f.name]]
+		switch {
+		case ok && f.typ.Kind() == reflect.String:
+			t.Fields = append(t.Fields, s.fieldDef(f, ref, s.resolveReference(f.name, ref.Name)))
+			continue
+
+		case ok && f.typ.Kind() == reflect.Slice && f.typ.Elem().Kind() == reflect.String:
+			lt := graphql.NewList(graphql.NewNonNull(ref))
+			t.Fields = append(t.Fields, s.fieldDef(f, lt, s.resolveReference(f.name, ref.Name)))
+			continue
+		}
+
+		ft := s.outputType(f, name+f.goName)
+		if ft != nil {
+			t.Fields = append(t.Fields, s.fieldDef(f, ft, nil))
+		}
+	}
+}
+
+// fieldDef returns the definition of the struct field f of type t, resolved by
+// resolve if it isn't nil
+func (s *graphqlSchema) fieldDef(f jsonField, t *graphql.Type, resolve graphql.ResolveFunc) *graphql.FieldDef {
+	def := &graphql.FieldDef{Name: graphqlName(f.name), Type: t, Resolve: resolve}
+
+	// fields are read from the content's JSON, by their original names
+	if resolve == nil && def.Name != f.name {
+		key := f.name
+		def.Resolve = func(source interface{}, args map[string]interface{}) (interface{}, error) {
+			m, _ := source.(map[string]interface{})
+			return m[key], nil
+		}
+	}
+
+	return def
+}
+
+// outputType returns the GraphQL type of the values of the struct field f, as
+// encoding/json would encode them, or nil if they can't be encoded. Structs are
+// objects, named name unless the struct type is named.
+func (s *graphqlSchema) outputType(f jsonField, name string) *graphql.Type {
+	if f.quoted {
+		switch f.typ.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return graphql.String
+		}
+	}
+
+	return s.graphqlType(f.typ, name, false)
+}
+
+// graphqlType returns the GraphQL type of values of type t, for the output or
+// input of content. Structs are object or input types named name, unless the
+// struct type is named.
+func (s *graphqlSchema) graphqlType(t reflect.Type, name string, input bool) *graphql.Type {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType, t == uuidType:
+		return graphql.String
+
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return graphql.JSON
+
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return graphql.String
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return graphql.Boolean
+
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int, reflect.Uint8, reflect.Uint16:
+		return graphql.Int
+
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return graphql.Int64
+
+	case reflect.Float32, reflect.Float64:
+		return graphql.Float
+
+	case reflect.String:
+		return graphql.String
+
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return graphql.String
+		}
+
+		elem := s.graphqlType(t.Elem(), name, input)
+		if elem == nil {
+			return nil
+		}
+
+		return graphql.NewList(elem)
+
+	case reflect.Map, reflect.Interface:
+		return graphql.JSON
+
+	case reflect.Struct:
+		return s.structType(t, name, input)
+	}
+
+	return nil
+}
+
+// structType returns the object or input type of the struct type t
+func (s *graphqlSchema) structType(t reflect.Type, name string, input bool) *graphql.Type {
+	types := s.objects
+	kind := graphql.Object
+	if input {
+		types = s.inputs
+		kind = graphql.InputObject
+	}
+
+	if gt, ok := types[t]; ok {
+		return gt
+	}
+
+	if t.Name() != "" {
+		name = t.Name()
+	}
+	if input {
+		name += "Input"
+	}
+
+	gt := &graphql.Type{Kind: kind, Name: s.uniqueName(name)}
+	types[t] = gt
+
+	for _, f := range jsonFields(t) {
+		if input {
+			ft := s.graphqlType(f.typ, gt.Name+f.goName, true)
+			if ft != nil && graphqlName(f.name) == f.name {
+				gt.InputFields = append(gt.InputFields, &graphql.InputValue{Name: f.name, Type: ft})
+			}
+			continue
+		}
+
+		ft := s.outputType(f, gt.Name+f.goName)
+		if ft != nil && graphqlName(f.name) != "" {
+			gt.Fields = append(gt.Fields, s.fieldDef(f, ft, nil))
+		}
+	}
+
+	// GraphQL types must have fields, so structs without any are plain JSON
+	if len(gt.Fields) == 0 && len(gt.InputFields) == 0 {
+		return graphql.JSON
+	}
+
+	return gt
+}
+
+// uniqueName returns name, or name with a number added if it is already used
+func (s *graphqlSchema) uniqueName(name string) string {
+	unique := name
+	for i := 2; s.names[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+
+	s.names[unique] = true
+	return unique
+}
+
+// addQueries adds the fields to query content of type name to the query type:
+// a single item by id, a list of items and the number of items
+func (s *graphqlSchema) addQueries(query *graphql.Type, name string) {
+	t := s.contents[name]
+	field := lowerFirst(name)
+
+	query.Fields = append(query.Fields, &graphql.FieldDef{
+		Name:        field,
+		Description: "Gets the " + name + " content with the id",
+		Type:        t,
+		Args: []*graphql.InputValue{
+			{Name: "id", Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+			return s.content(name, strconv.FormatInt(args["id"].(int64), 10))
+		},
+	})
+
+	filter := s.filterType(t)
+
+	listArgs := []*graphql.InputValue{
+		{Name: "count", Description: "Number of items to return, or -1 for all", Type: graphql.Int, Default: int64(10)},
+		{Name: "offset", Description: "Number of pages of count items to skip", Type: graphql.Int, Default: int64(0)},
+		{Name: "order", Description: "Sort order by timestamp", Type: sortOrder, Default: "DESC"},
+	}
+	countArgs := []*graphql.InputValue{}
+	if filter != nil {
+		arg := &graphql.InputValue{Name: "filter", Description: "Only include content with these field values", Type: filter}
+		listArgs = append([]*graphql.InputValue{arg}, listArgs...)
+		countArgs = append(countArgs, arg)
+	}
+
+	query.Fields = append(query.Fields, &graphql.FieldDef{
+		Name:        field + "List",
+		Description: "Lists the " + name + " content",
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(t))),
+		Args:        listArgs,
+		Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+			count, offset := 10, 0
+			if c, ok := args["count"].(int64); ok {
+				count = int(c)
+			}
+			if o, ok := args["offset"].(int64); ok {
+				offset = int(o)
+			}
+
+			if count < -1 {
+				return nil, errors.New("count must be -1 or more")
+			}
+			if offset < 0 {
+				return nil, errors.New("offset must be 0 or more")
+			}
+
+			order := "desc"
+			if args["order"] == "ASC" {
+				order = "asc"
+			}
+
+			filter, _ := args["filter"].(map[string]interface{})
+			_, bb := s.query(name, filter, db.QueryOptions{
+				Count:  count,
+				Offset: offset,
+				Order:  order,
+			})
+
+			return s.decode(name, bb...)
+		},
+	})
+
+	query.Fields = append(query.Fields, &graphql.FieldDef{
+		Name:        field + "Count",
+		Description: "Counts the " + name + " content",
+		Type:        graphql.NewNonNull(graphql.Int),
+		Args:        countArgs,
+		Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+			filter, _ := args["filter"].(map[string]interface{})
+			total, _ := s.query(name, filter, db.QueryOptions{Count: 1, Order: "desc"})
+			return total, nil
+		},
+	})
+}
+
+// filterType returns the input type to filter content of type t by the values
+// of its scalar fields, or nil if it has none
+func (s *graphqlSchema) filterType(t *graphql.Type) *graphql.Type {
+	filter := &graphql.Type{
+		Kind:        graphql.InputObject,
+		Name:        s.uniqueName(t.Name + "Filter"),
+		Description: "Content matches if each field given equals its value, or contains it if the field is a list",
+	}
+
+	for _, f := range t.Fields {
+		ft := f.Type
+		if ft.Kind == graphql.List {
+			ft = ft.OfType
+		}
+
+		// fields read from other keys or resolved as references can't be
+		// compared with the content's JSON
+		if f.Resolve != nil || ft.Kind != graphql.Scalar || ft == graphql.JSON {
+			continue
+		}
+
+		filter.InputFields = append(filter.InputFields, &graphql.InputValue{Name: f.Name, Type: ft})
+	}
+
+	if len(filter.InputFields) == 0 {
+		return nil
+	}
+
+	return filter
+}
+
+// query returns the total number of content items of type t matching filter,
+// and those within the page chosen by opts
+func (s *graphqlSchema) query(t string, filter map[string]interface{}, opts db.QueryOptions) (int, [][]byte) {
+	if len(filter) == 0 {
+		return db.Query(t+"__sorted", opts)
+	}
+
+	_, all := db.Query(t+"__sorted", db.QueryOptions{Count: -1, Order: opts.Order})
+
+	var matched [][]byte
+	for _, b := range all {
+		var post map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+
+		err := dec.Decode(&post)
+		if err != nil {
+			log.Println("Error decoding content for GraphQL filter:", t, err)
+			continue
+		}
+
+		if matchFilter(post, filter) {
+			matched = append(matched, b)
+		}
+	}
+
+	if opts.Count == -1 {
+		return len(matched), matched
+	}
+
+	start := opts.Count * opts.Offset
+	end := start + opts.Count
+	if start > len(matched) {
+		start = len(matched)
+	}
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	return len(matched), matched[start:end]
+}
+
+// matchFilter reports whether each field of filter equals the field of post, or
+// is one of its values if it is a list
+func matchFilter(post, filter map[string]interface{}) bool {
+	for k, want := range filter {
+		got := post[k]
+
+		list, ok := got.([]interface{})
+		if !ok {
+			if !equalValues(got, want) {
+				return false
+			}
+			continue
+		}
+
+		found := false
+		for _, v := range list {
+			if equalValues(v, want) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalValues compares values decoded from JSON with GraphQL input values,
+// which may be different types of number
+func equalValues(a, b interface{}) bool {
+	fa, aNum := number(a)
+	fb, bNum := number(b)
+	if aNum || bNum {
+		return aNum && bNum && fa == fb
+	}
+
+	return a == b
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+// addMutations adds the mutations to create, update and delete content of type
+// name to the mutation type, for each of the interfaces the type implements
+func (s *graphqlSchema) addMutations(mutation *graphql.Type, name string) {
+	it := item.Types[name]()
+
+	input := s.inputType(name)
+	result := graphql.NewNonNull(mutationResult)
+
+	if _, ok := it.(Createable); ok && input != nil {
+		mutation.Fields = append(mutation.Fields, &graphql.FieldDef{
+			Name:        "create" + name,
+			Description: "Creates " + name + " content, calling the same hooks as the content API",
+			Type:        result,
+			Args: []*graphql.InputValue{
+				{Name: "input", Type: graphql.NewNonNull(input)},
+			},
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				req, err := subRequest(s.req, http.MethodPost, "/api/content/create", url.Values{"type": {name}}, args["input"])
+				if err != nil {
+					return nil, err
+				}
+
+				rec := newCaptureResponseWriter()
+				id, spec, ok := createJSON(rec, req, name)
+				if !ok {
+					return nil, rec.err()
+				}
+
+				if spec != "" {
+					return map[string]interface{}{"type": name, "status": strings.TrimPrefix(spec, "__")}, nil
+				}
+
+				return map[string]interface{}{"id": id, "type": name, "status": "public"}, nil
+			},
+		})
+	}
+
+	if _, ok := it.(Updateable); ok && input != nil {
+		mutation.Fields = append(mutation.Fields, &graphql.FieldDef{
+			Name:        "update" + name,
+			Description: "Updates the fields given in the input of the " + name + " content with the id",
+			Type:        result,
+			Args: []*graphql.InputValue{
+				{Name: "id", Type: graphql.NewNonNull(graphql.Int)},
+				{Name: "input", Type: graphql.NewNonNull(input)},
+			},
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				id := strconv.FormatInt(args["id"].(int64), 10)
+				req, err := subRequest(s.req, http.MethodPost, "/api/content/update", url.Values{"type": {name}, "id": {id}}, args["input"])
+				if err != nil {
+					return nil, err
+				}
+
+				rec := newCaptureResponseWriter()
+				if !updateJSON(rec, req, name, id, false) {
+					return nil, rec.err()
+				}
+
+				return map[string]interface{}{"id": args["id"], "type": name, "status": "public"}, nil
+			},
+		})
+	}
+
+	if _, ok := it.(Deleteable); ok {
+		mutation.Fields = append(mutation.Fields, &graphql.FieldDef{
+			Name:        "delete" + name,
+			Description: "Deletes the " + name + " content with the id",
+			Type:        result,
+			Args: []*graphql.InputValue{
+				{Name: "id", Type: graphql.NewNonNull(graphql.Int)},
+			},
+			Resolve: func(source interface{}, args map[string]interface{}) (interface{}, error) {
+				id := strconv.FormatInt(args["id"].(int64), 10)
+				req, err := subRequest(s.req, http.MethodPost, "/api/content/delete", url.Values{"type": {name}, "id": {id}}, nil)
+				if err != nil {
+					return nil, err
+				}
+
+				rec := newCaptureResponseWriter()
+				if !deleteJSON(rec, req, name, id) {
+					return nil, rec.err()
+				}
+
+				return map[string]interface{}{"id": args["id"], "type": name, "status": "deleted"}, nil
+			},
+		})
+	}
+}
+
+// inputType returns the input type for creating and updating content of type
+// name, which has its fields apart from those set by the system, or nil if it
+// has none. Reference fields take the references as they are stored.
+func (s *graphqlSchema) inputType(name string) *graphql.Type {
+	t := reflect.TypeOf(item.Types[name]()).Elem()
+	input := &graphql.Type{
+		Kind: graphql.InputObject,
+		Name: s.uniqueName(name + "Input"),
+	}
+
+	for _, f := range jsonFields(t) {
+		system := false
+		for _, itemField := range itemFields {
+			if f.name == itemField {
+				system = true
+			}
+		}
+
+		if system || graphqlName(f.name) != f.name {
+			continue
+		}
+
+		ft := s.graphqlType(f.typ, name+f.goName, true)
+		if ft != nil {
+			input.InputFields = append(input.InputFields, &graphql.InputValue{Name: f.name, Type: ft})
+		}
+	}
+
+	if len(input.InputFields) == 0 {
+		return nil
+	}
+
+	return input
+}
+
+// subRequest returns a copy of r as a request to the content API at path, with
+// body as its JSON body, so GraphQL mutations and batch operations call the
+// same hooks as other API requests
+func subRequest(r *http.Request, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	req := r.WithContext(r.Context())
+	req.Method = method
+	req.URL = &url.URL{Path: path, RawQuery: query.Encode()}
+	req.Form, req.PostForm, req.MultipartForm = nil, nil, nil
+
+	req.Header = make(http.Header)
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	// conditions on the outer request don't apply to the content it changes
+	for _, h := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		req.Header.Del(h)
+	}
+	req.Header.Del("Content-Encoding")
+
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+		return req, nil
+	}
+
+	j, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Body = ioutil.NopCloser(bytes.NewReader(j))
+	req.ContentLength = int64(len(j))
+
+	return req, nil
+}
+
+// resolveReference returns a ResolveFunc loading the content of type t
+// referenced by the field key, or each of its references if it is a list
+func (s *graphqlSchema) resolveReference(key, t string) graphql.ResolveFunc {
+	return func(source interface{}, args map[string]interface{}) (interface{}, error) {
+		m, _ := source.(map[string]interface{})
+
+		switch ref := m[key].(type) {
+		case string:
+			return s.reference(ref, t)
+
+		case []interface{}:
+			items := []interface{}{}
+			for _, r := range ref {
+				str, _ := r.(string)
+				post, err := s.reference(str, t)
+				if err != nil {
+					return nil, err
+				}
+
+				// references to content which was deleted or is hidden are
+				// left out
+				if post != nil {
+					items = append(items, post)
+				}
+			}
+			return items, nil
+		}
+
+		return nil, nil
+	}
+}
+
+// reference loads the content of type t referenced by ref, a content API URL
+// like /api/content?type=Author&id=1
+func (s *graphqlSchema) reference(ref, t string) (interface{}, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, nil
+	}
+
+	q := u.Query()
+	if q.Get("type") != t || !db.IsValidID(q.Get("id")) {
+		return nil, nil
+	}
+
+	return s.content(t, q.Get("id"))
+}
+
+// content loads the content of type t with the id, as the content API would
+// send it to the request, or nil if there is none or it is hidden
+func (s *graphqlSchema) content(t, id string) (interface{}, error) {
+	key := t + ":" + id
+	if post, ok := s.loaded[key]; ok {
+		return post, nil
+	}
+
+	b, err := db.Content(key)
+	if err != nil {
+		log.Println("Error getting content for GraphQL:", key, err)
+		return nil, errors.New("The content could not be loaded")
+	}
+
+	if len(b) == 0 {
+		s.loaded[key] = nil
+		return nil, nil
+	}
+
+	p := item.Types[t]()
+	err = json.Unmarshal(b, p)
+	if err != nil {
+		log.Println("Error unmarshalling content for GraphQL:", key, err)
+		return nil, errors.New("The content could not be loaded")
+	}
+
+	hidden, err := isHidden(discardResponseWriter{}, s.req, p)
+	if err != nil || hidden {
+		s.loaded[key] = nil
+		return nil, nil
+	}
+
+	posts, err := s.decode(t, b)
+	if err != nil {
+		return nil, err
+	}
+
+	s.loaded[key] = posts[0]
+	return posts[0], nil
+}
+
+// decode returns the content items of type t, with their omitted fields removed
+func (s *graphqlSchema) decode(t string, bb ...[]byte) ([]interface{}, error) {
+	var result = []json.RawMessage{}
+	for i := range bb {
+		result = append(result, bb[i])
+	}
+
+	j, err := fmtJSON(result...)
+	if err != nil {
+		return nil, errors.New("The content could not be loaded")
+	}
+
+	j, err = omit(discardResponseWriter{}, s.req, item.Types[t](), j)
+	if err != nil {
+		return nil, errors.New("The content could not be loaded")
+	}
+
+	var data struct {
+		Data []interface{} `json:"data"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+
+	err = dec.Decode(&data)
+	if err != nil {
+		log.Println("Error decoding content for GraphQL:", t, err)
+		return nil, errors.New("The content could not be loaded")
+	}
+
+	return data.Data, nil
+}
+
+// jsonField is a struct field as encoding/json sees it
+type jsonField struct {
+	name   string // from the json tag
+	goName string
+	typ    reflect.Type
+	quoted bool // with the "string" option
+}
+
+// jsonFields returns the fields of the struct type t which encoding/json
+// encodes, including those of embedded structs
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	index := make(map[string]int)
+
+	add := func(f jsonField) {
+		if i, ok := index[f.name]; ok {
+			fields[i] = f
+			return
+		}
+
+		index[f.name] = len(fields)
+		fields = append(fields, f)
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if f.Anonymous && opts[0] == "" && ft.Kind() == reflect.Struct {
+			for _, ef := range jsonFields(ft) {
+				add(ef)
+			}
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+
+		jf := jsonField{name: opts[0], goName: f.Name, typ: f.Type}
+		if jf.name == "" {
+			jf.name = f.Name
+		}
+
+		for _, opt := range opts[1:] {
+			if opt == "string" {
+				jf.quoted = true
+			}
+		}
+
+		add(jf)
+	}
+
+	return fields
+}
+
+// graphqlName returns the JSON name as a valid GraphQL name, replacing any
+// characters which aren't allowed, or "" if it can't be used
+func graphqlName(name string) string {
+	if name == "" || strings.HasPrefix(name, "__") {
+		return ""
+	}
+
+	b := []byte(name)
+	for i, c := range b {
+		letter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+		if !letter && !(i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
+
+// lowerFirst returns the type name in lower camel case for the names of
+// queries, such as blogPost for BlogPost and urlPattern for URLPattern
+func lowerFirst(name string) string {
+	r := []rune(name)
+	for i := range r {
+		if !unicode.IsUpper(r[i]) {
+			break
+		}
+
+		// the last capital before a lower case letter begins the next word
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+
+		r[i] = unicode.ToLower(r[i])
+	}
+
+	return string(r)
+}
+
+// captureResponseWriter keeps the response to a request made for a mutation,
+// so its errors can be returned to the client
+type captureResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newCaptureResponseWriter() *captureResponseWriter {
+	return &captureResponseWriter{header: make(http.Header)}
+}
+
+func (w *captureResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *captureResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.body.Write(p)
+}
+
+func (w *captureResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+// err returns the errors sent in the captured response, or its status
+func (w *captureResponseWriter) err() error {
+	var resp struct {
+		Errors []apiError `json:"errors"`
+	}
+
+	err := json.Unmarshal(w.body.Bytes(), &resp)
+	if err == nil && len(resp.Errors) > 0 {
+		var msgs []string
+		for _, e := range resp.Errors {
+			msgs = append(msgs, e.Message)
+		}
+
+		return errors.New(strings.Join(msgs, "; "))
+	}
+
+	status := w.status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+
+	return fmt.Errorf("The request failed with status %d %s", status, http.StatusText(status))
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+)
+
+type testSong struct {
+	item.Item
+
+	Title  string   `json:"title"`
+	Rating int      `json:"rating"`
+	Tags   []string `json:"tags"`
+	Secret string   `json:"secret"`
+}
+
+func (s *testSong) String() string { return s.Title }
+
+func (s *testSong) Create(res http.ResponseWriter, req *http.Request) error { return nil }
+
+func (s *testSong) AutoApprove(res http.ResponseWriter, req *http.Request) error { return nil }
+
+func (s *testSong) Omit(res http.ResponseWriter, req *http.Request) ([]string, error) {
+	return []string{"secret"}, nil
+}
+
+// TestMain runs the tests with a db of TestSong content, in a temporary
+// directory, and the GraphQL API enabled
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "ponzu-api")
+	if err != nil {
+		panic(err)
+	}
+
+	wd, _ := os.Getwd()
+	err = os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+
+	item.Types["TestSong"] = func() interface{} { return new(testSong) }
+	db.Init()
+
+	err = db.PutConfig("graphql_enabled", true)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, title := range []string{"One", "Two"} {
+		_, err = db.SetContent("TestSong:-1", url.Values{
+			"title":  {title},
+			"rating": {"4"},
+			"tags":   {"a", "b"},
+			"secret": {"hidden"},
+			"slug":   {strings.ToLower(title)},
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// content is sorted for lists in the background, after a delay if it is
+	// added in quick succession
+	for i := 0; i < 50; i++ {
+		total, _ := db.Query("TestSong__sorted", db.QueryOptions{Count: 1, Order: "desc"})
+		if total == 2 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	code := m.Run()
+
+	os.Chdir(wd)
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func graphqlPost(query string) (int, string) {
+	req := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(query))
+	req.Header.Set("Content-Type", "application/graphql")
+	res := httptest.NewRecorder()
+
+	graphqlHandler(res, req)
+
+	return res.Code, strings.TrimSpace(res.Body.String())
+}
+
+func TestGraphQL(t *testing.T) {
+	cases := []struct {
+		query    string
+		status   int
+		expected string
+	}{
+		{
+			`{ testSong(id: 1) { id title rating tags } }`,
+			http.StatusOK,
+			`{"data":{"testSong":{"id":1,"title":"One","rating":4,"tags":["a","b"]}}}`,
+		},
+		{
+			`{ testSongList(order: ASC) { title } testSongCount }`,
+			http.StatusOK,
+			`{"data":{"testSongList":[{"title":"One"},{"title":"Two"}],"testSongCount":2}}`,
+		},
+		{
+			`{ testSongList(filter: {title: "Two"}) { id } missing: testSong(id: 9) { id } }`,
+			http.StatusOK,
+			`{"data":{"testSongList":[{"id":2}],"missing":null}}`,
+		},
+		{
+			// omitted fields aren't part of the schema
+			`{ testSong(id: 1) { secret } }`,
+			http.StatusBadRequest,
+			`{"errors":[{"message":"Cannot query field \"secret\" on type \"TestSong\".","locations":[{"line":1,"column":21}]}]}`,
+		},
+		{
+			`{ testSong(id: 1) { title }`,
+			http.StatusBadRequest,
+			`{"errors":[{"message":"Syntax Error: Expected a name, found \u003cEOF\u003e","locations":[{"line":1,"column":28}]}]}`,
+		},
+	}
+
+	for _, c := range cases {
+		status, got := graphqlPost(c.query)
+		if status != c.status || got != c.expected {
+			t.Errorf("%s:\nexpected %d %s\ngot      %d %s", c.query, c.status, c.expected, status, got)
+		}
+	}
+}
+
+func TestGraphQLMutation(t *testing.T) {
+	status, got := graphqlPost(`mutation { createTestSong(input: {title: "Three", tags: ["c"]}) { id type status } }`)
+	expected := `{"data":{"createTestSong":{"id":3,"type":"TestSong","status":"public"}}}`
+	if status != http.StatusOK || got != expected {
+		t.Fatalf("Expected %s, got %d %s", expected, status, got)
+	}
+
+	status, got = graphqlPost(`{ testSong(id: 3) { title tags } }`)
+	expected = `{"data":{"testSong":{"title":"Three","tags":["c"]}}}`
+	if status != http.StatusOK || got != expected {
+		t.Errorf("Expected %s, got %d %s", expected, status, got)
+	}
+}
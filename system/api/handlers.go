@@ -51,6 +51,23 @@ func contentsHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	refs, err := parseExpand(q.Get("expand"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	fields, err := parseFields(q.Get("fields"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	etag, modified := collectionETag(t, q)
+	if notModified(res, req, etag, modified) {
+		return
+	}
+
 	count, err := strconv.Atoi(q.Get("count")) // int: determines number of posts to return (10 default, -1 is all)
 	if err != nil {
 		if q.Get("count") == "" {
@@ -100,6 +117,18 @@ func contentsHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	j, err = expand(req, j, refs)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	j, err = project(j, fields)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	sendData(res, req, j)
 }
 
@@ -119,6 +148,18 @@ func contentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	refs, err := parseExpand(q.Get("expand"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	fields, err := parseFields(q.Get("fields"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	pt, ok := item.Types[t]
 	if !ok {
 		res.WriteHeader(http.StatusNotFound)
@@ -142,6 +183,11 @@ func contentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	etag, modified := itemETag(post, q)
+	if notModified(res, req, etag, modified) {
+		return
+	}
+
 	push(res, req, p, post)
 
 	j, err := fmtJSON(json.RawMessage(post))
@@ -156,17 +202,42 @@ func contentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	j, err = expand(req, j, refs)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	j, err = project(j, fields)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	sendData(res, req, j)
 }
 
 func contentHandlerBySlug(res http.ResponseWriter, req *http.Request) {
-	slug := req.URL.Query().Get("slug")
+	q := req.URL.Query()
+	slug := q.Get("slug")
 
 	if slug == "" {
 		res.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	refs, err := parseExpand(q.Get("expand"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	fields, err := parseFields(q.Get("fields"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	// lookup type:id by slug key in __contentIndex
 	t, post, err := db.ContentBySlug(slug)
 	if err != nil {
@@ -192,6 +263,11 @@ func contentHandlerBySlug(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	etag, modified := itemETag(post, q)
+	if notModified(res, req, etag, modified) {
+		return
+	}
+
 	push(res, req, p, post)
 
 	j, err := fmtJSON(json.RawMessage(post))
@@ -206,6 +282,18 @@ func contentHandlerBySlug(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	j, err = expand(req, j, refs)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	j, err = project(j, fields)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	sendData(res, req, j)
 }
 
@@ -7,21 +7,36 @@ import (
 )
 
 func hide(res http.ResponseWriter, req *http.Request, it interface{}) bool {
+	hidden, err := isHidden(res, req, it)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return true
+	}
+
+	if hidden {
+		res.WriteHeader(http.StatusNotFound)
+		return true
+	}
+
+	return false
+}
+
+// isHidden reports whether it should be hidden from the request, without
+// writing a response like hide
+func isHidden(res http.ResponseWriter, req *http.Request, it interface{}) (bool, error) {
 	// check if should be hidden
 	if h, ok := it.(item.Hideable); ok {
 		err := h.Hide(res, req)
 		if err == item.ErrAllowHiddenItem {
-			return false
+			return false, nil
 		}
 
 		if err != nil {
-			res.WriteHeader(http.StatusInternalServerError)
-			return true
+			return true, err
 		}
 
-		res.WriteHeader(http.StatusNotFound)
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 func fmtJSON(data ...json.RawMessage) ([]byte, error) {
@@ -50,8 +52,95 @@ func sendData(res http.ResponseWriter, req *http.Request, data []byte) {
 	res.Header().Set("Content-Type", "application/json")
 	res.Header().Set("Vary", "Accept-Encoding")
 
+	// responses without an ETag from the content they send are identified by
+	// their data
+	if res.Header().Get("ETag") == "" && notModified(res, req, "W/"+contentETag(data), time.Time{}) {
+		return
+	}
+
 	_, err := res.Write(data)
 	if err != nil {
 		log.Println("Error writing to response in sendData")
 	}
 }
+
+// apiError describes why a request failed, such as an invalid field value, for
+// clients sending JSON. Field is the JSON name of the field at fault, if any.
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field"`
+}
+
+// sendErrors responds to a client with the status code and the errors which
+// caused it, as {"errors":[...]}, and the meta of the response in the v2 API
+func sendErrors(res http.ResponseWriter, status int, errs ...apiError) {
+	j, err := json.Marshal(map[string][]apiError{
+		"errors": errs,
+	})
+	if err != nil {
+		log.Println("Failed to encode errors to JSON:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	j = withMeta(res, j, nil)
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+
+	_, err = res.Write(j)
+	if err != nil {
+		log.Println("Error writing to response in sendErrors")
+	}
+}
+
+// errInternal is sent to clients when a request fails on the server, without
+// revealing why
+var errInternal = apiError{
+	Code:    "internal_error",
+	Message: "The request could not be completed",
+}
+
+// sendSaved responds to a create or update request with the status code and the
+// id, status and type of the saved content. Content pending approval has no
+// public id.
+func sendSaved(res http.ResponseWriter, code int, t, spec string, id interface{}) {
+	var data map[string]interface{}
+	if spec != "" {
+		spec = strings.TrimPrefix(spec, "__")
+		data = map[string]interface{}{
+			"status": spec,
+			"type":   t,
+		}
+	} else {
+		spec = "public"
+		data = map[string]interface{}{
+			"id":     id,
+			"status": spec,
+			"type":   t,
+		}
+	}
+
+	resp := map[string]interface{}{
+		"data": []map[string]interface{}{
+			data,
+		},
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Error marshalling saved content response to JSON:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	j = withMeta(res, j, nil)
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(code)
+	_, err = res.Write(j)
+	if err != nil {
+		log.Println("Error writing saved content response:", err)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// maxRequestIDLength is the longest X-Request-ID header accepted from clients,
+// longer ids are replaced by a new one
+const maxRequestIDLength = 128
+
+// meta describes a v2 API response, alongside its data or errors. Total, Count
+// and Next are only sent with lists of content.
+type meta struct {
+	Total     *int   `json:"total,omitempty"`
+	Count     *int   `json:"count,omitempty"`
+	Next      string `json:"next,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+// requestID wraps a HandlerFunc to identify each request with the id in its
+// X-Request-ID header, or a new one, which is sent back in the same header and
+// in the meta of v2 API responses
+func requestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			uid, err := uuid.NewV4()
+			if err != nil {
+				log.Println("Error creating request id:", err)
+				res.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			id = uid.String()
+		}
+
+		res.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(res, req)
+	}
+}
+
+// validRequestID reports whether a request id sent by a client is safe to log
+// and send back, being short and made of visible ASCII characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withMeta adds the meta object m to the JSON response j, along with the id of
+// the request. Responses without a request id, such as those of the v1 API,
+// are returned unchanged.
+func withMeta(res http.ResponseWriter, j []byte, m *meta) []byte {
+	id := res.Header().Get("X-Request-ID")
+	if id == "" {
+		return j
+	}
+
+	if m == nil {
+		m = &meta{}
+	}
+	m.RequestID = id
+
+	mj, err := json.Marshal(m)
+	if err != nil {
+		log.Println("Failed to encode response meta to JSON:", err)
+		return j
+	}
+
+	// meta is added as the last field of the response object, after its data
+	// or errors
+	end := bytes.LastIndexByte(j, '}')
+	if end < 0 {
+		return j
+	}
+
+	var buf bytes.Buffer
+	buf.Write(bytes.TrimRight(j[:end], " \n"))
+	buf.WriteString(`,"meta":`)
+	buf.Write(mj)
+	buf.WriteString("}\n")
+
+	return buf.Bytes()
+}
+
+// cursor is the position in a list of content where a page starts, which is
+// sent to clients as an opaque string
+type cursor struct {
+	Count  int    `json:"count"`
+	Offset int    `json:"offset"`
+	Order  string `json:"order"`
+}
+
+// encodeCursor returns c as a string to send to clients
+func encodeCursor(c cursor) string {
+	j, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(j)
+}
+
+// decodeCursor returns the cursor encoded in s by encodeCursor, and false if s
+// isn't a valid cursor
+func decodeCursor(s string) (cursor, bool) {
+	var c cursor
+	j, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, false
+	}
+
+	err = json.Unmarshal(j, &c)
+	if err != nil || c.Count < 1 || c.Offset < 0 {
+		return c, false
+	}
+
+	if c.Order != "asc" && c.Order != "desc" {
+		return c, false
+	}
+
+	return c, true
+}
@@ -0,0 +1,663 @@
+package api
+
+import (
+	"encoding"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+	"github.com/ponzu-cms/ponzu/system/search"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// object is a JSON Schema, or any other object within an OpenAPI document
+type object map[string]interface{}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	uuidType          = reflect.TypeOf(uuid.UUID{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// itemFields are set by the system, so can't be changed by requests
+var itemFields = []string{"uuid", "id", "slug", "timestamp", "updated"}
+
+func openAPIHandler(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	j, err := json.Marshal(openAPI(req))
+	if err != nil {
+		log.Println("Error encoding OpenAPI document:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sendData(res, req, j)
+}
+
+// openAPI returns an OpenAPI 3 document describing the content API for each of
+// the registered content types, as seen by the client making req, since types
+// may be hidden from it or have fields omitted
+func openAPI(req *http.Request) object {
+	var names []string
+	for name := range item.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	schemas := object{
+		"Error": object{
+			"type": "object",
+			"properties": object{
+				"code":    object{"type": "string"},
+				"message": object{"type": "string"},
+				"field":   object{"type": "string", "description": "The JSON name of the invalid field, if any"},
+			},
+		},
+		"Errors": object{
+			"type": "object",
+			"properties": object{
+				"errors": object{"type": "array", "items": ref("Error")},
+			},
+		},
+		"Meta": object{
+			"type": "object",
+			"properties": object{
+				"total":      object{"type": "integer", "description": "The number of items in the list, on all pages"},
+				"count":      object{"type": "integer", "description": "The number of items in data"},
+				"next":       object{"type": "string", "description": "The cursor of the next page of the list, omitted on the last page"},
+				"request_id": object{"type": "string", "description": "Identifies the request, as in the X-Request-ID header"},
+			},
+		},
+		"Status": object{
+			"type": "object",
+			"properties": object{
+				"id":     object{"description": "Omitted if the content is pending approval"},
+				"type":   object{"type": "string"},
+				"status": object{"type": "string", "enum": []string{"public", "pending", "deleted"}},
+			},
+		},
+	}
+
+	paths := object{}
+	var visible, createable, updateable, deleteable, searchable []string
+	for _, name := range names {
+		it := item.Types[name]()
+		described := false
+
+		hidden, err := isHidden(discardResponseWriter{}, req, it)
+		if err == nil && !hidden {
+			visible = append(visible, name)
+			described = true
+
+			if s, ok := it.(search.Searchable); ok && s.IndexContent() {
+				searchable = append(searchable, name)
+			}
+		}
+
+		_, ok := it.(Createable)
+		if ok {
+			createable = append(createable, name)
+			described = true
+		}
+
+		_, ok = it.(Updateable)
+		if ok {
+			updateable = append(updateable, name)
+			described = true
+		}
+
+		_, ok = it.(Deleteable)
+		if ok {
+			deleteable = append(deleteable, name)
+			described = true
+		}
+
+		// types which are hidden and can't be changed through the API aren't
+		// described at all
+		if !described {
+			continue
+		}
+
+		schemas[name] = contentSchema(req, it)
+		addV2Paths(paths, name, it, err == nil && !hidden)
+	}
+
+	addV1Paths(paths, visible, createable, updateable, deleteable, searchable)
+
+	siteName, _ := db.ConfigCache("name").(string)
+	if siteName == "" {
+		siteName = "Ponzu"
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   siteName + " Content API",
+			"version": "2",
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": schemas,
+		},
+	}
+}
+
+// contentSchema returns the schema of the content type it, from its struct
+// fields' json tags. Fields omitted from responses by item.Omittable are write
+// only, and the fields of the embedded item.Item are read only.
+func contentSchema(req *http.Request, it interface{}) object {
+	s := typeSchema(reflect.TypeOf(it), map[reflect.Type]bool{})
+	delete(s, "nullable")
+
+	props, _ := s["properties"].(object)
+	for _, f := range itemFields {
+		if p, ok := props[f].(object); ok {
+			p["readOnly"] = true
+		}
+	}
+
+	om, ok := it.(item.Omittable)
+	if !ok {
+		return s
+	}
+
+	fields, err := om.Omit(discardResponseWriter{}, req)
+	if err != nil {
+		log.Println("Error calling Omit for OpenAPI document:", err)
+		return s
+	}
+
+	for _, f := range fields {
+		p := s
+		for _, name := range strings.Split(f, ".") {
+			props, _ := p["properties"].(object)
+			p, _ = props[name].(object)
+		}
+
+		if p != nil {
+			p["writeOnly"] = true
+		}
+	}
+
+	return s
+}
+
+// typeSchema returns the schema of values of type t, as encoding/json would
+// encode them, or nil for types which can't be encoded. Structs already within
+// seen are described as an object, to stop at recursive types.
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) object {
+	if t.Kind() == reflect.Ptr {
+		s := typeSchema(t.Elem(), seen)
+		if s != nil {
+			s["nullable"] = true
+		}
+
+		return s
+	}
+
+	switch {
+	case t == timeType:
+		return object{"type": "string", "format": "date-time"}
+
+	case t == uuidType:
+		return object{"type": "string", "format": "uuid"}
+
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return object{}
+
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return object{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{"type": "boolean"}
+
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return object{"type": "integer", "format": "int32"}
+
+	case reflect.Int, reflect.Int64:
+		return object{"type": "integer", "format": "int64"}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return object{"type": "integer", "minimum": 0}
+
+	case reflect.Float32:
+		return object{"type": "number", "format": "float"}
+
+	case reflect.Float64:
+		return object{"type": "number", "format": "double"}
+
+	case reflect.String:
+		return object{"type": "string"}
+
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return object{"type": "string", "format": "byte"}
+		}
+
+		return object{"type": "array", "items": typeSchema(t.Elem(), seen)}
+
+	case reflect.Array:
+		return object{
+			"type":     "array",
+			"items":    typeSchema(t.Elem(), seen),
+			"minItems": t.Len(),
+			"maxItems": t.Len(),
+		}
+
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": typeSchema(t.Elem(), seen)}
+
+	case reflect.Interface:
+		return object{}
+
+	case reflect.Struct:
+		if seen[t] {
+			return object{"type": "object"}
+		}
+
+		seen[t] = true
+		defer delete(seen, t)
+
+		props := object{}
+		addFields(props, t, seen)
+
+		return object{"type": "object", "properties": props}
+	}
+
+	return nil
+}
+
+// addFields adds the schema of each field of the struct type t to props by its
+// JSON name, including the fields of embedded structs
+func addFields(props object, t reflect.Type, seen map[reflect.Type]bool) {
+	// fields of embedded structs are added first, since fields of t with the
+	// same name take their place
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if f.Anonymous && strings.Split(tag, ",")[0] == "" && ft.Kind() == reflect.Struct {
+			addFields(props, ft, seen)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+
+		fields = append(fields, f)
+	}
+
+	for _, f := range fields {
+		opts := strings.Split(f.Tag.Get("json"), ",")
+		name := opts[0]
+		if name == "" {
+			name = f.Name
+		}
+
+		s := typeSchema(f.Type, seen)
+		if s == nil {
+			continue
+		}
+
+		// the "string" option encodes numbers and booleans as strings
+		for _, opt := range opts[1:] {
+			if opt == "string" && s["type"] != "string" && s["type"] != nil && s["type"] != "object" && s["type"] != "array" {
+				s = object{"type": "string"}
+			}
+		}
+
+		props[name] = s
+	}
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// dataSchema returns the schema of a response containing items matching s
+func dataSchema(s object) object {
+	return object{
+		"type": "object",
+		"properties": object{
+			"data": object{"type": "array", "items": s},
+		},
+	}
+}
+
+// response returns a JSON response with the description, matching s
+func response(description string, s object) object {
+	return object{
+		"description": description,
+		"content": object{
+			"application/json": object{"schema": s},
+		},
+	}
+}
+
+func errorResponse(description string) object {
+	return response(description, ref("Errors"))
+}
+
+// v2Response returns a JSON response of the v2 API with the description, which
+// matches s along with the meta of the response
+func v2Response(description string, s object) object {
+	return response(description, object{
+		"allOf": []object{s, {
+			"type": "object",
+			"properties": object{
+				"meta": ref("Meta"),
+			},
+		}},
+	})
+}
+
+func v2ErrorResponse(description string) object {
+	return v2Response(description, ref("Errors"))
+}
+
+func param(name, in, description string, s object, required bool) object {
+	return object{
+		"name":        name,
+		"in":          in,
+		"description": description,
+		"required":    required,
+		"schema":      s,
+	}
+}
+
+// pageParams are the query parameters which choose the content of a list
+func pageParams() []object {
+	return []object{
+		param("order", "query", "Sort order by timestamp", object{"type": "string", "enum": []string{"asc", "desc"}, "default": "desc"}, false),
+		param("count", "query", "Number of items to return, or -1 for all", object{"type": "integer", "minimum": -1, "default": 10}, false),
+		param("offset", "query", "Number of pages of count items to skip", object{"type": "integer", "minimum": 0, "default": 0}, false),
+	}
+}
+
+// addV2Paths adds the /api/v2 operations of the content type name to paths,
+// according to the interfaces it implements and whether it is visible
+func addV2Paths(paths object, name string, it interface{}, visible bool) {
+	collection := object{}
+	single := object{
+		"parameters": []object{
+			param("id", "path", "The id of the content", object{"type": "integer", "minimum": 1}, true),
+		},
+	}
+
+	body := object{
+		"required": true,
+		"content": object{
+			"application/json": object{"schema": ref(name)},
+		},
+	}
+
+	etag := object{
+		"ETag": object{
+			"description": "Changes whenever the content does, for use in If-Match headers",
+			"schema":      object{"type": "string"},
+		},
+	}
+
+	cursorParam := param("cursor", "query", "Continues a list from the page after the one with this next cursor, in place of order, count and offset", object{"type": "string"}, false)
+
+	ifMatch := param("If-Match", "header", "Only change the content if its ETag matches", object{"type": "string"}, false)
+
+	if visible {
+		collection["get"] = object{
+			"operationId": "list" + name,
+			"summary":     "List " + name + " content",
+			"tags":        []string{name},
+			"parameters":  append(pageParams(), cursorParam),
+			"responses": object{
+				"200": v2Response("The content", dataSchema(ref(name))),
+				"400": v2ErrorResponse("Invalid parameters"),
+			},
+		}
+
+		ok := v2Response("The content", dataSchema(ref(name)))
+		ok["headers"] = etag
+		single["get"] = object{
+			"operationId": "get" + name,
+			"summary":     "Get " + name + " content by id",
+			"tags":        []string{name},
+			"responses": object{
+				"200": ok,
+				"404": v2ErrorResponse("No content with the id"),
+			},
+		}
+	}
+
+	if _, ok := it.(Createable); ok {
+		responses := object{
+			"400": v2ErrorResponse("Invalid or rejected content"),
+		}
+
+		if _, ok := it.(Trustable); ok {
+			created := v2Response("The content was created", dataSchema(ref("Status")))
+			created["headers"] = object{
+				"Location": object{
+					"description": "The path of the new content",
+					"schema":      object{"type": "string"},
+				},
+				"ETag": etag["ETag"],
+			}
+			responses["201"] = created
+		} else {
+			responses["202"] = v2Response("The content is pending approval", dataSchema(ref("Status")))
+		}
+
+		collection["post"] = object{
+			"operationId": "create" + name,
+			"summary":     "Create " + name + " content",
+			"tags":        []string{name},
+			"requestBody": body,
+			"responses":   responses,
+		}
+	}
+
+	if _, ok := it.(Updateable); ok {
+		for method, summary := range map[string]string{
+			"put":   "Replace " + name + " content",
+			"patch": "Update " + name + " content, keeping the fields missing from the body",
+		} {
+			ok := v2Response("The content was saved", dataSchema(ref("Status")))
+			ok["headers"] = etag
+			single[method] = object{
+				"operationId": method + name,
+				"summary":     summary,
+				"tags":        []string{name},
+				"parameters":  []object{ifMatch},
+				"requestBody": body,
+				"responses": object{
+					"200": ok,
+					"400": v2ErrorResponse("Invalid or rejected content"),
+					"404": v2ErrorResponse("No content with the id"),
+					"412": v2ErrorResponse("The content changed since it was read"),
+				},
+			}
+		}
+	}
+
+	if _, ok := it.(Deleteable); ok {
+		single["delete"] = object{
+			"operationId": "delete" + name,
+			"summary":     "Delete " + name + " content",
+			"tags":        []string{name},
+			"parameters":  []object{ifMatch},
+			"responses": object{
+				"200": v2Response("The content was deleted", dataSchema(ref("Status"))),
+				"404": v2ErrorResponse("No content with the id"),
+				"412": v2ErrorResponse("The content changed since it was read"),
+			},
+		}
+	}
+
+	if len(collection) > 0 {
+		paths[v2Path+name] = collection
+	}
+
+	if len(single) > 1 {
+		paths[v2Path+name+"/{id}"] = single
+	}
+}
+
+// addV1Paths adds the operations of the original content API to paths, which
+// are shared by the content types named in each list
+func addV1Paths(paths object, visible, createable, updateable, deleteable, searchable []string) {
+	typeParam := func(types []string) object {
+		return param("type", "query", "The content type", object{"type": "string", "enum": types}, true)
+	}
+
+	idParam := param("id", "query", "The id of the content", object{"type": "integer", "minimum": 1}, true)
+	fieldsParam := param("fields", "query", "Comma separated fields to include in each item, with nested fields separated by dots", object{"type": "string"}, false)
+	expandParam := param("expand", "query", "Comma separated reference fields to replace with the content they reference, with nested fields separated by dots", object{"type": "string"}, false)
+
+	oneOf := func(types []string) object {
+		var refs []object
+		for _, t := range types {
+			refs = append(refs, ref(t))
+		}
+
+		return object{"oneOf": refs}
+	}
+
+	body := func(types []string) object {
+		return object{
+			"required": true,
+			"content": object{
+				"multipart/form-data": object{"schema": object{"type": "object"}},
+				"application/json":    object{"schema": oneOf(types)},
+			},
+		}
+	}
+
+	if len(visible) > 0 {
+		paths["/api/contents"] = object{
+			"get": object{
+				"operationId": "contents",
+				"summary":     "List content of a type",
+				"parameters":  append([]object{typeParam(visible), fieldsParam, expandParam}, pageParams()...),
+				"responses": object{
+					"200": response("The content", dataSchema(oneOf(visible))),
+				},
+			},
+		}
+
+		paths["/api/content"] = object{
+			"get": object{
+				"operationId": "content",
+				"summary":     "Get content by type and id, or by slug",
+				"parameters": []object{
+					param("type", "query", "The content type, with id", object{"type": "string", "enum": visible}, false),
+					param("id", "query", "The id of the content, with type", object{"type": "integer", "minimum": 1}, false),
+					param("slug", "query", "The slug of the content, instead of type and id", object{"type": "string"}, false),
+					fieldsParam,
+					expandParam,
+				},
+				"responses": object{
+					"200": response("The content", dataSchema(oneOf(visible))),
+				},
+			},
+		}
+	}
+
+	if len(createable) > 0 {
+		paths["/api/content/create"] = object{
+			"post": object{
+				"operationId": "createContent",
+				"summary":     "Create content",
+				"parameters":  []object{typeParam(createable)},
+				"requestBody": body(createable),
+				"responses": object{
+					"200": response("The content was created, or is pending approval", dataSchema(ref("Status"))),
+					"400": errorResponse("Invalid or rejected content"),
+				},
+			},
+		}
+	}
+
+	if len(updateable) > 0 {
+		paths["/api/content/update"] = object{
+			"post": object{
+				"operationId": "updateContent",
+				"summary":     "Update content",
+				"parameters":  []object{typeParam(updateable), idParam},
+				"requestBody": body(updateable),
+				"responses": object{
+					"200": response("The content was updated", dataSchema(ref("Status"))),
+					"400": errorResponse("Invalid or rejected content"),
+				},
+			},
+		}
+	}
+
+	if len(deleteable) > 0 {
+		paths["/api/content/delete"] = object{
+			"post": object{
+				"operationId": "deleteContent",
+				"summary":     "Delete content",
+				"parameters":  []object{typeParam(deleteable), idParam},
+				"responses": object{
+					"200": response("The content was deleted", dataSchema(ref("Status"))),
+				},
+			},
+		}
+	}
+
+	if len(searchable) > 0 {
+		paths["/api/search"] = object{
+			"get": object{
+				"operationId": "search",
+				"summary":     "Search content of a type",
+				"parameters": []object{
+					typeParam(searchable),
+					param("q", "query", "The search query", object{"type": "string"}, true),
+					param("count", "query", "Number of results to return, or -1 for all", object{"type": "integer", "minimum": -1, "default": 10}, false),
+					param("offset", "query", "Number of pages of count results to skip", object{"type": "integer", "minimum": 0, "default": 0}, false),
+					fieldsParam,
+				},
+				"responses": object{
+					"200": response("The matching content", dataSchema(oneOf(searchable))),
+				},
+			},
+		}
+	}
+}
+
+// discardResponseWriter is passed to the methods of content types while
+// describing them, so nothing they write is sent to the client
+type discardResponseWriter struct{}
+
+func (discardResponseWriter) Header() http.Header {
+	return http.Header{}
+}
+
+func (discardResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (discardResponseWriter) WriteHeader(int) {}
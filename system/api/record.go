@@ -2,15 +2,79 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/ponzu-cms/ponzu/system/api/analytics"
+	"github.com/ponzu-cms/ponzu/system/metrics"
 )
 
-// Record wraps a HandlerFunc to record API requests for analytical purposes
+// Record wraps a HandlerFunc to record API requests for analytical purposes and
+// server metrics, along with the status code and latency of the response
 func Record(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-		go analytics.Record(req)
+		rec := &recordResponseWriter{ResponseWriter: res}
 
-		next.ServeHTTP(res, req)
+		var w http.ResponseWriter = rec
+		if pusher, ok := res.(http.Pusher); ok {
+			w = pushRecordResponseWriter{rec, pusher}
+		}
+
+		start := time.Now()
+		next.ServeHTTP(w, req)
+		latency := time.Since(start)
+
+		_, route := http.DefaultServeMux.Handler(req)
+		metrics.Observe(route, req.Method, rec.Status(), latency)
+
+		go analytics.Record(req, rec.Status(), latency)
 	})
 }
+
+type recordResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *recordResponseWriter) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordResponseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *recordResponseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Status returns the status code written to the response, which is
+// http.StatusOK if the handler wrote nothing at all
+func (rw *recordResponseWriter) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+
+	return rw.status
+}
+
+// pushRecordResponseWriter is used in place of a recordResponseWriter when the
+// underlying ResponseWriter supports HTTP/2 server push, so that Pushable items
+// continue to be pushed
+type pushRecordResponseWriter struct {
+	*recordResponseWriter
+	pusher http.Pusher
+}
+
+func (rw pushRecordResponseWriter) Push(target string, opts *http.PushOptions) error {
+	return rw.pusher.Push(target, opts)
+}
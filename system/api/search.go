@@ -43,6 +43,12 @@ func searchContentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	fields, err := parseFields(qs.Get("fields"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	count, err := strconv.Atoi(qs.Get("count")) // int: determines number of posts to return (10 default, -1 is all)
 	if err != nil {
 		if qs.Get("count") == "" {
@@ -105,5 +111,11 @@ func searchContentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	j, err = project(j, fields)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	sendData(res, req, j)
 }
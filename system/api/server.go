@@ -3,7 +3,10 @@
 // interactivity with the system.
 package api
 
-import "net/http"
+import (
+	"net/http"
+	"sync"
+)
 
 // Run adds Handlers to default http listener for API
 func Run() {
@@ -19,5 +22,36 @@ func Run() {
 
 	http.HandleFunc("/api/search", Record(CORS(Gzip(searchContentHandler))))
 
+	http.HandleFunc("/api/openapi.json", Record(CORS(Gzip(openAPIHandler))))
+
+	http.HandleFunc("/api/graphql", Record(CORS(Gzip(graphqlHandler))))
+
 	http.HandleFunc("/api/uploads", Record(CORS(Gzip(uploadsHandler))))
+
+	http.HandleFunc("/api/batch", Record(CORS(Gzip(batchHandler))))
+
+	// the stream is never cached or compressed, so events are sent as they
+	// happen
+	http.HandleFunc("/api/stream", Record(cors(streamHandler)))
+
+	// the v2 API responds to OPTIONS requests itself, to allow the methods each
+	// content type supports, and identifies each request in its responses
+	http.HandleFunc(v2Path, requestID(Record(customCORS(Gzip(v2Handler)))))
+
+	HandleTus()
+}
+
+var tusOnce sync.Once
+
+// HandleTus adds the handler for resumable uploads to the default http
+// listener. It is called by the admin server too, since the editor uploads
+// large files with it, and only adds the handler once if both are run.
+func HandleTus() {
+	tusOnce.Do(func() {
+		// resumable uploads respond to OPTIONS requests themselves, since the
+		// tus protocol uses them for discovery
+		http.HandleFunc(tusPath, Record(customCORS(tusHandler)))
+
+		go tusCleanup()
+	})
 }
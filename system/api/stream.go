@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+)
+
+// streamKeepAlive is how often a comment is sent on idle streams, so proxies
+// don't close them
+const streamKeepAlive = 30 * time.Second
+
+// streamHandler sends changes to the content of a type as Server-Sent Events,
+// named create, update and delete, until the client disconnects
+func streamHandler(res http.ResponseWriter, req *http.Request) {
+	t := req.URL.Query().Get("type")
+	if t == "" {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	it, ok := item.Types[t]
+	if !ok {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if hide(res, req, it()) {
+		return
+	}
+
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		log.Println("Error streaming content events: response can't be flushed")
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// EventSource sends the id of the last event it received when reconnecting
+	var lastID uint64
+	if id := req.Header.Get("Last-Event-ID"); id != "" {
+		lastID, _ = strconv.ParseUint(id, 10, 64)
+	}
+
+	events, stop, resumed := db.WatchContent(lastID)
+	defer stop()
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	// the events since the last one received are unknown, so the client must
+	// fetch the content again
+	if lastID != 0 && !resumed {
+		fmt.Fprint(res, "event: reset\ndata: {}\n\n")
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+
+		case <-keepAlive.C:
+			fmt.Fprint(res, ": keep-alive\n\n")
+			flusher.Flush()
+
+		case ev, ok := <-events:
+			// the client didn't keep up, and can reconnect to get the events
+			// it missed
+			if !ok {
+				return
+			}
+
+			if ev.Type != t {
+				continue
+			}
+
+			data, err := streamEventData(req, it, ev)
+			if err != nil {
+				log.Println("Error streaming content event:", ev.Type, ev.ContentID, err)
+				continue
+			}
+			if data == nil {
+				continue
+			}
+
+			_, err = fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Action, data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// streamEventData returns the data of a content event, which is the content as
+// the content API would send it to the request, or its id and type if it was
+// deleted. It returns nil if the content is hidden from the request.
+func streamEventData(req *http.Request, it func() interface{}, ev db.ContentEvent) ([]byte, error) {
+	p := it()
+	err := json.Unmarshal(ev.Data, p)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, err := isHidden(discardResponseWriter{}, req, p)
+	if err != nil || hidden {
+		return nil, nil
+	}
+
+	if ev.Action == "delete" {
+		return json.Marshal(map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"id": ev.ContentID, "type": ev.Type},
+			},
+		})
+	}
+
+	j, err := fmtJSON(json.RawMessage(ev.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	j, err = omit(discardResponseWriter{}, req, p, j)
+	if err != nil {
+		return nil, err
+	}
+
+	// each line of data would be a separate data field, so the JSON must be
+	// on one line
+	return bytes.TrimSpace(j), nil
+}
@@ -0,0 +1,598 @@
+package api
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/admin/upload"
+	"github.com/ponzu-cms/ponzu/system/admin/user"
+	"github.com/ponzu-cms/ponzu/system/item"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,checksum,termination,expiration"
+	tusChecksums  = "sha1,md5,sha256"
+	tusPath       = "/api/uploads/tus/"
+
+	// tusExpiry is how long an incomplete upload is kept after it is created
+	tusExpiry = 24 * time.Hour
+
+	// tusMaxSize is the largest upload accepted from admin users when no upload
+	// size limit is configured, so the disk can't be filled by mistake
+	tusMaxSize = 1024 * 1024 * 1024
+
+	// tusMaxClientSize is the largest upload accepted from other clients when
+	// no upload size limit is configured
+	tusMaxClientSize = 100 * 1024 * 1024
+
+	// statusChecksumMismatch is sent when a chunk does not match its
+	// Upload-Checksum, as defined by the tus checksum extension
+	statusChecksumMismatch = 460
+)
+
+// tusUpload is the state of a resumable upload, stored as JSON next to the file
+// its chunks are written to
+type tusUpload struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata"`
+	Expires  time.Time         `json:"expires"`
+
+	// Path is the URL path of the stored file once the upload is complete
+	Path string `json:"path"`
+}
+
+var (
+	tusMu     = &sync.Mutex{}
+	tusActive = make(map[string]bool)
+)
+
+// tusHandler implements the tus resumable upload protocol (https://tus.io),
+// including its creation, checksum, termination and expiration extensions.
+// Uploads are created by admin users, or by clients for the fields of a
+// Createable content type, named in the "type" and "field" metadata, whose
+// BeforeAPICreate and Create hooks accept the creation request. Once
+// complete, the file is stored like any other upload and its URL path is sent
+// in the Ponzu-Upload-Path header.
+func tusHandler(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Tus-Resumable", tusVersion)
+	res.Header().Set("Access-Control-Allow-Methods", "POST, HEAD, PATCH, DELETE, OPTIONS")
+	res.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset, Upload-Checksum, X-HTTP-Method-Override")
+	res.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Tus-Checksum-Algorithm, Upload-Offset, Upload-Length, Upload-Expires, Ponzu-Upload-Path")
+
+	if override := req.Header.Get("X-HTTP-Method-Override"); override != "" {
+		req.Method = strings.ToUpper(override)
+	}
+
+	if req.Method == http.MethodOptions {
+		res.Header().Set("Tus-Version", tusVersion)
+		res.Header().Set("Tus-Extension", tusExtensions)
+		res.Header().Set("Tus-Checksum-Algorithm", tusChecksums)
+		res.Header().Set("Tus-Max-Size", fmt.Sprintf("%d", tusMaxBytes(item.UploadRule{}, user.IsValid(req))))
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if req.Header.Get("Tus-Resumable") != tusVersion {
+		res.Header().Set("Tus-Version", tusVersion)
+		res.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(req.URL.Path, tusPath), "/")
+	if id == "" {
+		if req.Method != http.MethodPost {
+			res.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		tusCreate(res, req)
+		return
+	}
+
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 32 {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodHead:
+		tusHead(res, req, id)
+	case http.MethodPatch:
+		tusPatch(res, req, id)
+	case http.MethodDelete:
+		tusDelete(res, req, id)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func tusCreate(res http.ResponseWriter, req *http.Request) {
+	length, err := strconv.ParseInt(req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	meta := tusMetadata(req.Header.Get("Upload-Metadata"))
+	if meta["filename"] == "" {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// hooks may write their own response when they reject the upload
+	rec := &recordResponseWriter{ResponseWriter: res}
+	rule, status := tusRule(rec, req, meta)
+	if status != http.StatusOK {
+		if rec.status == 0 {
+			res.WriteHeader(status)
+		}
+		return
+	}
+
+	if length > tusMaxBytes(rule, user.IsValid(req)) {
+		res.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		log.Println("[Tus] error creating upload id:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	u := &tusUpload{
+		ID:       hex.EncodeToString(b),
+		Length:   length,
+		Metadata: meta,
+		Expires:  time.Now().Add(tusExpiry),
+	}
+
+	err = os.MkdirAll(tusDir(), os.ModeDir|os.ModePerm)
+	if err != nil {
+		log.Println("[Tus] error creating directory for uploads:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = ioutil.WriteFile(tusFile(u.ID, ".bin"), nil, 0644)
+	if err == nil {
+		err = u.save()
+	}
+	if err != nil {
+		log.Println("[Tus] error creating upload:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Location", tusPath+u.ID)
+	res.Header().Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusCreated)
+}
+
+func tusHead(res http.ResponseWriter, req *http.Request, id string) {
+	u, err := loadTusUpload(id)
+	if err != nil {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	res.Header().Set("Cache-Control", "no-store")
+	res.Header().Set("Upload-Offset", fmt.Sprintf("%d", u.Offset))
+	res.Header().Set("Upload-Length", fmt.Sprintf("%d", u.Length))
+	res.Header().Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	if u.Path != "" {
+		res.Header().Set("Ponzu-Upload-Path", u.Path)
+	}
+
+	res.WriteHeader(http.StatusOK)
+}
+
+func tusPatch(res http.ResponseWriter, req *http.Request, id string) {
+	if req.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		res.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var h hash.Hash
+	var sum []byte
+	if checksum := req.Header.Get("Upload-Checksum"); checksum != "" {
+		parts := strings.SplitN(checksum, " ", 2)
+		switch parts[0] {
+		case "sha1":
+			h = sha1.New()
+		case "md5":
+			h = md5.New()
+		case "sha256":
+			h = sha256.New()
+		default:
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if len(parts) != 2 {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		sum, err = base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	// only one request may write to an upload at a time
+	tusMu.Lock()
+	if tusActive[id] {
+		tusMu.Unlock()
+		res.WriteHeader(http.StatusConflict)
+		return
+	}
+	tusActive[id] = true
+	tusMu.Unlock()
+
+	defer func() {
+		tusMu.Lock()
+		delete(tusActive, id)
+		tusMu.Unlock()
+	}()
+
+	u, err := loadTusUpload(id)
+	if err != nil {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if offset != u.Offset || u.Path != "" {
+		res.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	f, err := os.OpenFile(tusFile(id, ".bin"), os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("[Tus] error opening upload:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var body io.Reader = io.LimitReader(req.Body, u.Length-u.Offset)
+	if h != nil {
+		body = io.TeeReader(body, h)
+	}
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		f.Close()
+		log.Println("[Tus] error seeking in upload:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// a chunk interrupted by the client is kept, so that it can be resumed
+	// from wherever it stopped, unless it is to be verified by its checksum
+	n, copyErr := io.Copy(f, body)
+	mismatch := h != nil && copyErr == nil && !bytes.Equal(h.Sum(nil), sum)
+	if h != nil && (copyErr != nil || mismatch) {
+		n = 0
+		err = f.Truncate(offset)
+		if err != nil {
+			log.Println("[Tus] error discarding chunk:", err)
+		}
+	}
+
+	err = f.Close()
+	if err != nil {
+		log.Println("[Tus] error writing upload:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	u.Offset += n
+	err = u.save()
+	if err != nil {
+		log.Println("[Tus] error saving upload:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if mismatch {
+		res.WriteHeader(statusChecksumMismatch)
+		return
+	}
+
+	if copyErr != nil {
+		log.Println("[Tus] upload interrupted:", copyErr)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if u.Offset == u.Length {
+		err = u.finish(req)
+		if e, ok := err.(*upload.Error); ok {
+			log.Println("[Tus]", err, "from:", req.RemoteAddr)
+			removeTusUpload(id)
+			http.Error(res, e.Error(), e.Status)
+			return
+		}
+		if err != nil {
+			log.Println("[Tus] error storing upload:", err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		res.Header().Set("Ponzu-Upload-Path", u.Path)
+	}
+
+	res.Header().Set("Upload-Offset", fmt.Sprintf("%d", u.Offset))
+	res.Header().Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func tusDelete(res http.ResponseWriter, req *http.Request, id string) {
+	tusMu.Lock()
+	active := tusActive[id]
+	tusMu.Unlock()
+
+	if active {
+		res.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	if _, err := loadTusUpload(id); err != nil {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	removeTusUpload(id)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// finish validates the assembled file and stores it, the same as a file
+// uploaded in a single request
+func (u *tusUpload) finish(req *http.Request) error {
+	f, err := os.Open(tusFile(u.ID, ".bin"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var post interface{}
+	if p, ok := item.Types[u.Metadata["type"]]; ok {
+		post = p()
+	}
+
+	field := u.Metadata["field"]
+	filename := u.Metadata["filename"]
+
+	contentType, err := upload.Validate(upload.Rule(post, field), field, filename, u.Length, f)
+	if err != nil {
+		return err
+	}
+
+	urlPath, err := upload.StoreFile(filename, contentType, u.Length, f, time.Now())
+	if err != nil {
+		return err
+	}
+
+	u.Path = urlPath
+	err = u.save()
+	if err != nil {
+		return err
+	}
+
+	// the upload info is kept until it expires, so a client which missed the
+	// final response can find the path of the file
+	return os.Remove(tusFile(u.ID, ".bin"))
+}
+
+// tusRule checks that the request may create an upload, returning the rule for
+// the upload's content type and field, and the status to reject it with
+// otherwise. Uploads by clients other than admin users are created like content
+// of the type, so its BeforeAPICreate and Create hooks can check their auth.
+func tusRule(res http.ResponseWriter, req *http.Request, meta map[string]string) (item.UploadRule, int) {
+	t := meta["type"]
+	if t == "" {
+		if user.IsValid(req) {
+			return item.UploadRule{}, http.StatusOK
+		}
+
+		return item.UploadRule{}, http.StatusUnauthorized
+	}
+
+	p, ok := item.Types[t]
+	if !ok {
+		return item.UploadRule{}, http.StatusNotFound
+	}
+
+	post := p()
+	rule := upload.Rule(post, meta["field"])
+	if user.IsValid(req) {
+		return rule, http.StatusOK
+	}
+
+	ext, ok := post.(Createable)
+	if !ok {
+		log.Println("[Tus] rejected upload for non-createable type:", t, "from:", req.RemoteAddr)
+		return item.UploadRule{}, http.StatusBadRequest
+	}
+
+	hook, ok := post.(item.Hookable)
+	if !ok {
+		log.Println("[Tus] error: Type", t, "does not implement item.Hookable or embed item.Item.")
+		return item.UploadRule{}, http.StatusBadRequest
+	}
+
+	err := hook.BeforeAPICreate(res, req)
+	if err != nil {
+		log.Println("[Tus] error calling BeforeAPICreate:", err)
+		if err == ErrNoAuth {
+			return item.UploadRule{}, http.StatusUnauthorized
+		}
+		return item.UploadRule{}, http.StatusBadRequest
+	}
+
+	err = ext.Create(res, req)
+	if err != nil {
+		log.Println("[Tus] error calling Create:", err)
+		if err == ErrNoAuth {
+			return item.UploadRule{}, http.StatusUnauthorized
+		}
+		return item.UploadRule{}, http.StatusBadRequest
+	}
+
+	return rule, http.StatusOK
+}
+
+// tusMaxBytes returns the largest upload allowed by the rule, which is
+// tusMaxSize for admin users and tusMaxClientSize for other clients if it has
+// no limit
+func tusMaxBytes(rule item.UploadRule, admin bool) int64 {
+	if max := upload.MaxBytes(rule); max > 0 {
+		return max
+	}
+
+	if admin {
+		return tusMaxSize
+	}
+
+	return tusMaxClientSize
+}
+
+// tusMetadata decodes the Upload-Metadata header, made up of comma separated
+// keys and base64 encoded values
+func tusMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), " ", 2)
+		if kv[0] == "" {
+			continue
+		}
+
+		if len(kv) == 1 {
+			meta[kv[0]] = ""
+			continue
+		}
+
+		v, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil {
+			continue
+		}
+
+		meta[kv[0]] = string(v)
+	}
+
+	return meta
+}
+
+func (u *tusUpload) save() error {
+	j, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	tmp := tusFile(u.ID, ".json.tmp")
+	err = ioutil.WriteFile(tmp, j, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, tusFile(u.ID, ".json"))
+}
+
+func loadTusUpload(id string) (*tusUpload, error) {
+	j, err := ioutil.ReadFile(tusFile(id, ".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	u := &tusUpload{}
+	err = json.Unmarshal(j, u)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(u.Expires) {
+		return nil, os.ErrNotExist
+	}
+
+	return u, nil
+}
+
+func removeTusUpload(id string) {
+	for _, ext := range []string{".bin", ".json"} {
+		err := os.Remove(tusFile(id, ext))
+		if err != nil && !os.IsNotExist(err) {
+			log.Println("[Tus] error removing upload:", err)
+		}
+	}
+}
+
+// tusDir returns the directory where incomplete uploads are assembled
+func tusDir() string {
+	pwd, err := os.Getwd()
+	if err != nil {
+		log.Println("Couldn't find current directory for resumable uploads:", err)
+	}
+
+	return filepath.Join(pwd, "cache", "uploads")
+}
+
+func tusFile(id, ext string) string {
+	return filepath.Join(tusDir(), id+ext)
+}
+
+// tusCleanup removes expired uploads every hour
+func tusCleanup() {
+	for {
+		infos, err := ioutil.ReadDir(tusDir())
+		if err != nil && !os.IsNotExist(err) {
+			log.Println("[Tus] error reading uploads for cleanup:", err)
+		}
+
+		for _, fi := range infos {
+			if !strings.HasSuffix(fi.Name(), ".json") {
+				continue
+			}
+
+			id := strings.TrimSuffix(fi.Name(), ".json")
+			tusMu.Lock()
+			active := tusActive[id]
+			tusMu.Unlock()
+
+			if _, err := loadTusUpload(id); err != nil && !active {
+				removeTusUpload(id)
+			}
+		}
+
+		time.Sleep(time.Hour)
+	}
+}
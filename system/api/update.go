@@ -29,7 +29,24 @@ func updateContentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if isJSON(req) {
+		updateContentJSON(res, req)
+		return
+	}
+
+	// uploads larger than the type allows are rejected before they are read
+	var rules interface{}
+	if p, ok := item.Types[req.URL.Query().Get("type")]; ok {
+		rules = p()
+	}
+	upload.LimitBody(res, req, rules)
+
 	err := req.ParseMultipartForm(1024 * 1024 * 4) // maxMemory 4MB
+	if upload.TooLarge(err) {
+		log.Println("[Update] request body too large from:", req.RemoteAddr)
+		res.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		log.Println("[Update] error:", err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -83,7 +100,12 @@ func updateContentHandler(res http.ResponseWriter, req *http.Request) {
 	req.PostForm.Set("timestamp", ts)
 	req.PostForm.Set("updated", ts)
 
-	urlPaths, err := upload.StoreFiles(req)
+	urlPaths, err := upload.StoreFilesFor(req, post)
+	if e, ok := err.(*upload.Error); ok {
+		log.Println(err, "from:", req.RemoteAddr)
+		http.Error(res, e.Error(), e.Status)
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -212,41 +234,216 @@ func updateContentHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// create JSON response to send data back to client
-	var data map[string]interface{}
-	if spec != "" {
-		spec = strings.TrimPrefix(spec, "__")
-		data = map[string]interface{}{
-			"status": spec,
-			"type":   t,
-		}
-	} else {
-		spec = "public"
-		data = map[string]interface{}{
-			"id":     id,
-			"status": spec,
-			"type":   t,
+	sendSaved(res, http.StatusOK, t, spec, id)
+}
+
+// updateContentJSON is the updateContentHandler for requests with a JSON body,
+// which is decoded over the existing content, so fields missing from the body
+// keep their values. Errors are described as JSON.
+func updateContentJSON(res http.ResponseWriter, req *http.Request) {
+	t := req.URL.Query().Get("type")
+	if t == "" {
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "missing_type",
+			Message: "The type query parameter is required",
+		})
+		return
+	}
+
+	_, found := item.Types[t]
+	if !found {
+		log.Println("[Update] attempt to update content unknown type:", t, "from:", req.RemoteAddr)
+		sendErrors(res, http.StatusNotFound, apiError{
+			Code:    "unknown_type",
+			Message: "Unknown content type: " + t,
+		})
+		return
+	}
+
+	id := req.URL.Query().Get("id")
+	if !db.IsValidID(id) {
+		log.Println("[Update] attempt to update content with missing or invalid id from:", req.RemoteAddr)
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "invalid_id",
+			Message: "The id query parameter must be a valid content id",
+		})
+		return
+	}
+
+	if updateJSON(res, req, t, id, false) {
+		sendSaved(res, http.StatusOK, t, "", id)
+	}
+}
+
+// updateJSON decodes the JSON body of req into the content of type t with the
+// id and saves it, calling the same interfaces and hooks as form requests. The
+// body replaces the content if replace is true, otherwise it is decoded over the
+// existing content. If the request has an If-Match header, the content is only
+// saved if its ETag matches. It returns false if the request failed, in which
+// case the response was already written.
+func updateJSON(res http.ResponseWriter, req *http.Request, t, id string, replace bool) bool {
+	p := item.Types[t]
+	post := p()
+	store := storeFor(req)
+
+	j, err := store.Content(t + ":" + id)
+	if err != nil {
+		log.Println("[Update] error getting content for type:", t, err)
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return false
+	}
+
+	if len(j) == 0 {
+		sendErrors(res, http.StatusNotFound, apiError{
+			Code:    "not_found",
+			Message: "No " + t + " content with id " + id,
+		})
+		return false
+	}
+
+	ifMatch := req.Header.Get("If-Match")
+	if ifMatch != "" && !matchETag(ifMatch, contentETag(j)) {
+		sendErrors(res, http.StatusPreconditionFailed, errChanged)
+		return false
+	}
+
+	// the body replaces the content, or is merged into it
+	if !replace {
+		err = json.Unmarshal(j, post)
+		if err != nil {
+			log.Println("[Update] error populating data in type:", t, err)
+			sendErrors(res, http.StatusInternalServerError, errInternal)
+			return false
 		}
 	}
 
-	resp := map[string]interface{}{
-		"data": []map[string]interface{}{
-			data,
-		},
+	ext, ok := post.(Updateable)
+	if !ok {
+		log.Println("[Update] rejected non-updateable type:", t, "from:", req.RemoteAddr)
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "not_updateable",
+			Message: "Content of type " + t + " cannot be updated",
+		})
+		return false
+	}
+
+	hook, ok := post.(item.Hookable)
+	if !ok {
+		log.Println("[Update] error: Type", t, "does not implement item.Hookable or embed item.Item.")
+		sendErrors(res, http.StatusBadRequest, apiError{
+			Code:    "not_updateable",
+			Message: "Content of type " + t + " cannot be updated",
+		})
+		return false
 	}
 
-	j, err = json.Marshal(resp)
+	// the Item fields can't be changed by the request body, so keep them to be
+	// restored after it is decoded
+	var existing struct {
+		UUID      json.RawMessage `json:"uuid"`
+		ID        json.RawMessage `json:"id"`
+		Slug      json.RawMessage `json:"slug"`
+		Timestamp json.RawMessage `json:"timestamp"`
+	}
+	err = json.Unmarshal(j, &existing)
 	if err != nil {
-		log.Println("[Update] error marshalling response to JSON:", err)
-		res.WriteHeader(http.StatusInternalServerError)
-		return
+		log.Println("[Update] error populating data in type:", t, err)
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return false
+	}
+
+	e := decodeJSON(req, post)
+	if e != nil {
+		log.Println("[Update] error decoding JSON body for type:", t, e.Message)
+		sendErrors(res, http.StatusBadRequest, *e)
+		return false
 	}
 
-	res.Header().Set("Content-Type", "application/json")
-	_, err = res.Write(j)
+	ts := int64(time.Nanosecond) * time.Now().UnixNano() / int64(time.Millisecond)
+	err = setItem(post, map[string]interface{}{
+		"uuid":      existing.UUID,
+		"id":        existing.ID,
+		"slug":      existing.Slug,
+		"timestamp": existing.Timestamp,
+		"updated":   ts,
+	})
 	if err != nil {
-		log.Println("[Update] error writing response:", err)
-		return
+		log.Println("[Update] error restoring item fields for type:", t, err)
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return false
+	}
+	req.PostForm.Set("updated", fmt.Sprintf("%d", ts))
+	form := copyForm(req.PostForm)
+
+	// hooks may write their own response, otherwise their error is sent
+	rec := &recordResponseWriter{ResponseWriter: res}
+
+	err = hook.BeforeAPIUpdate(rec, req)
+	if err != nil {
+		log.Println("[Update] error calling BeforeAPIUpdate:", err)
+		hookError(rec, err)
+		return false
+	}
+
+	err = ext.Update(rec, req)
+	if err != nil {
+		log.Println("[Update] error calling Update:", err)
+		hookError(rec, err)
+		return false
+	}
+
+	err = hook.BeforeSave(rec, req)
+	if err != nil {
+		log.Println("[Update] error calling BeforeSave:", err)
+		hookError(rec, err)
+		return false
+	}
+
+	err = decodeFormChanges(req, post, form)
+	if err != nil {
+		log.Println("[Update] error decoding post form changed by hooks for type:", t, err)
+		sendErrors(rec, http.StatusInternalServerError, errInternal)
+		return false
+	}
+
+	// compare with the content that was read, so no changes made since are lost
+	var prev []byte
+	if ifMatch != "" {
+		prev = j
+	}
+
+	_, err = store.SetContentItemIf(t+":"+id, post, prev)
+	if err == db.ErrContentChanged {
+		sendErrors(rec, http.StatusPreconditionFailed, errChanged)
+		return false
+	}
+	if err != nil {
+		log.Println("[Update] error calling SetContentItemIf:", err)
+		sendErrors(rec, http.StatusInternalServerError, errInternal)
+		return false
+	}
+
+	// set the target in the context so user can get saved value from db in hook
+	ctx := context.WithValue(req.Context(), "target", fmt.Sprintf("%s:%s", t, id))
+	req = req.WithContext(ctx)
+
+	after := func(res *recordResponseWriter) bool {
+		err := hook.AfterSave(res, req)
+		if err != nil {
+			log.Println("[Update] error calling AfterSave:", err)
+			hookError(res, err)
+			return false
+		}
+
+		err = hook.AfterAPIUpdate(res, req)
+		if err != nil {
+			log.Println("[Update] error calling AfterAPIUpdate:", err)
+			hookError(res, err)
+			return false
+		}
+
+		return true
 	}
 
+	return afterBatch(req, after) || after(rec)
 }
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+)
+
+// v2Path is the prefix of the RESTful content API, where content is addressed
+// by its path, /api/v2/{type} and /api/v2/{type}/{id}, and the request method
+// chooses what to do with it
+const v2Path = "/api/v2/"
+
+func v2Handler(res http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, v2Path), "/"), "/")
+	if len(parts) > 2 || parts[0] == "" {
+		sendErrors(res, http.StatusNotFound, apiError{
+			Code:    "not_found",
+			Message: "No API endpoint at " + req.URL.Path,
+		})
+		return
+	}
+
+	t := parts[0]
+	it, ok := item.Types[t]
+	if !ok {
+		sendErrors(res, http.StatusNotFound, apiError{
+			Code:    "unknown_type",
+			Message: "Unknown content type: " + t,
+		})
+		return
+	}
+
+	var id string
+	if len(parts) == 2 {
+		id = parts[1]
+		if !db.IsValidID(id) {
+			sendErrors(res, http.StatusNotFound, apiError{
+				Code:    "not_found",
+				Message: "No " + t + " content with id " + id,
+			})
+			return
+		}
+	}
+
+	methods := v2Methods(it(), id != "")
+	res.Header().Set("Allow", strings.Join(methods, ", "))
+
+	if req.Method == http.MethodOptions {
+		res.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		res.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, If-Match, If-None-Match, If-Modified-Since, X-Request-ID")
+		res.Header().Set("Access-Control-Expose-Headers", "ETag, Location, X-Request-ID")
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+
+	res.Header().Set("Access-Control-Expose-Headers", "ETag, Location, X-Request-ID")
+
+	allowed := false
+	for _, m := range methods {
+		if m == req.Method {
+			allowed = true
+		}
+	}
+	if !allowed {
+		sendErrors(res, http.StatusMethodNotAllowed, apiError{
+			Code:    "method_not_allowed",
+			Message: req.Method + " is not allowed for " + req.URL.Path,
+		})
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		if id == "" {
+			v2ListContents(res, req, t)
+		} else {
+			v2GetContent(res, req, t, id)
+		}
+
+	case http.MethodPost:
+		if !requireJSON(res, req) {
+			return
+		}
+
+		cid, spec, ok := createJSON(res, req, t)
+		if !ok {
+			return
+		}
+
+		// pending content has no public location until it is approved
+		if spec != "" {
+			sendSaved(res, http.StatusAccepted, t, spec, cid)
+			return
+		}
+
+		res.Header().Set("Location", v2Path+t+"/"+strconv.Itoa(cid))
+		setContentETag(res, req, t, strconv.Itoa(cid))
+		sendSaved(res, http.StatusCreated, t, spec, cid)
+
+	case http.MethodPut, http.MethodPatch:
+		if !requireJSON(res, req) {
+			return
+		}
+
+		if !updateJSON(res, req, t, id, req.Method == http.MethodPut) {
+			return
+		}
+
+		setContentETag(res, req, t, id)
+		sendSaved(res, http.StatusOK, t, "", id)
+
+	case http.MethodDelete:
+		if !deleteJSON(res, req, t, id) {
+			return
+		}
+
+		sendDeleted(res, t, id)
+	}
+}
+
+// v2Methods returns the methods allowed for the content it, which are those of
+// its collection unless single
+func v2Methods(it interface{}, single bool) []string {
+	methods := []string{http.MethodGet, http.MethodHead}
+	if !single {
+		if _, ok := it.(Createable); ok {
+			methods = append(methods, http.MethodPost)
+		}
+	} else {
+		if _, ok := it.(Updateable); ok {
+			methods = append(methods, http.MethodPut, http.MethodPatch)
+		}
+
+		if _, ok := it.(Deleteable); ok {
+			methods = append(methods, http.MethodDelete)
+		}
+	}
+
+	return append(methods, http.MethodOptions)
+}
+
+// requireJSON responds with an error unless the request body is JSON, which is
+// the only encoding the v2 API accepts
+func requireJSON(res http.ResponseWriter, req *http.Request) bool {
+	if isJSON(req) {
+		return true
+	}
+
+	sendErrors(res, http.StatusUnsupportedMediaType, apiError{
+		Code:    "unsupported_media_type",
+		Message: "Request body must be sent with Content-Type: application/json",
+	})
+	return false
+}
+
+// setContentETag sets the ETag of the content of type t with the id, after it
+// was saved, so clients can use it in If-Match headers
+func setContentETag(res http.ResponseWriter, req *http.Request, t, id string) {
+	j, err := storeFor(req).Content(t + ":" + id)
+	if err != nil || len(j) == 0 {
+		return
+	}
+
+	res.Header().Set("ETag", contentETag(j))
+}
+
+func v2ListContents(res http.ResponseWriter, req *http.Request, t string) {
+	it := item.Types[t]
+
+	hidden, err := isHidden(res, req, it())
+	if err != nil {
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return
+	}
+	if hidden {
+		sendErrors(res, http.StatusNotFound, apiError{
+			Code:    "unknown_type",
+			Message: "Unknown content type: " + t,
+		})
+		return
+	}
+
+	q := req.URL.Query()
+	count := 10 // int: determines number of posts to return (-1 is all)
+	if c := q.Get("count"); c != "" {
+		count, err = strconv.Atoi(c)
+		if err != nil || count < -1 {
+			sendErrors(res, http.StatusBadRequest, apiError{
+				Code:    "invalid_parameter",
+				Message: "count must be -1 or more",
+				Field:   "count",
+			})
+			return
+		}
+	}
+
+	offset := 0 // int: multiplier of count for pagination
+	if o := q.Get("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			sendErrors(res, http.StatusBadRequest, apiError{
+				Code:    "invalid_parameter",
+				Message: "offset must be 0 or more",
+				Field:   "offset",
+			})
+			return
+		}
+	}
+
+	order := strings.ToLower(q.Get("order")) // string: sort order of posts by timestamp ASC / DESC (DESC default)
+	if order != "asc" {
+		order = "desc"
+	}
+
+	// a cursor continues a list from the page after the one it was sent with,
+	// in place of count, offset and order
+	if cur := q.Get("cursor"); cur != "" {
+		c, ok := decodeCursor(cur)
+		if !ok {
+			sendErrors(res, http.StatusBadRequest, apiError{
+				Code:    "invalid_parameter",
+				Message: "cursor is not valid",
+				Field:   "cursor",
+			})
+			return
+		}
+
+		count, offset, order = c.Count, c.Offset, c.Order
+	}
+
+	res.Header().Set("Cache-Control", db.CachePolicy())
+	etag, modified := collectionETag(t, q)
+	if notModified(res, req, etag, modified) {
+		return
+	}
+
+	opts := db.QueryOptions{
+		Count:  count,
+		Offset: offset,
+		Order:  order,
+	}
+
+	total, bb := db.Query(t+"__sorted", opts)
+	var result = []json.RawMessage{}
+	for i := range bb {
+		result = append(result, bb[i])
+	}
+
+	j, err := fmtJSON(result...)
+	if err != nil {
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	j, err = omit(res, req, it(), j)
+	if err != nil {
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	n := len(bb)
+	m := &meta{Total: &total, Count: &n}
+	if count > 0 && (offset+1)*count < total {
+		m.Next = encodeCursor(cursor{
+			Count:  count,
+			Offset: offset + 1,
+			Order:  order,
+		})
+	}
+
+	sendData(res, req, withMeta(res, j, m))
+}
+
+func v2GetContent(res http.ResponseWriter, req *http.Request, t, id string) {
+	post, err := storeFor(req).Content(t + ":" + id)
+	if err != nil {
+		log.Println("Error getting content:", t+":"+id, err)
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	notFound := apiError{
+		Code:    "not_found",
+		Message: "No " + t + " content with id " + id,
+	}
+
+	if len(post) == 0 {
+		sendErrors(res, http.StatusNotFound, notFound)
+		return
+	}
+
+	p := item.Types[t]()
+	err = json.Unmarshal(post, p)
+	if err != nil {
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	hidden, err := isHidden(res, req, p)
+	if err != nil {
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return
+	}
+	if hidden {
+		sendErrors(res, http.StatusNotFound, notFound)
+		return
+	}
+
+	res.Header().Set("Cache-Control", db.CachePolicy())
+	if notModified(res, req, contentETag(post), updated(post)) {
+		return
+	}
+
+	push(res, req, p, post)
+
+	j, err := fmtJSON(json.RawMessage(post))
+	if err != nil {
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	j, err = omit(res, req, p, j)
+	if err != nil {
+		sendErrors(res, http.StatusInternalServerError, errInternal)
+		return
+	}
+
+	sendData(res, req, withMeta(res, j, nil))
+}
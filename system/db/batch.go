@@ -0,0 +1,340 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/ponzu-cms/ponzu/system/item"
+	"github.com/ponzu-cms/ponzu/system/search"
+
+	"github.com/boltdb/bolt"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Tx is a transaction in which content is read and written, so that all of its
+// changes are saved together, or none of them are
+type Tx struct {
+	tx *bolt.Tx
+
+	// after holds the work to do once the changes are saved, such as updating
+	// the search index and sorted content
+	after []func() error
+}
+
+// Batch calls fn with a new transaction, and saves the changes made in it if fn
+// returns nil. If fn returns an error, none of the changes are saved.
+//
+// Only one transaction can change the database at a time, so fn must not call
+// functions which change the database outside of the transaction, such as
+// SetContent, or it will wait forever.
+func Batch(fn func(tx *Tx) error) error {
+	t := &Tx{}
+	err := store.Update(func(tx *bolt.Tx) error {
+		t.tx = tx
+		return fn(t)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, after := range t.after {
+		e := after()
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// After adds fn to the work done once the changes made in the transaction are
+// saved, in the order it is added. If they aren't saved, fn isn't called.
+func (t *Tx) After(fn func()) {
+	t.after = append(t.after, func() error {
+		fn()
+		return nil
+	})
+}
+
+// Content retrives one item from the transaction, including changes made in it.
+// Non-existent values will return an empty []byte. The `target` argument is a
+// string made up of namespace:id (string:int)
+func (t *Tx) Content(target string) ([]byte, error) {
+	ns, id := splitTarget(target)
+
+	b := t.tx.Bucket([]byte(ns))
+	if b == nil {
+		return nil, bolt.ErrBucketNotFound
+	}
+
+	// values are only valid during the transaction, so are copied
+	return append([]byte{}, b.Get([]byte(id))...), nil
+}
+
+// SetContentItem inserts/replaces the content post in the transaction, like the
+// SetContentItem function
+func (t *Tx) SetContentItem(target string, post interface{}) (int, error) {
+	return t.SetContentItemIf(target, post, nil)
+}
+
+// SetContentItemIf replaces the content post in the transaction, like the
+// SetContentItemIf function
+func (t *Tx) SetContentItemIf(target string, post interface{}, prev []byte) (int, error) {
+	ns, id := splitTarget(target)
+
+	if id == "-1" {
+		return t.insert(ns, func(tx *bolt.Tx, cid string, uid uuid.UUID, specifier string) ([]byte, string, error) {
+			return itemToJSON(tx, post, cid, uid, specifier)
+		})
+	}
+
+	if !IsValidID(id) {
+		return 0, fmt.Errorf("Invalid ID in target for SetContentItem: %s", target)
+	}
+
+	var specifier string // i.e. __pending, __sorted, etc.
+	if strings.Contains(ns, "__") {
+		spec := strings.Split(ns, "__")
+		ns = spec[0]
+		specifier = "__" + spec[1]
+	}
+
+	cid, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, err
+	}
+
+	j, err := json.Marshal(post)
+	if err != nil {
+		return 0, err
+	}
+
+	err = t.put(ns, specifier, cid, j, prev)
+	if err != nil {
+		return 0, err
+	}
+
+	return cid, nil
+}
+
+// DeleteContent removes an item from the transaction, like the DeleteContent
+// function
+func (t *Tx) DeleteContent(target string) error {
+	return t.DeleteContentIf(target, nil)
+}
+
+// DeleteContentIf removes an item from the transaction if it is still equal to
+// prev, like the DeleteContentIf function
+func (t *Tx) DeleteContentIf(target string, prev []byte) error {
+	ns, id := splitTarget(target)
+
+	b := t.tx.Bucket([]byte(ns))
+	if b == nil {
+		return bolt.ErrBucketNotFound
+	}
+
+	// get content slug to delete from __contentIndex if it exists
+	// this way content added later can use slugs even if previously
+	// deleted content had used one
+	j := append([]byte{}, b.Get([]byte(id))...)
+
+	if prev != nil && !bytes.Equal(j, prev) {
+		return ErrContentChanged
+	}
+
+	var itm item.Item
+	err := json.Unmarshal(j, &itm)
+	if err != nil {
+		return err
+	}
+
+	err = b.Delete([]byte(id))
+	if err != nil {
+		return err
+	}
+
+	err = deleteUploadRefs(t.tx, target)
+	if err != nil {
+		return err
+	}
+
+	// if content has a slug, also delete it from __contentIndex
+	if itm.Slug != "" {
+		ci := t.tx.Bucket([]byte("__contentIndex"))
+		if ci == nil {
+			return bolt.ErrBucketNotFound
+		}
+
+		err := ci.Delete([]byte(itm.Slug))
+		if err != nil {
+			return err
+		}
+	}
+
+	t.after = append(t.after, func() error {
+		if !strings.Contains(ns, "__") {
+			touchContent(ns)
+			events.publish("delete", ns, id, j)
+		}
+
+		// delete changes data, so invalidate client caching
+		err := InvalidateCache()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			// delete indexed data from search index
+			if !strings.Contains(ns, "__") {
+				err := search.DeleteIndex(fmt.Sprintf("%s:%s", ns, id))
+				if err != nil {
+					log.Println("[search] DeleteIndex Error:", err)
+				}
+			}
+		}()
+
+		// exception to typical "run in goroutine" pattern:
+		// we want to have an updated admin view as soon as this is deleted, so
+		// in some cases, the delete and redirect is faster than the sort,
+		// thus still showing a deleted post in the admin view.
+		SortContent(ns)
+
+		return nil
+	})
+
+	return nil
+}
+
+// put stores the JSON encoded content j with the id cid in the bucket for ns and
+// its specifier, replacing any content with the same id. If prev is not nil, j
+// is only stored if the existing content is still equal to prev.
+func (t *Tx) put(ns, specifier string, cid int, j, prev []byte) error {
+	b, err := t.tx.CreateBucketIfNotExists([]byte(ns + specifier))
+	if err != nil {
+		return err
+	}
+
+	if prev != nil && !bytes.Equal(b.Get([]byte(fmt.Sprintf("%d", cid))), prev) {
+		return ErrContentChanged
+	}
+
+	err = b.Put([]byte(fmt.Sprintf("%d", cid)), j)
+	if err != nil {
+		return err
+	}
+
+	err = putUploadRefs(t.tx, fmt.Sprintf("%s%s:%d", ns, specifier, cid), j)
+	if err != nil {
+		return err
+	}
+
+	t.saved("update", ns, specifier, fmt.Sprintf("%d", cid), j)
+	return nil
+}
+
+// insert assigns the next id and a new UUID to content in ns, which encode
+// uses to return the content as JSON along with its slug, checking slugs
+// against the transaction rather than the db, which it can't see into
+func (t *Tx) insert(ns string, encode func(tx *bolt.Tx, cid string, uid uuid.UUID, specifier string) ([]byte, string, error)) (int, error) {
+	var specifier string // i.e. __pending, __sorted, etc.
+	if strings.Contains(ns, "__") {
+		spec := strings.Split(ns, "__")
+		ns = spec[0]
+		specifier = "__" + spec[1]
+	}
+
+	b, err := t.tx.CreateBucketIfNotExists([]byte(ns + specifier))
+	if err != nil {
+		return 0, err
+	}
+
+	// get the next available ID and convert to string
+	// also set effectedID to int of ID
+	id, err := b.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	cid := strconv.FormatUint(id, 10)
+	effectedID, err := strconv.Atoi(cid)
+	if err != nil {
+		return 0, err
+	}
+
+	// add UUID to data for use in embedded Item
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return 0, err
+	}
+
+	j, slug, err := encode(t.tx, cid, uid, specifier)
+	if err != nil {
+		return 0, err
+	}
+
+	err = b.Put([]byte(cid), j)
+	if err != nil {
+		return 0, err
+	}
+
+	err = putUploadRefs(t.tx, ns+specifier+":"+cid, j)
+	if err != nil {
+		return 0, err
+	}
+
+	// store the slug,type:id in contentIndex if public content
+	if specifier == "" {
+		ci := t.tx.Bucket([]byte("__contentIndex"))
+		if ci == nil {
+			return 0, bolt.ErrBucketNotFound
+		}
+
+		k := []byte(slug)
+		v := []byte(fmt.Sprintf("%s:%d", ns, effectedID))
+		err := ci.Put(k, v)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	t.saved("create", ns, specifier, cid, j)
+	return effectedID, nil
+}
+
+// saved updates the sorted content, client caches and search index for the
+// content j once the transaction is saved, and publishes the action taken
+func (t *Tx) saved(action, ns, specifier, cid string, j []byte) {
+	t.after = append(t.after, func() error {
+		if specifier == "" {
+			go SortContent(ns)
+			touchContent(ns)
+			events.publish(action, ns, cid, j)
+		}
+
+		// changes to data invalidate client caching
+		err := InvalidateCache()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			// update data in search index
+			target := fmt.Sprintf("%s:%s", ns, cid)
+			err := search.UpdateIndex(target, j)
+			if err != nil {
+				log.Println("[search] UpdateIndex Error:", err)
+			}
+		}()
+
+		return nil
+	})
+}
+
+// splitTarget returns the namespace and id of a target made up of namespace:id
+func splitTarget(target string) (string, string) {
+	t := strings.Split(target, ":")
+	return t[0], t[1]
+}
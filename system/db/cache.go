@@ -5,25 +5,22 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
-// CacheControl sets the default cache policy on static asset responses
+// CacheControl sets the default cache policy on static asset responses, with an
+// ETag which changes whenever any content does
 func CacheControl(next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 		cacheDisabled := ConfigCache("cache_disabled").(bool)
 		if cacheDisabled {
-			res.Header().Add("Cache-Control", "no-cache")
+			res.Header().Add("Cache-Control", CachePolicy())
 			next.ServeHTTP(res, req)
 		} else {
-			age := int64(ConfigCache("cache_max_age").(float64))
 			etag := ConfigCache("etag").(string)
-			if age == 0 {
-				age = DefaultMaxAge
-			}
-			policy := fmt.Sprintf("max-age=%d, public", age)
 			res.Header().Add("ETag", etag)
-			res.Header().Add("Cache-Control", policy)
+			res.Header().Add("Cache-Control", CachePolicy())
 
 			if match := req.Header.Get("If-None-Match"); match != "" {
 				if strings.Contains(match, etag) {
@@ -37,9 +34,24 @@ func CacheControl(next http.Handler) http.HandlerFunc {
 	})
 }
 
+// CachePolicy returns the Cache-Control header value set by the cache config
+func CachePolicy() string {
+	if disabled, _ := ConfigCache("cache_disabled").(bool); disabled {
+		return "no-cache"
+	}
+
+	maxAge, _ := ConfigCache("cache_max_age").(float64)
+	age := int64(maxAge)
+	if age == 0 {
+		age = DefaultMaxAge
+	}
+
+	return fmt.Sprintf("max-age=%d, public", age)
+}
+
 // NewEtag generates a new Etag for response caching
 func NewEtag() string {
-	now := fmt.Sprintf("%d", time.Now().Unix())
+	now := fmt.Sprintf("%d", time.Now().UnixNano())
 	etag := base64.StdEncoding.EncodeToString([]byte(now))
 
 	return etag
@@ -54,3 +66,55 @@ func InvalidateCache() error {
 
 	return nil
 }
+
+// contentVersion identifies the state of the content of a type, and when it
+// last changed
+type contentVersion struct {
+	id       uint64
+	modified time.Time
+}
+
+var versions = struct {
+	sync.Mutex
+	started contentVersion
+	types   map[string]contentVersion
+}{
+	// ids start from the time, so they are different after a restart
+	started: contentVersion{id: uint64(time.Now().UnixNano()), modified: time.Now()},
+	types:   make(map[string]contentVersion),
+}
+
+// ContentVersion returns a number which changes each time the public content of
+// type ns is changed or sorted, and when it last changed, so responses listing
+// the content can be cached until then. Until content of the type is changed,
+// it is the time Ponzu started.
+func ContentVersion(ns string) (uint64, time.Time) {
+	versions.Lock()
+	defer versions.Unlock()
+
+	v, ok := versions.types[ns]
+	if !ok {
+		v = versions.started
+	}
+
+	return v.id, v.modified
+}
+
+// touchContent sets a new version for the content of type ns
+func touchContent(ns string) {
+	versions.Lock()
+	defer versions.Unlock()
+
+	now := time.Now()
+	v := contentVersion{id: uint64(now.UnixNano()), modified: now}
+
+	prev, ok := versions.types[ns]
+	if !ok {
+		prev = versions.started
+	}
+	if v.id <= prev.id {
+		v.id = prev.id + 1
+	}
+
+	versions.types[ns] = v
+}
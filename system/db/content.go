@@ -3,6 +3,7 @@ package db
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
@@ -13,7 +14,6 @@ import (
 	"time"
 
 	"github.com/ponzu-cms/ponzu/system/item"
-	"github.com/ponzu-cms/ponzu/system/search"
 
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/schema"
@@ -68,6 +68,36 @@ func UpdateContent(target string, data url.Values) (int, error) {
 	return update(ns, id, data, &existingContent)
 }
 
+// ErrContentChanged is returned by SetContentItemIf and DeleteContentIf when the
+// content was changed since it was read
+var ErrContentChanged = errors.New("Content was changed since it was read")
+
+// SetContentItem inserts/replaces the content post in the database, for content
+// which was decoded into its type rather than from form values, such as from a
+// JSON request body. The `target` argument is a string made up of namespace:id
+// (string:int), and new content (id -1) is assigned its id, uuid and slug.
+func SetContentItem(target string, post interface{}) (int, error) {
+	return SetContentItemIf(target, post, nil)
+}
+
+// SetContentItemIf replaces the content post in the database like SetContentItem,
+// but only if the existing content is still equal to prev, which was read before
+// it was changed. Otherwise, ErrContentChanged is returned. A nil prev replaces
+// the content unconditionally.
+func SetContentItemIf(target string, post interface{}, prev []byte) (int, error) {
+	var id int
+	err := Batch(func(tx *Tx) error {
+		var err error
+		id, err = tx.SetContentItemIf(target, post, prev)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
 // update can support merge or replace behavior depending on existingContent.
 // if existingContent is non-nil, we merge field values. empty/missing fields are ignored.
 // if existingContent is nil, we replace field values. empty/missing fields are reset.
@@ -84,55 +114,26 @@ func update(ns, id string, data url.Values, existingContent *[]byte) (int, error
 		return 0, err
 	}
 
-	var j []byte
-	if existingContent == nil {
-		j, err = postToJSON(ns, data)
-		if err != nil {
-			return 0, err
-		}
-	} else {
-		j, err = mergeData(ns, data, *existingContent)
-		if err != nil {
-			return 0, err
+	// content is encoded in the transaction it is stored in, so that a slug it
+	// is given can't be taken by other content in the meantime
+	err = Batch(func(tx *Tx) error {
+		var j []byte
+		var err error
+		if existingContent == nil {
+			j, err = postToJSON(tx.tx, ns, data)
+		} else {
+			j, err = mergeData(ns, data, *existingContent)
 		}
-	}
-
-	err = store.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(ns + specifier))
 		if err != nil {
 			return err
 		}
 
-		err = b.Put([]byte(fmt.Sprintf("%d", cid)), j)
-		if err != nil {
-			return err
-		}
-
-		return nil
+		return tx.put(ns, specifier, cid, j, nil)
 	})
-	if err != nil {
-		return 0, nil
-	}
-
-	if specifier == "" {
-		go SortContent(ns)
-	}
-
-	// update changes data, so invalidate client caching
-	err = InvalidateCache()
 	if err != nil {
 		return 0, err
 	}
 
-	go func() {
-		// update data in search index
-		target := fmt.Sprintf("%s:%s", ns, id)
-		err = search.UpdateIndex(target, j)
-		if err != nil {
-			log.Println("[search] UpdateIndex Error:", err)
-		}
-	}()
-
 	return cid, nil
 }
 
@@ -173,41 +174,8 @@ func mergeData(ns string, data url.Values, existingContent []byte) ([]byte, erro
 }
 
 func insert(ns string, data url.Values) (int, error) {
-	var effectedID int
-	var specifier string // i.e. __pending, __sorted, etc.
-	if strings.Contains(ns, "__") {
-		spec := strings.Split(ns, "__")
-		ns = spec[0]
-		specifier = "__" + spec[1]
-	}
-
-	var j []byte
-	var cid string
-	err := store.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(ns + specifier))
-		if err != nil {
-			return err
-		}
-
-		// get the next available ID and convert to string
-		// also set effectedID to int of ID
-		id, err := b.NextSequence()
-		if err != nil {
-			return err
-		}
-		cid = strconv.FormatUint(id, 10)
-		effectedID, err = strconv.Atoi(cid)
-		if err != nil {
-			return err
-		}
+	return insertWith(ns, func(tx *bolt.Tx, cid string, uid uuid.UUID, specifier string) ([]byte, string, error) {
 		data.Set("id", cid)
-
-		// add UUID to data for use in embedded Item
-		uid, err := uuid.NewV4()
-		if err != nil {
-			return err
-		}
-
 		data.Set("uuid", uid.String())
 
 		// if type has a specifier, add it to data for downstream processing
@@ -215,133 +183,45 @@ func insert(ns string, data url.Values) (int, error) {
 			data.Set("__specifier", specifier)
 		}
 
-		j, err = postToJSON(ns, data)
-		if err != nil {
-			return err
-		}
-
-		err = b.Put([]byte(cid), j)
+		j, err := postToJSON(tx, ns, data)
 		if err != nil {
-			return err
-		}
-
-		// store the slug,type:id in contentIndex if public content
-		if specifier == "" {
-			ci := tx.Bucket([]byte("__contentIndex"))
-			if ci == nil {
-				return bolt.ErrBucketNotFound
-			}
-
-			k := []byte(data.Get("slug"))
-			v := []byte(fmt.Sprintf("%s:%d", ns, effectedID))
-			err := ci.Put(k, v)
-			if err != nil {
-				return err
-			}
+			return nil, "", err
 		}
 
-		return nil
+		return j, data.Get("slug"), nil
 	})
-	if err != nil {
-		return 0, err
-	}
-
-	if specifier == "" {
-		go SortContent(ns)
-	}
+}
 
-	// insert changes data, so invalidate client caching
-	err = InvalidateCache()
+// insertWith assigns the next id and a new UUID to content in ns, which encode
+// uses to return the content as JSON along with its slug, checking slugs
+// against the transaction it is stored in
+func insertWith(ns string, encode func(tx *bolt.Tx, cid string, uid uuid.UUID, specifier string) ([]byte, string, error)) (int, error) {
+	var id int
+	err := Batch(func(tx *Tx) error {
+		var err error
+		id, err = tx.insert(ns, encode)
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	go func() {
-		// add data to search index
-		target := fmt.Sprintf("%s:%s", ns, cid)
-		err = search.UpdateIndex(target, j)
-		if err != nil {
-			log.Println("[search] UpdateIndex Error:", err)
-		}
-	}()
-
-	return effectedID, nil
+	return id, nil
 }
 
 // DeleteContent removes an item from the database. Deleting a non-existent item
 // will return a nil error.
 func DeleteContent(target string) error {
-	t := strings.Split(target, ":")
-	ns, id := t[0], t[1]
-
-	b, err := Content(target)
-	if err != nil {
-		return err
-	}
-
-	// get content slug to delete from __contentIndex if it exists
-	// this way content added later can use slugs even if previously
-	// deleted content had used one
-	var itm item.Item
-	err = json.Unmarshal(b, &itm)
-	if err != nil {
-		return err
-	}
-
-	err = store.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(ns))
-		if b == nil {
-			return bolt.ErrBucketNotFound
-		}
-
-		err := b.Delete([]byte(id))
-		if err != nil {
-			return err
-		}
-
-		// if content has a slug, also delete it from __contentIndex
-		if itm.Slug != "" {
-			ci := tx.Bucket([]byte("__contentIndex"))
-			if ci == nil {
-				return bolt.ErrBucketNotFound
-			}
-
-			err := ci.Delete([]byte(itm.Slug))
-			if err != nil {
-				return err
-			}
-		}
+	return DeleteContentIf(target, nil)
+}
 
-		return nil
+// DeleteContentIf removes an item from the database like DeleteContent, but only
+// if it is still equal to prev, which was read before. Otherwise,
+// ErrContentChanged is returned. A nil prev removes the item unconditionally.
+func DeleteContentIf(target string, prev []byte) error {
+	return Batch(func(tx *Tx) error {
+		return tx.DeleteContentIf(target, prev)
 	})
-	if err != nil {
-		return err
-	}
-
-	// delete changes data, so invalidate client caching
-	err = InvalidateCache()
-	if err != nil {
-		return err
-	}
-
-	go func() {
-		// delete indexed data from search index
-		if !strings.Contains(ns, "__") {
-			target = fmt.Sprintf("%s:%s", ns, id)
-			err = search.DeleteIndex(target)
-			if err != nil {
-				log.Println("[search] DeleteIndex Error:", err)
-			}
-		}
-	}()
-
-	// exception to typical "run in goroutine" pattern:
-	// we want to have an updated admin view as soon as this is deleted, so
-	// in some cases, the delete and redirect is faster than the sort,
-	// thus still showing a deleted post in the admin view.
-	SortContent(ns)
-
-	return nil
 }
 
 // Content retrives one item from the database. Non-existent values will return an empty []byte
@@ -454,6 +334,24 @@ func ContentAll(namespace string) [][]byte {
 	return posts
 }
 
+// ContentCount returns the number of items stored within the provided namespace,
+// which is 0 if nothing has been stored in it
+func ContentCount(namespace string) (int, error) {
+	var n int
+	err := store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(namespace))
+		if b == nil {
+			return nil
+		}
+
+		n = b.Stats().KeyN
+
+		return nil
+	})
+
+	return n, err
+}
+
 // QueryOptions holds options for a query
 type QueryOptions struct {
 	Count  int
@@ -689,8 +587,11 @@ func SortContent(namespace string) {
 	})
 	if err != nil {
 		log.Println("Error while updating db with sorted", namespace, err)
+		return
 	}
 
+	// lists of the content are read from the sorted bucket, so have changed
+	touchContent(namespace)
 }
 
 type sortableContent []item.Sortable
@@ -707,7 +608,10 @@ func (s sortableContent) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
-func postToJSON(ns string, data url.Values) ([]byte, error) {
+// postToJSON decodes the form values data into the content type ns and returns
+// it as JSON. Public content without a slug is given one which no other content
+// in tx has.
+func postToJSON(tx *bolt.Tx, ns string, data url.Values) ([]byte, error) {
 	// find the content type and decode values into it
 	t, ok := item.Types[ns]
 	if !ok {
@@ -778,7 +682,7 @@ func postToJSON(ns string, data url.Values) ([]byte, error) {
 			return nil, err
 		}
 
-		slug, err = checkSlugForDuplicate(slug)
+		slug, err = checkSlugForDuplicate(tx, slug)
 		if err != nil {
 			return nil, err
 		}
@@ -796,31 +700,67 @@ func postToJSON(ns string, data url.Values) ([]byte, error) {
 	return j, nil
 }
 
-func checkSlugForDuplicate(slug string) (string, error) {
-	// check for existing slug in __contentIndex
-	err := store.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("__contentIndex"))
-		if b == nil {
-			return bolt.ErrBucketNotFound
+// itemToJSON sets the id, uuid and, for public content without one, a slug no
+// other content in tx has, of the new content post and returns it encoded as
+// JSON with its slug
+func itemToJSON(tx *bolt.Tx, post interface{}, cid string, uid uuid.UUID, specifier string) ([]byte, string, error) {
+	ident, ok := post.(item.Identifiable)
+	if !ok {
+		return nil, "", fmt.Errorf("Content type %T does not embed item.Item", post)
+	}
+
+	id, err := strconv.Atoi(cid)
+	if err != nil {
+		return nil, "", err
+	}
+	ident.SetItemID(id)
+
+	// there is no setter for the UUID, so set it by the embedded Item's field
+	err = json.Unmarshal([]byte(`{"uuid":"`+uid.String()+`"}`), post)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sluggable, ok := post.(item.Sluggable)
+	if !ok {
+		return nil, "", fmt.Errorf("Content type %T does not embed item.Item", post)
+	}
+
+	slug := sluggable.ItemSlug()
+	if slug == "" && specifier == "" {
+		slug, err = item.Slug(ident)
+		if err != nil {
+			return nil, "", err
 		}
-		original := slug
-		exists := true
-		i := 0
-		for exists {
-			s := b.Get([]byte(slug))
-			if s == nil {
-				exists = false
-				return nil
-			}
 
-			i++
-			slug = fmt.Sprintf("%s-%d", original, i)
+		slug, err = checkSlugForDuplicate(tx, slug)
+		if err != nil {
+			return nil, "", err
 		}
 
-		return nil
-	})
+		sluggable.SetSlug(slug)
+	}
+
+	j, err := json.Marshal(post)
 	if err != nil {
-		return "", err
+		return nil, "", err
+	}
+
+	return j, slug, nil
+}
+
+// checkSlugForDuplicate returns slug, with a number added to it if content in tx
+// already has it
+func checkSlugForDuplicate(tx *bolt.Tx, slug string) (string, error) {
+	// check for existing slug in __contentIndex
+	b := tx.Bucket([]byte("__contentIndex"))
+	if b == nil {
+		return "", bolt.ErrBucketNotFound
+	}
+
+	original := slug
+	for i := 1; b.Get([]byte(slug)) != nil; i++ {
+		slug = fmt.Sprintf("%s-%d", original, i)
 	}
 
 	return slug, nil
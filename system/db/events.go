@@ -0,0 +1,123 @@
+package db
+
+import (
+	"sync"
+	"time"
+)
+
+// maxContentEvents is the number of past content events kept, so clients which
+// reconnect can be sent the changes they missed
+const maxContentEvents = 1000
+
+// ContentEvent describes a change to public content, after it was saved
+type ContentEvent struct {
+	// ID increases with each event, including across restarts
+	ID uint64
+
+	// Action is one of "create", "update" or "delete"
+	Action string
+
+	// Type and ContentID identify the content which changed
+	Type      string
+	ContentID string
+
+	// Data is the content as JSON, as it was saved, or before it was deleted
+	Data []byte
+}
+
+var events = &contentEvents{
+	// ids start from the time, so they continue to increase after a restart
+	// and ids from before it aren't mistaken for new events
+	next: uint64(time.Now().UnixNano()),
+	subs: make(map[chan ContentEvent]struct{}),
+}
+
+// contentEvents holds the recent content events, and the channels of those
+// watching for new ones
+type contentEvents struct {
+	mu   sync.Mutex
+	next uint64
+	log  []ContentEvent
+	subs map[chan ContentEvent]struct{}
+}
+
+// publish adds a new event for the content, and sends it to the watchers. A
+// watcher which isn't keeping up is closed, so it can reconnect and be sent
+// the events it missed.
+func (e *contentEvents) publish(action, ns, id string, data []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ev := ContentEvent{
+		ID:        e.next,
+		Action:    action,
+		Type:      ns,
+		ContentID: id,
+		Data:      data,
+	}
+	e.next++
+
+	e.log = append(e.log, ev)
+	if len(e.log) > maxContentEvents {
+		e.log = append([]ContentEvent{}, e.log[len(e.log)-maxContentEvents:]...)
+	}
+
+	for ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// WatchContent returns the channel of content events after lastID, including
+// those which already happened, and a func to stop watching. The channel is
+// closed if the watcher doesn't keep up with events. A lastID of 0 only watches
+// for new events. If the events after lastID are no longer known, such as after
+// a restart, WatchContent returns false and only watches for new events.
+func WatchContent(lastID uint64) (<-chan ContentEvent, func(), bool) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	var missed []ContentEvent
+	ok := true
+	if lastID != 0 {
+		switch {
+		case lastID >= events.next:
+			ok = false
+
+		case len(events.log) == 0:
+			ok = lastID == events.next-1
+
+		case lastID < events.log[0].ID-1:
+			ok = false
+
+		default:
+			for _, ev := range events.log {
+				if ev.ID > lastID {
+					missed = append(missed, ev)
+				}
+			}
+		}
+	}
+
+	ch := make(chan ContentEvent, len(missed)+64)
+	for _, ev := range missed {
+		ch <- ev
+	}
+	events.subs[ch] = struct{}{}
+
+	stop := func() {
+		events.mu.Lock()
+		defer events.mu.Unlock()
+
+		if _, ok := events.subs[ch]; ok {
+			delete(events.subs, ch)
+			close(ch)
+		}
+	}
+
+	return ch, stop, ok
+}
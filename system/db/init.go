@@ -4,6 +4,8 @@
 package db
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 
 	"github.com/ponzu-cms/ponzu/system/item"
@@ -81,6 +83,11 @@ func Init() {
 		log.Fatalln("Coudn't initialize db with buckets.", err)
 	}
 
+	err = indexUploadPaths()
+	if err != nil {
+		log.Fatalln("Couldn't index uploads by path.", err)
+	}
+
 	err = LoadCacheConfig()
 	if err != nil {
 		log.Fatalln("Failed to load config cache.", err)
@@ -117,6 +124,50 @@ func InitSearchIndex() {
 			return
 		}
 		SortContent(t)
+		reindexIfEmpty(t, ContentAll(t))
+	}
+
+	// file uploads are always indexed, so they can be searched in the admin
+	err := search.MapIndex("__uploads")
+	if err != nil {
+		log.Fatalln(err)
+		return
+	}
+	reindexIfEmpty("__uploads", UploadAll())
+}
+
+// reindexIfEmpty adds all of the data provided to the namespace's search index
+// if the index contains no documents, such as when it has just been created for
+// a namespace which already has data stored
+func reindexIfEmpty(namespace string, all [][]byte) {
+	idx, ok := search.Search[namespace]
+	if !ok || len(all) == 0 {
+		return
+	}
+
+	n, err := idx.DocCount()
+	if err != nil {
+		log.Println("[search] DocCount Error:", err)
+		return
+	}
+
+	if n > 0 {
+		return
+	}
+
+	for i := range all {
+		var itm item.Item
+		err := json.Unmarshal(all[i], &itm)
+		if err != nil {
+			log.Println("Error decoding json while indexing", namespace, ":", err)
+			continue
+		}
+
+		target := fmt.Sprintf("%s:%d", namespace, itm.ID)
+		err = search.UpdateIndex(target, all[i])
+		if err != nil {
+			log.Println("[search] UpdateIndex Error:", err)
+		}
 	}
 }
 
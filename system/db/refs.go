@@ -0,0 +1,190 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"regexp"
+	"sort"
+
+	"github.com/ponzu-cms/ponzu/system/item"
+
+	"github.com/boltdb/bolt"
+)
+
+// uploadPath matches the URL paths of uploaded files within the JSON of content,
+// including full URLs and paths within the HTML of rich text fields. Query
+// strings, such as image transform parameters, are not included.
+var uploadPath = regexp.MustCompile(`/api/uploads/[^"'\s\\?#<>()]+`)
+
+// uploadPaths returns the unique URL paths of uploaded files referenced by the
+// content in j
+func uploadPaths(j []byte) []string {
+	found := make(map[string]bool)
+	for _, p := range uploadPath.FindAll(j, -1) {
+		found[string(p)] = true
+	}
+
+	paths := make([]string, 0, len(found))
+	for p := range found {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// putUploadRefs replaces the references from the content item at the target to
+// uploaded files with those found in its JSON, j. References are stored in
+// __uploadRefs keyed by path and target, and the paths each target references
+// in __contentRefs, so they can be removed when the item changes.
+func putUploadRefs(tx *bolt.Tx, target string, j []byte) error {
+	err := deleteUploadRefs(tx, target)
+	if err != nil {
+		return err
+	}
+
+	paths := uploadPaths(j)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	refs, err := tx.CreateBucketIfNotExists([]byte("__uploadRefs"))
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		err := refs.Put(refKey(p, target), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+
+	content, err := tx.CreateBucketIfNotExists([]byte("__contentRefs"))
+	if err != nil {
+		return err
+	}
+
+	v, err := json.Marshal(paths)
+	if err != nil {
+		return err
+	}
+
+	return content.Put([]byte(target), v)
+}
+
+// deleteUploadRefs removes all references from the content item at the target
+func deleteUploadRefs(tx *bolt.Tx, target string) error {
+	content := tx.Bucket([]byte("__contentRefs"))
+	if content == nil {
+		return nil
+	}
+
+	v := content.Get([]byte(target))
+	if v == nil {
+		return nil
+	}
+
+	var paths []string
+	err := json.Unmarshal(v, &paths)
+	if err != nil {
+		return err
+	}
+
+	if refs := tx.Bucket([]byte("__uploadRefs")); refs != nil {
+		for _, p := range paths {
+			err := refs.Delete(refKey(p, target))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return content.Delete([]byte(target))
+}
+
+func refKey(urlPath, target string) []byte {
+	return []byte(urlPath + "\x00" + target)
+}
+
+// UploadReferences returns the targets of all content items, including those
+// pending approval, whose fields contain the URL path of an uploaded file
+func UploadReferences(urlPath string) ([]string, error) {
+	var targets []string
+	prefix := refKey(urlPath, "")
+
+	err := store.View(func(tx *bolt.Tx) error {
+		refs := tx.Bucket([]byte("__uploadRefs"))
+		if refs == nil {
+			return nil
+		}
+
+		c := refs.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			targets = append(targets, string(k[len(prefix):]))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+// RebuildUploadRefs recreates the index of references from content to uploaded
+// files, by scanning all content of the types in item.Types
+func RebuildUploadRefs() error {
+	return store.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{"__uploadRefs", "__contentRefs"} {
+			err := tx.DeleteBucket([]byte(name))
+			if err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+
+			_, err = tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+
+		for t := range item.Types {
+			for _, ns := range []string{t, t + "__pending"} {
+				b := tx.Bucket([]byte(ns))
+				if b == nil {
+					continue
+				}
+
+				err := b.ForEach(func(k, v []byte) error {
+					return putUploadRefs(tx, ns+":"+string(k), v)
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// InitUploadRefs builds the index of references from content to uploaded files
+// if it does not exist, such as for content saved by previous versions of Ponzu.
+// Like InitSearchIndex, it must be called once item.Types is defined.
+func InitUploadRefs() {
+	var exists bool
+	err := store.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket([]byte("__contentRefs")) != nil
+		return nil
+	})
+	if err != nil || exists {
+		return
+	}
+
+	err = RebuildUploadRefs()
+	if err != nil {
+		log.Println("Error indexing upload references:", err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/ponzu-cms/ponzu/system/item"
+	"github.com/ponzu-cms/ponzu/system/search"
 
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/schema"
@@ -37,16 +38,6 @@ func SetUpload(target string, data url.Values) (int, error) {
 		data.Set("uuid", uid.String())
 	}
 
-	if data.Get("slug") == "" {
-		// create slug based on filename and timestamp/updated fields
-		slug := data.Get("name")
-		slug, err := checkSlugForDuplicate(slug)
-		if err != nil {
-			return 0, err
-		}
-		data.Set("slug", slug)
-	}
-
 	ts := fmt.Sprintf("%d", time.Now().Unix()*1000)
 	if data.Get("timestamp") == "" {
 		data.Set("timestamp", ts)
@@ -56,6 +47,7 @@ func SetUpload(target string, data url.Values) (int, error) {
 
 	// store in database
 	var id uint64
+	var j []byte
 	var err error
 	err = store.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte("__uploads"))
@@ -63,6 +55,15 @@ func SetUpload(target string, data url.Values) (int, error) {
 			return err
 		}
 
+		if data.Get("slug") == "" {
+			// create slug based on filename and timestamp/updated fields
+			slug, err := checkSlugForDuplicate(tx, data.Get("name"))
+			if err != nil {
+				return err
+			}
+			data.Set("slug", slug)
+		}
+
 		if pid == "-1" {
 			// get sequential ID for item
 			id, err = b.NextSequence()
@@ -89,7 +90,7 @@ func SetUpload(target string, data url.Values) (int, error) {
 		}
 
 		// marshal data to json for storage
-		j, err := json.Marshal(file)
+		j, err = json.Marshal(file)
 		if err != nil {
 			return err
 		}
@@ -117,15 +118,138 @@ func SetUpload(target string, data url.Values) (int, error) {
 			return err
 		}
 
+		// add path to __uploadPaths, so the file can be served with its info
+		if file.Path != "" {
+			b, err = tx.CreateBucketIfNotExists([]byte("__uploadPaths"))
+			if err != nil {
+				return err
+			}
+
+			err = b.Put([]byte(file.Path), v)
+			if err != nil {
+				return err
+			}
+		}
+
+		// add hash to __uploadHashes, so identical files can reuse the upload
+		if file.Hash != "" {
+			b, err = tx.CreateBucketIfNotExists([]byte("__uploadHashes"))
+			if err != nil {
+				return err
+			}
+
+			err = b.Put([]byte(file.Hash), v)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
 		return 0, err
 	}
 
+	go func() {
+		// add data to search index
+		target := fmt.Sprintf("__uploads:%d", id)
+		err := search.UpdateIndex(target, j)
+		if err != nil {
+			log.Println("[search] UpdateIndex Error:", err)
+		}
+	}()
+
 	return int(id), nil
 }
 
+// uploadMetadata are the fields of an upload which can be changed after the
+// file is stored, by UpdateUpload
+var uploadMetadata = []string{
+	"alt", "caption", "credit", "license", "tags", "focal_x", "focal_y",
+}
+
+// UpdateUpload replaces the descriptive metadata of an existing upload, such
+// as its alt text, caption and tags, with the values in data. Other fields,
+// which describe the stored file, are not changed.
+func UpdateUpload(target string, data url.Values) error {
+	parts := strings.Split(target, ":")
+	if parts[0] != "__uploads" || len(parts) != 2 {
+		return fmt.Errorf("cannot call UpdateUpload with target: %s", target)
+	}
+
+	meta := url.Values{}
+	for _, k := range uploadMetadata {
+		for _, v := range data[k] {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				meta.Add(k, v)
+			}
+		}
+	}
+
+	var j []byte
+	err := store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("__uploads"))
+		if b == nil {
+			return bolt.ErrBucketNotFound
+		}
+
+		k, err := key(parts[1])
+		if err != nil {
+			return err
+		}
+
+		v := b.Get(k)
+		if v == nil {
+			return fmt.Errorf("no upload found for target: %s", target)
+		}
+
+		file := &item.FileUpload{}
+		err = json.Unmarshal(v, file)
+		if err != nil {
+			return err
+		}
+
+		file.Alt, file.Caption, file.Credit, file.License = "", "", "", ""
+		file.Tags = nil
+		file.FocalX, file.FocalY = 0, 0
+
+		dec := schema.NewDecoder()
+		dec.SetAliasTag("json")
+		dec.IgnoreUnknownKeys(true)
+		err = dec.Decode(file, meta)
+		if err != nil {
+			return err
+		}
+
+		if file.FocalX < 0 || file.FocalX > 1 || file.FocalY < 0 || file.FocalY > 1 {
+			return fmt.Errorf("focal point must be between 0 and 1, got %g, %g", file.FocalX, file.FocalY)
+		}
+
+		file.Updated = time.Now().Unix() * 1000
+
+		j, err = json.Marshal(file)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(k, j)
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		// update data in search index
+		err := search.UpdateIndex(target, j)
+		if err != nil {
+			log.Println("[search] UpdateIndex Error:", err)
+		}
+	}()
+
+	return nil
+}
+
 // Upload returns the value for an upload by its target (__uploads:{id})
 func Upload(target string) ([]byte, error) {
 	val := &bytes.Buffer{}
@@ -181,6 +305,87 @@ func UploadBySlug(slug string) ([]byte, error) {
 	return val.Bytes(), err
 }
 
+// UploadByHash returns the value for the upload of a file by the hex-encoded
+// SHA-256 hash of its content, or nil if no such file has been uploaded
+func UploadByHash(hash string) ([]byte, error) {
+	var target string
+	err := store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("__uploadHashes"))
+		if b == nil {
+			return nil
+		}
+
+		target = string(b.Get([]byte(hash)))
+		return nil
+	})
+	if err != nil || target == "" {
+		return nil, err
+	}
+
+	j, err := Upload(target)
+	if err != nil || len(j) == 0 {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// UploadByPath returns the value for the upload of a file by its URL path, like
+// /api/uploads/2017/05/filename.jpg, or nil if there is no such upload
+func UploadByPath(urlPath string) ([]byte, error) {
+	var target string
+	err := store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("__uploadPaths"))
+		if b == nil {
+			return nil
+		}
+
+		target = string(b.Get([]byte(urlPath)))
+		return nil
+	})
+	if err != nil || target == "" {
+		return nil, err
+	}
+
+	j, err := Upload(target)
+	if err != nil || len(j) == 0 {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// indexUploadPaths builds the __uploadPaths index if it does not exist, such as
+// for files uploaded with previous versions of Ponzu
+func indexUploadPaths() error {
+	return store.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("__uploadPaths")) != nil {
+			return nil
+		}
+
+		paths, err := tx.CreateBucket([]byte("__uploadPaths"))
+		if err != nil {
+			return err
+		}
+
+		b := tx.Bucket([]byte("__uploads"))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var file item.FileUpload
+			err := json.Unmarshal(v, &file)
+			if err != nil || file.Path == "" || len(k) != 8 {
+				return nil
+			}
+
+			target := fmt.Sprintf("__uploads:%d", binary.BigEndian.Uint64(k))
+			return paths.Put([]byte(file.Path), []byte(target))
+		})
+	})
+}
+
 // UploadAll returns a [][]byte containing all upload data from the system
 func UploadAll() [][]byte {
 	var uploads [][]byte
@@ -218,14 +423,47 @@ func DeleteUpload(target string) error {
 		return err
 	}
 
-	return store.Update(func(tx *bolt.Tx) error {
+	err = store.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(parts[0]))
 		if b == nil {
 			return bolt.ErrBucketNotFound
 		}
 
+		// remove the upload's hash and path from __uploadHashes and
+		// __uploadPaths if they point here
+		var file item.FileUpload
+		if j := b.Get(id); j != nil && json.Unmarshal(j, &file) == nil {
+			for bucket, k := range map[string]string{
+				"__uploadHashes": file.Hash,
+				"__uploadPaths":  file.Path,
+			} {
+				index := tx.Bucket([]byte(bucket))
+				if k == "" || index == nil || string(index.Get([]byte(k))) != target {
+					continue
+				}
+
+				err := index.Delete([]byte(k))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
 		return b.Delete(id)
 	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		// delete indexed data from search index
+		err := search.DeleteIndex(target)
+		if err != nil {
+			log.Println("[search] DeleteIndex Error:", err)
+		}
+	}()
+
+	return nil
 }
 
 func key(sid string) ([]byte, error) {
@@ -0,0 +1,356 @@
+// Package imaging transforms uploaded images on demand, resizing and converting
+// them according to the parameters of a request to /api/uploads/, and caches the
+// derived images on disk.
+package imaging
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FitContain scales the image to fit within the width and height, keeping
+	// its aspect ratio. It is the default.
+	FitContain = "contain"
+
+	// FitCover scales the image to cover the width and height, keeping its
+	// aspect ratio, and crops the overflow around its focal point
+	FitCover = "cover"
+
+	// FitFill stretches the image to exactly the width and height
+	FitFill = "fill"
+
+	// MaxDimension is the largest width or height which can be requested
+	MaxDimension = 4096
+
+	// MaxPixels is the largest source image, in pixels, which will be decoded
+	MaxPixels = 50 * 1000 * 1000
+
+	// DefaultQuality is the JPEG quality used when none is requested
+	DefaultQuality = 85
+)
+
+var (
+	// ErrInvalidOptions is returned for transform parameters which are out of
+	// range or unknown
+	ErrInvalidOptions = errors.New("Invalid image transform parameters")
+
+	// ErrUnsupported is returned when the source is not an image which can be
+	// decoded, or the requested format cannot be encoded
+	ErrUnsupported = errors.New("Unsupported image format")
+
+	// ErrTooLarge is returned when the source image exceeds MaxPixels
+	ErrTooLarge = errors.New("Image is too large to transform")
+)
+
+// Options are the transformations applied to an image, parsed from the query
+// parameters w, h, fit, q and fmt
+type Options struct {
+	Width   int
+	Height  int
+	Fit     string
+	Quality int
+	Format  string
+
+	// FocusX and FocusY are the focal point FitCover crops around, as fractions
+	// of the width and height from the top left. They aren't query parameters,
+	// but are set from the upload's focal point, and the center is used if both
+	// are 0.
+	FocusX float64
+	FocusY float64
+}
+
+var params = []string{"w", "h", "fit", "q", "fmt"}
+
+// Requested checks if the query contains any transform parameters
+func Requested(q url.Values) bool {
+	for _, p := range params {
+		if q.Get(p) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseOptions reads the transform parameters from the query, returning
+// ErrInvalidOptions if any are out of range
+func ParseOptions(q url.Values) (Options, error) {
+	var o Options
+	var err error
+
+	dim := func(name string) (int, error) {
+		v := q.Get(name)
+		if v == "" {
+			return 0, nil
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxDimension {
+			return 0, ErrInvalidOptions
+		}
+
+		return n, nil
+	}
+
+	o.Width, err = dim("w")
+	if err != nil {
+		return o, err
+	}
+
+	o.Height, err = dim("h")
+	if err != nil {
+		return o, err
+	}
+
+	o.Fit = strings.ToLower(q.Get("fit"))
+	switch o.Fit {
+	case "":
+		o.Fit = FitContain
+	case FitContain, FitCover, FitFill:
+	default:
+		return o, ErrInvalidOptions
+	}
+
+	if v := q.Get("q"); v != "" {
+		o.Quality, err = strconv.Atoi(v)
+		if err != nil || o.Quality < 1 || o.Quality > 100 {
+			return o, ErrInvalidOptions
+		}
+	}
+
+	o.Format = strings.ToLower(q.Get("fmt"))
+	switch o.Format {
+	case "", "jpeg", "png", "gif":
+	case "jpg":
+		o.Format = "jpeg"
+	default:
+		return o, ErrInvalidOptions
+	}
+
+	return o, nil
+}
+
+// Encode returns the options as a query string in a canonical order, which is
+// used to sign URLs and to key the cache of derived images
+func (o Options) Encode() string {
+	var parts []string
+	if o.Width > 0 {
+		parts = append(parts, fmt.Sprintf("w=%d", o.Width))
+	}
+	if o.Height > 0 {
+		parts = append(parts, fmt.Sprintf("h=%d", o.Height))
+	}
+	if o.Fit != "" && o.Fit != FitContain {
+		parts = append(parts, "fit="+o.Fit)
+	}
+	if o.Quality > 0 {
+		parts = append(parts, fmt.Sprintf("q=%d", o.Quality))
+	}
+	if o.Format != "" {
+		parts = append(parts, "fmt="+o.Format)
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// Sign returns the signature of the transformed image URL, an HMAC of the path
+// and options using the secret, which is sent as the "s" query parameter
+func Sign(secret []byte, urlPath string, o Options) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(urlPath + "?" + o.Encode()))
+
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Verify checks the signature of the transformed image URL
+func Verify(secret []byte, urlPath string, o Options, sig string) bool {
+	expected := Sign(secret, urlPath, o)
+
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(sig)))
+}
+
+// URL returns the path of the uploaded file with the transform options added
+// to its query, signed using the secret if it is not empty
+func URL(secret []byte, urlPath string, o Options) string {
+	q := o.Encode()
+	if len(secret) > 0 {
+		q += "&s=" + Sign(secret, urlPath, o)
+	}
+
+	return urlPath + "?" + strings.TrimPrefix(q, "&")
+}
+
+// Dimensions reads the width and height of the image from its header, without
+// decoding the whole image
+func Dimensions(r io.Reader) (int, int, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return cfg.Width, cfg.Height, nil
+}
+
+// Transform decodes the image read from src, applies the options and writes the
+// encoded result to dst. The image is first turned the way its EXIF orientation
+// says it is displayed, since the result has no EXIF data. It returns the
+// content type of the result.
+func Transform(dst io.Writer, src io.ReadSeeker, o Options) (string, error) {
+	cfg, format, err := image.DecodeConfig(src)
+	if err != nil {
+		return "", ErrUnsupported
+	}
+
+	if cfg.Width*cfg.Height > MaxPixels {
+		return "", ErrTooLarge
+	}
+
+	_, err = src.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	m, err := ReadMetadata(src)
+	if err != nil {
+		// images with metadata which can't be read are shown as they are
+		m = Metadata{}
+	}
+
+	_, err = src.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return "", ErrUnsupported
+	}
+
+	img = fit(orient(img, m.Orientation), o)
+
+	if o.Format != "" {
+		format = o.Format
+	}
+
+	switch format {
+	case "jpeg":
+		q := o.Quality
+		if q == 0 {
+			q = DefaultQuality
+		}
+		return "image/jpeg", jpeg.Encode(dst, img, &jpeg.Options{Quality: q})
+
+	case "png":
+		return "image/png", png.Encode(dst, img)
+
+	case "gif":
+		return "image/gif", gif.Encode(dst, img, nil)
+
+	default:
+		return "", ErrUnsupported
+	}
+}
+
+// fit resizes the image to the options' dimensions, never enlarging it beyond
+// its original size unless the fit is FitFill
+func fit(img image.Image, o Options) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw == 0 || sh == 0 || (o.Width == 0 && o.Height == 0) {
+		return img
+	}
+
+	w, h := o.Width, o.Height
+	if o.Fit == FitFill && w > 0 && h > 0 {
+		return resize(img, w, h)
+	}
+
+	sx := float64(w) / float64(sw)
+	sy := float64(h) / float64(sh)
+
+	var scale float64
+	switch {
+	case w == 0:
+		scale = sy
+	case h == 0:
+		scale = sx
+	case o.Fit == FitCover:
+		scale = sx
+		if sy > sx {
+			scale = sy
+		}
+	default:
+		scale = sx
+		if sy < sx {
+			scale = sy
+		}
+	}
+
+	if scale > 1 {
+		scale = 1
+	}
+
+	rw := int(float64(sw)*scale + 0.5)
+	rh := int(float64(sh)*scale + 0.5)
+	if rw < 1 {
+		rw = 1
+	}
+	if rh < 1 {
+		rh = 1
+	}
+
+	out := image.Image(img)
+	if rw != sw || rh != sh {
+		out = resize(img, rw, rh)
+	}
+
+	if o.Fit != FitCover || w == 0 || h == 0 {
+		return out
+	}
+
+	// crop the overflow around the focal point, keeping the crop within the
+	// image
+	cw, ch := w, h
+	if cw > rw {
+		cw = rw
+	}
+	if ch > rh {
+		ch = rh
+	}
+
+	fx, fy := o.FocusX, o.FocusY
+	if fx == 0 && fy == 0 {
+		fx, fy = 0.5, 0.5
+	}
+
+	x0 := out.Bounds().Min.X + focus(fx, rw, cw)
+	y0 := out.Bounds().Min.Y + focus(fy, rh, ch)
+
+	return crop(out, image.Rect(x0, y0, x0+cw, y0+ch))
+}
+
+// focus returns the offset of a crop of length n from a side of length size,
+// centered on the fraction f of the side where possible
+func focus(f float64, size, n int) int {
+	off := int(f*float64(size)+0.5) - n/2
+	if off > size-n {
+		off = size - n
+	}
+	if off < 0 {
+		off = 0
+	}
+
+	return off
+}
@@ -0,0 +1,697 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// ErrMalformed is returned when the structure of a JPEG or PNG file, or of its
+// EXIF data, cannot be read
+var ErrMalformed = errors.New("Malformed image metadata")
+
+// Metadata is information about a photo read from its EXIF data
+type Metadata struct {
+	// Orientation is the EXIF orientation, from 1 to 8, in which the image is
+	// displayed. It is 0 if unknown.
+	Orientation int
+
+	Make  string
+	Model string
+
+	// Captured is the time the photo was taken, like 2006-01-02T15:04:05,
+	// followed by the time zone offset if it was recorded
+	Captured string
+}
+
+// Camera returns the make and model of the camera which took the photo
+func (m Metadata) Camera() string {
+	if m.Make == "" || strings.HasPrefix(strings.ToLower(m.Model), strings.ToLower(m.Make)) {
+		return m.Model
+	}
+
+	return strings.TrimSpace(m.Make + " " + m.Model)
+}
+
+// EXIF tags which are read, or kept by Strip
+const (
+	tagMake               = 0x010f
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+)
+
+// keep are the tags copied to stripped images, which describe how the image is
+// displayed and how the photo was taken, but not where or by whom. Location
+// (the GPS IFD), maker notes, serial numbers, owner names, comments and
+// embedded thumbnails are removed.
+var keep = map[uint16]bool{
+	tagMake:               true,
+	tagModel:              true,
+	tagOrientation:        true,
+	0x011a:                true, // XResolution
+	0x011b:                true, // YResolution
+	0x0128:                true, // ResolutionUnit
+	0x0131:                true, // Software
+	tagDateTime:           true,
+	0x8298:                true, // Copyright
+	0x829a:                true, // ExposureTime
+	0x829d:                true, // FNumber
+	0x8822:                true, // ExposureProgram
+	0x8827:                true, // ISOSpeedRatings
+	0x9000:                true, // ExifVersion
+	tagDateTimeOriginal:   true,
+	0x9004:                true, // DateTimeDigitized
+	0x9010:                true, // OffsetTime
+	tagOffsetTimeOriginal: true,
+	0x9201:                true, // ShutterSpeedValue
+	0x9202:                true, // ApertureValue
+	0x9204:                true, // ExposureBiasValue
+	0x9207:                true, // MeteringMode
+	0x9209:                true, // Flash
+	0x920a:                true, // FocalLength
+	0xa001:                true, // ColorSpace
+	0xa002:                true, // PixelXDimension
+	0xa003:                true, // PixelYDimension
+	0xa402:                true, // ExposureMode
+	0xa403:                true, // WhiteBalance
+	0xa405:                true, // FocalLengthIn35mmFilm
+	0xa406:                true, // SceneCaptureType
+	0xa433:                true, // LensMake
+	0xa434:                true, // LensModel
+}
+
+var (
+	jpegSOI   = []byte{0xff, 0xd8}
+	pngHeader = []byte("\x89PNG\r\n\x1a\n")
+	exifHead  = []byte("Exif\x00\x00")
+)
+
+// ReadMetadata reads the EXIF data of a JPEG or PNG image. Images of other
+// formats, or without EXIF data, return an empty Metadata.
+func ReadMetadata(r io.Reader) (Metadata, error) {
+	var m Metadata
+
+	br := bufio.NewReader(r)
+	sig, err := br.Peek(len(pngHeader))
+	if err != nil && err != io.EOF {
+		return m, err
+	}
+
+	var exif []byte
+	switch {
+	case bytes.HasPrefix(sig, jpegSOI):
+		exif, err = jpegExif(br)
+	case bytes.Equal(sig, pngHeader):
+		exif, err = pngExif(br)
+	default:
+		return m, nil
+	}
+	if err != nil || exif == nil {
+		return m, err
+	}
+
+	t, err := parseTIFF(exif)
+	if err != nil {
+		return m, err
+	}
+
+	ifd0, err := t.ifd(t.first)
+	if err != nil {
+		return m, err
+	}
+
+	var sub []entry
+	for _, e := range ifd0 {
+		if e.tag == tagExifIFD {
+			sub, err = t.ifd(e.uint(t.order))
+			if err != nil {
+				return m, err
+			}
+		}
+	}
+
+	var dateTime, original, offset string
+	for _, e := range append(ifd0, sub...) {
+		switch e.tag {
+		case tagMake:
+			m.Make = e.string()
+		case tagModel:
+			m.Model = e.string()
+		case tagOrientation:
+			if o := int(e.uint(t.order)); o >= 1 && o <= 8 {
+				m.Orientation = o
+			}
+		case tagDateTime:
+			dateTime = e.string()
+		case tagDateTimeOriginal:
+			original = e.string()
+		case tagOffsetTimeOriginal:
+			offset = e.string()
+		}
+	}
+
+	if original == "" {
+		original, offset = dateTime, ""
+	}
+	m.Captured = exifTime(original, offset)
+
+	return m, nil
+}
+
+// exifTime converts an EXIF date like "2006:01:02 15:04:05" and offset like
+// "-07:00" to the format of Metadata.Captured
+func exifTime(date, offset string) string {
+	if len(date) != 19 || date[4] != ':' || date[7] != ':' || date[10] != ' ' || strings.HasPrefix(date, "0000") {
+		return ""
+	}
+
+	t := strings.Replace(date[:10], ":", "-", 2) + "T" + date[11:]
+	if len(offset) == 6 && (offset[0] == '+' || offset[0] == '-') && offset[3] == ':' {
+		t += offset
+	}
+
+	return t
+}
+
+// Strip copies the JPEG or PNG image read from src to dst without its private
+// metadata: EXIF tags other than those describing how the image is displayed and
+// how the photo was taken, including its location, and XMP, IPTC and comments.
+// The image data itself is copied unchanged.
+func Strip(dst io.Writer, src io.Reader) error {
+	br := bufio.NewReader(src)
+	sig, err := br.Peek(len(pngHeader))
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(sig, jpegSOI):
+		return stripJPEG(dst, br)
+	case bytes.Equal(sig, pngHeader):
+		return stripPNG(dst, br)
+	default:
+		return ErrUnsupported
+	}
+}
+
+// JPEG markers
+const (
+	markerSOS   = 0xda
+	markerEOI   = 0xd9
+	markerAPP0  = 0xe0
+	markerAPP1  = 0xe1
+	markerAPP2  = 0xe2
+	markerAPP14 = 0xee
+	markerAPP15 = 0xef
+	markerCOM   = 0xfe
+)
+
+// nextSegment reads the next marker of a JPEG file and, for markers with one,
+// the payload following it
+func nextSegment(r *bufio.Reader) (byte, []byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	if b != 0xff {
+		return 0, nil, ErrMalformed
+	}
+
+	// markers may be preceded by any number of fill bytes
+	marker := byte(0xff)
+	for marker == 0xff {
+		marker, err = r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// standalone markers have no length or payload
+	if marker == 0x01 || marker >= 0xd0 && marker <= markerEOI {
+		return marker, nil, nil
+	}
+
+	var size uint16
+	err = binary.Read(r, binary.BigEndian, &size)
+	if err != nil {
+		return 0, nil, err
+	}
+	if size < 2 {
+		return 0, nil, ErrMalformed
+	}
+
+	payload := make([]byte, size-2)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return marker, payload, nil
+}
+
+func writeSegment(w io.Writer, marker byte, payload []byte) error {
+	_, err := w.Write([]byte{0xff, marker})
+	if err != nil {
+		return err
+	}
+
+	if payload == nil && (marker == 0x01 || marker >= 0xd0 && marker <= markerEOI) {
+		return nil
+	}
+
+	err = binary.Write(w, binary.BigEndian, uint16(len(payload)+2))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(payload)
+	return err
+}
+
+// jpegExif returns the TIFF data of the EXIF segment of a JPEG file, or nil if
+// it has none
+func jpegExif(r *bufio.Reader) ([]byte, error) {
+	_, err := r.Discard(len(jpegSOI))
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		marker, payload, err := nextSegment(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case marker == markerSOS || marker == markerEOI:
+			return nil, nil
+		case marker == markerAPP1 && bytes.HasPrefix(payload, exifHead):
+			return payload[len(exifHead):], nil
+		}
+	}
+}
+
+func stripJPEG(w io.Writer, r *bufio.Reader) error {
+	_, err := r.Discard(len(jpegSOI))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(jpegSOI)
+	if err != nil {
+		return err
+	}
+
+	for {
+		marker, payload, err := nextSegment(r)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case marker == markerAPP1 && bytes.HasPrefix(payload, exifHead):
+			exif, err := stripExif(payload[len(exifHead):])
+			if err != nil || exif == nil {
+				continue
+			}
+
+			payload = append(append([]byte{}, exifHead...), exif...)
+			if len(payload)+2 > 0xffff {
+				continue
+			}
+
+		case marker == markerAPP0, marker == markerAPP2, marker == markerAPP14:
+			// JFIF, ICC color profiles and Adobe color transforms are needed to
+			// display the image correctly
+
+		case marker >= markerAPP1 && marker <= markerAPP15, marker == markerCOM:
+			// XMP, IPTC, comments and vendor specific data
+			continue
+		}
+
+		err = writeSegment(w, marker, payload)
+		if err != nil {
+			return err
+		}
+
+		// the compressed image data follows the start of scan header
+		if marker == markerSOS || marker == markerEOI {
+			_, err = io.Copy(w, r)
+			return err
+		}
+	}
+}
+
+// pngExif returns the TIFF data of the eXIf chunk of a PNG file, or nil if it
+// has none
+func pngExif(r *bufio.Reader) ([]byte, error) {
+	_, err := r.Discard(len(pngHeader))
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var size uint32
+		err := binary.Read(r, binary.BigEndian, &size)
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		typ := make([]byte, 4)
+		_, err = io.ReadFull(r, typ)
+		if err != nil {
+			return nil, err
+		}
+
+		switch string(typ) {
+		case "IDAT", "IEND":
+			return nil, nil
+		case "eXIf":
+			if size > maxExif {
+				return nil, ErrMalformed
+			}
+
+			data := make([]byte, size)
+			_, err = io.ReadFull(r, data)
+			return data, err
+		}
+
+		_, err = io.CopyN(ioutil.Discard, r, int64(size)+4)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// maxExif is the largest EXIF chunk of a PNG file which is read
+const maxExif = 1 << 20
+
+func stripPNG(w io.Writer, r *bufio.Reader) error {
+	_, err := r.Discard(len(pngHeader))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(pngHeader)
+	if err != nil {
+		return err
+	}
+
+	for {
+		var size uint32
+		err := binary.Read(r, binary.BigEndian, &size)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		typ := make([]byte, 4)
+		_, err = io.ReadFull(r, typ)
+		if err != nil {
+			return err
+		}
+
+		switch string(typ) {
+		case "eXIf":
+			if size > maxExif {
+				return ErrMalformed
+			}
+
+			data := make([]byte, size+4)
+			_, err = io.ReadFull(r, data)
+			if err != nil {
+				return err
+			}
+
+			exif, err := stripExif(data[:size])
+			if err != nil || exif == nil {
+				continue
+			}
+
+			err = writeChunk(w, typ, exif)
+			if err != nil {
+				return err
+			}
+
+		case "tEXt", "zTXt", "iTXt":
+			// text chunks hold comments, XMP and EXIF written by other tools
+			_, err = io.CopyN(ioutil.Discard, r, int64(size)+4)
+			if err != nil {
+				return err
+			}
+
+		default:
+			err = binary.Write(w, binary.BigEndian, size)
+			if err != nil {
+				return err
+			}
+
+			_, err = w.Write(typ)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.CopyN(w, r, int64(size)+4)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeChunk(w io.Writer, typ, data []byte) error {
+	err := binary.Write(w, binary.BigEndian, uint32(len(data)))
+	if err != nil {
+		return err
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(typ)
+	crc.Write(data)
+
+	_, err = w.Write(typ)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// tiff is the TIFF structure which holds EXIF data
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+	first uint32
+}
+
+// entry is a tag of an IFD, with its value in the byte order of the TIFF data
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// typeSizes are the sizes in bytes of the TIFF field types
+var typeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// maxEntries is the most entries read from an IFD
+const maxEntries = 1000
+
+func parseTIFF(data []byte) (*tiff, error) {
+	if len(data) < 8 {
+		return nil, ErrMalformed
+	}
+
+	t := &tiff{data: data}
+	switch string(data[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return nil, ErrMalformed
+	}
+
+	t.first = t.order.Uint32(data[4:8])
+
+	return t, nil
+}
+
+// ifd reads the entries of the IFD at the offset, skipping any which are of an
+// unknown type or have a value outside the data
+func (t *tiff) ifd(off uint32) ([]entry, error) {
+	if uint64(off)+2 > uint64(len(t.data)) {
+		return nil, ErrMalformed
+	}
+
+	n := uint32(t.order.Uint16(t.data[off:]))
+	if n > maxEntries || uint64(off)+2+uint64(n)*12 > uint64(len(t.data)) {
+		return nil, ErrMalformed
+	}
+
+	var entries []entry
+	for i := uint32(0); i < n; i++ {
+		raw := t.data[off+2+i*12 : off+2+i*12+12]
+		e := entry{
+			tag:   t.order.Uint16(raw[0:2]),
+			typ:   t.order.Uint16(raw[2:4]),
+			count: t.order.Uint32(raw[4:8]),
+		}
+
+		size, ok := typeSizes[e.typ]
+		if !ok {
+			continue
+		}
+
+		length := uint64(size) * uint64(e.count)
+		if length <= 4 {
+			e.value = raw[8 : 8+length]
+		} else {
+			at := uint64(t.order.Uint32(raw[8:12]))
+			if at+length > uint64(len(t.data)) {
+				continue
+			}
+			e.value = t.data[at : at+length]
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// uint returns the first value of a SHORT or LONG entry
+func (e entry) uint(order binary.ByteOrder) uint32 {
+	switch {
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(order.Uint16(e.value))
+	case e.typ == 4 && len(e.value) >= 4:
+		return order.Uint32(e.value)
+	default:
+		return 0
+	}
+}
+
+// string returns the value of an ASCII entry
+func (e entry) string() string {
+	if e.typ != 2 {
+		return ""
+	}
+
+	if i := bytes.IndexByte(e.value, 0); i >= 0 {
+		return strings.TrimSpace(string(e.value[:i]))
+	}
+
+	return strings.TrimSpace(string(e.value))
+}
+
+// stripExif returns new TIFF data holding only the tags to keep from the first
+// IFD and its EXIF IFD, or nil if none are kept
+func stripExif(data []byte) ([]byte, error) {
+	t, err := parseTIFF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ifd0, err := t.ifd(t.first)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept0, kept []entry
+	for _, e := range ifd0 {
+		if e.tag == tagExifIFD {
+			sub, err := t.ifd(e.uint(t.order))
+			if err != nil {
+				continue
+			}
+
+			for _, s := range sub {
+				if keep[s.tag] {
+					kept = append(kept, s)
+				}
+			}
+		} else if keep[e.tag] {
+			kept0 = append(kept0, e)
+		}
+	}
+
+	if len(kept0) == 0 && len(kept) == 0 {
+		return nil, nil
+	}
+
+	header := make([]byte, 8)
+	copy(header, data[:4])
+	t.order.PutUint32(header[4:], 8)
+
+	if len(kept) == 0 {
+		return append(header, encodeIFD(t.order, kept0, 8)...), nil
+	}
+
+	// the EXIF IFD follows the first IFD, which points to it
+	pointer := entry{tag: tagExifIFD, typ: 4, count: 1, value: make([]byte, 4)}
+	kept0 = append(kept0, pointer)
+	first := encodeIFD(t.order, kept0, 8)
+	t.order.PutUint32(pointer.value, uint32(8+len(first)))
+	first = encodeIFD(t.order, kept0, 8)
+
+	out := append(header, first...)
+	return append(out, encodeIFD(t.order, kept, uint32(len(out)))...), nil
+}
+
+// encodeIFD writes the entries as an IFD at the offset off of the TIFF data,
+// followed by the values which do not fit within their entries
+func encodeIFD(order binary.ByteOrder, entries []entry, off uint32) []byte {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	n := uint32(len(entries))
+	ifd := make([]byte, 2+12*n+4)
+	order.PutUint16(ifd, uint16(n))
+
+	var values []byte
+	at := off + uint32(len(ifd))
+	for i, e := range entries {
+		raw := ifd[2+12*i : 2+12*i+12]
+		order.PutUint16(raw[0:2], e.tag)
+		order.PutUint16(raw[2:4], e.typ)
+		order.PutUint32(raw[4:8], e.count)
+
+		if len(e.value) <= 4 {
+			copy(raw[8:12], e.value)
+			continue
+		}
+
+		order.PutUint32(raw[8:12], at+uint32(len(values)))
+		values = append(values, e.value...)
+
+		// values begin on a word boundary
+		if len(values)%2 == 1 {
+			values = append(values, 0)
+		}
+	}
+
+	return append(ifd, values...)
+}
@@ -0,0 +1,187 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+type weight struct {
+	index  int
+	weight float64
+}
+
+// resize scales the image to w by h pixels, using a triangle (bilinear) filter
+// which is widened when downscaling so that every source pixel contributes
+func resize(img image.Image, w, h int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	tmp := image.NewRGBA(image.Rect(0, 0, w, b.Dy()))
+	xw := weights(w, b.Dx())
+	for y := 0; y < b.Dy(); y++ {
+		for x, ws := range xw {
+			set(tmp, x, y, ws, src.Pix, func(i int) int { return src.PixOffset(i, y) })
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	yw := weights(h, b.Dy())
+	for y, ws := range yw {
+		for x := 0; x < w; x++ {
+			set(dst, x, y, ws, tmp.Pix, func(i int) int { return tmp.PixOffset(x, i) })
+		}
+	}
+
+	return dst
+}
+
+// set writes the weighted sum of the source pixels in pix, located by offset,
+// to the pixel at x, y. Pixels are premultiplied, so alpha is filtered like color.
+func set(dst *image.RGBA, x, y int, ws []weight, pix []uint8, offset func(int) int) {
+	var r, g, b, a float64
+	for _, w := range ws {
+		o := offset(w.index)
+		r += float64(pix[o]) * w.weight
+		g += float64(pix[o+1]) * w.weight
+		b += float64(pix[o+2]) * w.weight
+		a += float64(pix[o+3]) * w.weight
+	}
+
+	o := dst.PixOffset(x, y)
+	dst.Pix[o] = clamp(r)
+	dst.Pix[o+1] = clamp(g)
+	dst.Pix[o+2] = clamp(b)
+	dst.Pix[o+3] = clamp(a)
+}
+
+func clamp(v float64) uint8 {
+	v = math.Floor(v + 0.5)
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+
+	return uint8(v)
+}
+
+// weights computes, for each of the dst pixels along an axis, the source pixels
+// which contribute to it and their normalized weights
+func weights(dst, src int) [][]weight {
+	scale := float64(src) / float64(dst)
+	support := 1.0
+	if scale > 1 {
+		support = scale
+	}
+
+	out := make([][]weight, dst)
+	for i := range out {
+		center := (float64(i)+0.5)*scale - 0.5
+		left := int(math.Ceil(center - support))
+		right := int(math.Floor(center + support))
+
+		var sum float64
+		var ws []weight
+		for j := left; j <= right; j++ {
+			v := 1 - math.Abs(float64(j)-center)/support
+			if v <= 0 {
+				continue
+			}
+
+			k := j
+			if k < 0 {
+				k = 0
+			}
+			if k > src-1 {
+				k = src - 1
+			}
+
+			ws = append(ws, weight{index: k, weight: v})
+			sum += v
+		}
+
+		if sum == 0 {
+			k := int(center + 0.5)
+			if k < 0 {
+				k = 0
+			}
+			if k > src-1 {
+				k = src - 1
+			}
+			ws = []weight{{index: k, weight: 1}}
+			sum = 1
+		}
+
+		for j := range ws {
+			ws[j].weight /= sum
+		}
+
+		out[i] = ws
+	}
+
+	return out
+}
+
+// crop returns the part of the image within r
+func crop(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+
+	return dst
+}
+
+// orient returns the image as it is displayed with the EXIF orientation o,
+// rotating and flipping its pixels, since the orientation is lost once it is
+// encoded again
+func orient(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	// orientations 5 to 8 turn the image on its side
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2: // flipped horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // flipped vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90° clockwise to display
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90° counterclockwise to display
+				sx, sy = w-1-y, x
+			}
+
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):])
+		}
+	}
+
+	return dst
+}
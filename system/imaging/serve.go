@@ -0,0 +1,196 @@
+package imaging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+	"github.com/ponzu-cms/ponzu/system/storage"
+)
+
+// cacheVersion is part of the key of each cached image, and is increased when
+// images are derived differently so that those cached before are replaced
+const cacheVersion = 2
+
+// CacheDir returns the directory where derived images are cached, within the
+// current directory
+func CacheDir() string {
+	pwd, err := os.Getwd()
+	if err != nil {
+		log.Println("Couldn't find current directory for image cache:", err)
+	}
+
+	return filepath.Join(pwd, "cache", "images")
+}
+
+// Serve writes the image stored at the key, transformed by the parameters in
+// the request query and cropped around the focal point of its upload. Derived
+// images are cached on disk, keyed by the file's size, modification time and
+// focal point so they are replaced if the original changes.
+func Serve(res http.ResponseWriter, req *http.Request, s storage.Storage, key string) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := req.URL.Query()
+	o, err := ParseOptions(q)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if signed, _ := db.ConfigCache("image_signed_urls").(bool); signed {
+		secret, _ := db.ConfigCache("client_secret").(string)
+		if !Verify([]byte(secret), storage.URLPrefix+key, o, q.Get("s")) {
+			res.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	if o.Format == "" {
+		o.Format = formatOf(key)
+	}
+
+	// images are cropped around the focal point set for their upload
+	if j, err := db.UploadByPath(storage.URLPrefix + key); err == nil && j != nil {
+		var upload item.FileUpload
+		if json.Unmarshal(j, &upload) == nil {
+			o.FocusX, o.FocusY = upload.Focus()
+		}
+	}
+	if o.Format == "" {
+		res.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	info, err := s.Stat(key)
+	if err == storage.ErrNotExist {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error getting uploaded image from storage:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s?%s#%d-%d-%d@%g,%g", key, o.Encode(), info.Size, info.ModTime.UnixNano(), cacheVersion, o.FocusX, o.FocusY)))
+	name := hex.EncodeToString(hash[:])
+	cached := filepath.Join(CacheDir(), name[:2], name+"."+o.Format)
+
+	if _, err := os.Stat(cached); os.IsNotExist(err) {
+		err = derive(cached, s, key, o)
+		switch err {
+		case nil:
+		case storage.ErrNotExist:
+			res.WriteHeader(http.StatusNotFound)
+			return
+		case ErrUnsupported:
+			res.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		case ErrTooLarge:
+			res.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		default:
+			log.Println("Error transforming uploaded image:", err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	f, err := os.Open(cached)
+	if err != nil {
+		log.Println("Error opening cached image:", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	res.Header().Set("Content-Type", "image/"+o.Format)
+	res.Header().Set("Cache-Control", db.CachePolicy())
+	res.Header().Set("ETag", `"`+name+`"`)
+	http.ServeContent(res, req, "", info.ModTime, f)
+}
+
+// derive transforms the image stored at the key and writes it to the cache
+func derive(cached string, s storage.Storage, key string, o Options) error {
+	rc, _, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	dir := filepath.Dir(cached)
+	err = os.MkdirAll(dir, os.ModeDir|os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// images from backends which cannot seek are copied to a temporary file,
+	// since the header is read before the image is decoded
+	src, ok := rc.(io.ReadSeeker)
+	if !ok {
+		tmp, err := ioutil.TempFile(dir, ".src-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		_, err = io.Copy(tmp, rc)
+		if err != nil {
+			return err
+		}
+
+		src = tmp
+		_, err = src.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	out, err := ioutil.TempFile(dir, ".out-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	_, err = Transform(out, src, o)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), cached)
+}
+
+// formatOf returns the image format matching the key's file extension
+func formatOf(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".png":
+		return "png"
+	case ".gif":
+		return "gif"
+	default:
+		return ""
+	}
+}
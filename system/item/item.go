@@ -106,6 +106,38 @@ type Omittable interface {
 	Omit(http.ResponseWriter, *http.Request) ([]string, error)
 }
 
+// Referenceable lets a user declare which fields of a content struct hold
+// references to other content, stored as "/api/content?type=X&id=N" strings.
+// The map keys should be the json tag names of the fields, and the values the
+// names of the content types they reference. The GraphQL API uses them to
+// resolve references into nested objects.
+type Referenceable interface {
+	References() map[string]string
+}
+
+// UploadRule limits the files which can be uploaded to a field. Zero values
+// are not checked, apart from the "upload_max_size" config which applies when
+// MaxBytes is not set.
+type UploadRule struct {
+	// MaxBytes is the largest file size allowed
+	MaxBytes int64
+
+	// Types are the allowed MIME types, like "application/pdf", or "image/*"
+	// to allow any subtype. They are compared to the type detected from the
+	// file's content, not the type declared by the client.
+	Types []string
+
+	// Extensions are the allowed file extensions, like ".jpg"
+	Extensions []string
+}
+
+// Uploadable lets a user restrict the files uploaded to the fields of a content
+// type. The map keys should be the json tag names of the file fields to which
+// they correspond, or "*" for a rule applying to any field without its own.
+type Uploadable interface {
+	UploadRules() map[string]UploadRule
+}
+
 // Item should only be embedded into content type structs.
 type Item struct {
 	UUID      uuid.UUID `json:"uuid"`
@@ -2,9 +2,14 @@ package item
 
 import (
 	"fmt"
+	"html"
+	"strings"
 	"time"
 
 	"github.com/ponzu-cms/ponzu/management/editor"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/mapping"
 )
 
 // FileUpload represents the file uploaded to the system
@@ -15,6 +20,30 @@ type FileUpload struct {
 	Path          string `json:"path"`
 	ContentLength int64  `json:"content_length"`
 	ContentType   string `json:"content_type"`
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	Hash          string `json:"hash"`
+	Orientation   int    `json:"orientation"`
+	Camera        string `json:"camera"`
+	Captured      string `json:"captured"`
+
+	Alt     string   `json:"alt"`
+	Caption string   `json:"caption"`
+	Credit  string   `json:"credit"`
+	License string   `json:"license"`
+	Tags    []string `json:"tags"`
+	FocalX  float64  `json:"focal_x"`
+	FocalY  float64  `json:"focal_y"`
+}
+
+// Focus returns the focal point of the image as fractions of its width and
+// height from the top left, or its center if no focal point has been set
+func (f *FileUpload) Focus() (float64, float64) {
+	if f.FocalX == 0 && f.FocalY == 0 {
+		return 0.5, 0.5
+	}
+
+	return f.FocalX, f.FocalY
 }
 
 // String partially implements item.Identifiable and overrides Item's String()
@@ -22,8 +51,8 @@ func (f *FileUpload) String() string { return f.Name }
 
 // MarshalEditor writes a buffer of html to edit a Post and partially implements editor.Editable
 func (f *FileUpload) MarshalEditor() ([]byte, error) {
-	view, err := editor.Form(f,
-		editor.Field{
+	fields := []editor.Field{
+		{
 			View: func() []byte {
 				if f.Path == "" {
 					return nil
@@ -35,20 +64,57 @@ func (f *FileUpload) MarshalEditor() ([]byte, error) {
 				<h5>` + f.Name + `</h5>
 				<ul>
 					<li><span class="grey-text text-lighten-1">Content-Length:</span> ` + fmt.Sprintf("%s", FmtBytes(float64(f.ContentLength))) + `</li>
-					<li><span class="grey-text text-lighten-1">Content-Type:</span> ` + f.ContentType + `</li>
-					<li><span class="grey-text text-lighten-1">Uploaded:</span> ` + FmtTime(f.Timestamp) + `</li>
+					<li><span class="grey-text text-lighten-1">Content-Type:</span> ` + f.ContentType + `</li>` + func() string {
+					if f.Width == 0 || f.Height == 0 {
+						return ""
+					}
+
+					return fmt.Sprintf(`
+					<li><span class="grey-text text-lighten-1">Dimensions:</span> %d &times; %d px</li>`, f.Width, f.Height)
+				}() + `
+					<li><span class="grey-text text-lighten-1">Uploaded:</span> ` + FmtTime(f.Timestamp) + `</li>` + func() string {
+					var photo string
+					if f.Camera != "" {
+						photo += `
+					<li><span class="grey-text text-lighten-1">Camera:</span> ` + html.EscapeString(f.Camera) + `</li>`
+					}
+					if f.Captured != "" {
+						photo += `
+					<li><span class="grey-text text-lighten-1">Captured:</span> ` + html.EscapeString(f.Captured) + `</li>`
+					}
+					if f.Orientation > 1 {
+						photo += fmt.Sprintf(`
+					<li><span class="grey-text text-lighten-1">EXIF Orientation:</span> %d</li>`, f.Orientation)
+					}
+
+					return photo
+				}() + func() string {
+					if f.Hash == "" {
+						return ""
+					}
+
+					return `
+					<li><span class="grey-text text-lighten-1">SHA-256:</span> <code>` + f.Hash + `</code></li>`
+				}() + `
 				</ul>
             </div>
             `)
 			}(),
 		},
-		editor.Field{
+		{
 			View: editor.File("Path", f, map[string]string{
 				"label":       "File Upload",
 				"placeholder": "Upload the file here",
 			}),
 		},
-	)
+	}
+
+	// metadata can be edited once the file has been uploaded
+	if f.Path != "" {
+		fields = append(fields, f.metadataFields()...)
+	}
+
+	view, err := editor.Form(f, fields...)
 	if err != nil {
 		return nil, err
 	}
@@ -81,9 +147,9 @@ func (f *FileUpload) MarshalEditor() ([]byte, error) {
 			// stop some fixed config settings from being modified
 			fields.find('input[name=client_secret]').attr('name', '');
 
-			// hide save, show delete
+			// show delete for existing uploads, which are saved to update metadata
 			if ($('h5').length > 0) {
-				fields.find('.save-post').hide();
+				fields.find('.save-post').show();
 				fields.find('.delete-post').show();
 			} else {
 				fields.find('.save-post').show();
@@ -98,6 +164,129 @@ func (f *FileUpload) MarshalEditor() ([]byte, error) {
 	return view, nil
 }
 
+// metadataFields returns the editor fields for the descriptive metadata of
+// the upload, with a preview of images to pick their focal point from
+func (f *FileUpload) metadataFields() []editor.Field {
+	fields := []editor.Field{
+		{
+			View: editor.Input("Alt", f, map[string]string{
+				"label":       "Alt Text",
+				"type":        "text",
+				"placeholder": "Describe the image for people who cannot see it",
+			}),
+		},
+		{
+			View: editor.Textarea("Caption", f, map[string]string{
+				"label":       "Caption",
+				"placeholder": "Enter a caption",
+			}),
+		},
+		{
+			View: editor.Input("Credit", f, map[string]string{
+				"label":       "Credit",
+				"type":        "text",
+				"placeholder": "Who created the file, e.g. the photographer",
+			}),
+		},
+		{
+			View: editor.Input("License", f, map[string]string{
+				"label":       "License",
+				"type":        "text",
+				"placeholder": "e.g. CC BY 4.0",
+			}),
+		},
+		{
+			View: editor.Tags("Tags", f, map[string]string{
+				"label": "Tags",
+			}),
+		},
+	}
+
+	if !strings.HasPrefix(f.ContentType, "image/") {
+		return fields
+	}
+
+	x, y := f.Focus()
+
+	return append(fields,
+		editor.Field{
+			View: []byte(fmt.Sprintf(`
+			<div class="input-field col s12 __ponzu-focal">
+				<label class="active">Focal Point (Click the image to set where it is cropped around)</label>
+				<div class="__ponzu-focal-preview" style="position: relative; display: inline-block; margin-top: 20px; cursor: crosshair;">
+					<img src="%s" style="display: block; max-width: 100%%; max-height: 400px;"/>
+					<span class="__ponzu-focal-marker" style="position: absolute; left: %g%%; top: %g%%; width: 20px; height: 20px; margin: -10px 0 0 -10px; border: 2px solid #fff; border-radius: 50%%; box-shadow: 0 0 2px 1px rgba(0,0,0,0.6); pointer-events: none;"></span>
+				</div>
+			</div>
+			<script>
+				$(function() {
+					var preview = $('.__ponzu-focal-preview');
+					var marker = preview.find('.__ponzu-focal-marker');
+
+					preview.on('click', function(e) {
+						var img = preview.find('img');
+						var x = Math.min(Math.max((e.pageX - img.offset().left) / img.width(), 0), 1);
+						var y = Math.min(Math.max((e.pageY - img.offset().top) / img.height(), 0), 1);
+
+						$('input[name=focal_x]').val(x.toFixed(3));
+						$('input[name=focal_y]').val(y.toFixed(3));
+						marker.css({left: (x * 100) + '%%', top: (y * 100) + '%%'});
+					});
+				});
+			</script>
+			`, html.EscapeString(f.Path), x*100, y*100)),
+		},
+		editor.Field{
+			View: editor.Input("FocalX", f, map[string]string{
+				"label": "Focal Point X (0 is the left edge, 1 the right)",
+				"type":  "number",
+				"step":  "0.001",
+				"min":   "0",
+				"max":   "1",
+			}),
+		},
+		editor.Field{
+			View: editor.Input("FocalY", f, map[string]string{
+				"label": "Focal Point Y (0 is the top edge, 1 the bottom)",
+				"type":  "number",
+				"step":  "0.001",
+				"min":   "0",
+				"max":   "1",
+			}),
+		},
+	)
+}
+
+// SearchMapping indexes file uploads by name, content type and descriptive
+// metadata such as alt text and tags, storing the values so that matches can be
+// highlighted. Any other fields, such as extracted metadata, are indexed
+// dynamically. Overrides Item's SearchMapping()
+func (f *FileUpload) SearchMapping() (*mapping.IndexMappingImpl, error) {
+	text := bleve.NewTextFieldMapping()
+	text.Store = true
+	text.IncludeTermVectors = true
+
+	doc := bleve.NewDocumentMapping()
+	doc.AddFieldMappingsAt("name", text)
+	doc.AddFieldMappingsAt("content_type", text)
+	doc.AddFieldMappingsAt("alt", text)
+	doc.AddFieldMappingsAt("caption", text)
+	doc.AddFieldMappingsAt("credit", text)
+	doc.AddFieldMappingsAt("tags", text)
+
+	mapping := bleve.NewIndexMapping()
+	mapping.DefaultMapping = doc
+	mapping.StoreDynamic = false
+
+	return mapping, nil
+}
+
+// IndexContent enables the search index for file uploads, used by the admin
+// uploads search. Overrides Item's IndexContent()
+func (f *FileUpload) IndexContent() bool {
+	return true
+}
+
 func (f *FileUpload) Push() []string {
 	return []string{
 		"path",
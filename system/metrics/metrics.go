@@ -0,0 +1,213 @@
+// Package metrics provides operational metrics for the Ponzu server in the
+// Prometheus text exposition format, including API request counts and latency,
+// database and search index statistics, and upload disk usage.
+package metrics
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system"
+	"github.com/ponzu-cms/ponzu/system/db"
+)
+
+// Buckets are the upper bounds in seconds of the request latency histograms
+var Buckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	route  string
+	method string
+	code   int
+}
+
+type routeKey struct {
+	route  string
+	method string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+var (
+	mu        = &sync.Mutex{}
+	requests  = make(map[requestKey]uint64)
+	latencies = make(map[routeKey]*histogram)
+)
+
+// Observe records a request handled by the route (the pattern the handler was
+// registered with), along with the status code and latency of its response
+func Observe(route, method string, code int, latency time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	requests[requestKey{route, method, code}]++
+
+	rk := routeKey{route, method}
+	h, ok := latencies[rk]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(Buckets))}
+		latencies[rk] = h
+	}
+
+	s := latency.Seconds()
+	for i, le := range Buckets {
+		if s <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+// Run adds the /metrics handler to the default http listener. Requests must
+// include the "metrics_token" from the config as a Bearer token, or otherwise
+// use the HTTP Basic Auth credentials set for backups.
+func Run() {
+	http.HandleFunc("/metrics", Auth(metricsHandler))
+}
+
+// Auth wraps a HandlerFunc to check for the metrics token, falling back to
+// system.BasicAuth if the request has no Bearer token
+func Auth(next http.HandlerFunc) http.HandlerFunc {
+	basic := system.BasicAuth(next)
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			basic.ServeHTTP(res, req)
+			return
+		}
+
+		token, _ := db.ConfigCache("metrics_token").(string)
+		if token == "" {
+			res.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		bearer := strings.TrimPrefix(auth, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
+
+func metricsHandler(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	writeRequests(buf)
+	writeSystem(buf)
+
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, err := buf.WriteTo(res)
+	if err != nil {
+		log.Println("Error writing metrics response:", err)
+	}
+}
+
+func writeRequests(buf *bytes.Buffer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	reqKeys := make([]requestKey, 0, len(requests))
+	for k := range requests {
+		reqKeys = append(reqKeys, k)
+	}
+	sort.Slice(reqKeys, func(i, j int) bool {
+		a, b := reqKeys[i], reqKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+
+		return a.code < b.code
+	})
+
+	header(buf, "ponzu_http_requests_total", "counter", "Total API requests by route, method and status code.")
+	for _, k := range reqKeys {
+		sample(buf, "ponzu_http_requests_total", labels(
+			"route", k.route,
+			"method", k.method,
+			"code", fmt.Sprintf("%d", k.code),
+		), float64(requests[k]))
+	}
+
+	routeKeys := make([]routeKey, 0, len(latencies))
+	for k := range latencies {
+		routeKeys = append(routeKeys, k)
+	}
+	sort.Slice(routeKeys, func(i, j int) bool {
+		if routeKeys[i].route != routeKeys[j].route {
+			return routeKeys[i].route < routeKeys[j].route
+		}
+
+		return routeKeys[i].method < routeKeys[j].method
+	})
+
+	name := "ponzu_http_request_duration_seconds"
+	header(buf, name, "histogram", "Latency of API responses by route and method.")
+	for _, k := range routeKeys {
+		h := latencies[k]
+		for i, le := range Buckets {
+			sample(buf, name+"_bucket", labels(
+				"route", k.route,
+				"method", k.method,
+				"le", fmt.Sprintf("%g", le),
+			), float64(h.counts[i]))
+		}
+		sample(buf, name+"_bucket", labels(
+			"route", k.route,
+			"method", k.method,
+			"le", "+Inf",
+		), float64(h.count))
+
+		l := labels("route", k.route, "method", k.method)
+		sample(buf, name+"_sum", l, h.sum)
+		sample(buf, name+"_count", l, float64(h.count))
+	}
+}
+
+// header writes the HELP and TYPE lines for a metric
+func header(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+}
+
+// sample writes a single line for a metric, with its labels already formatted
+func sample(buf *bytes.Buffer, name, labels string, value float64) {
+	fmt.Fprintf(buf, "%s%s %g\n", name, labels, value)
+}
+
+// labels formats pairs of label names and values, escaping the values
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	var l []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		l = append(l, pairs[i]+`="`+escaper.Replace(pairs[i+1])+`"`)
+	}
+
+	return "{" + strings.Join(l, ",") + "}"
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"bytes"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/api/analytics"
+	"github.com/ponzu-cms/ponzu/system/db"
+	"github.com/ponzu-cms/ponzu/system/item"
+	"github.com/ponzu-cms/ponzu/system/search"
+
+	"github.com/tidwall/gjson"
+)
+
+func writeSystem(buf *bytes.Buffer) {
+	writeBolt(buf)
+	writeContent(buf)
+	writeSearch(buf)
+
+	depth, capacity := analytics.Queue()
+	header(buf, "ponzu_analytics_queue_depth", "gauge", "API requests waiting to be recorded in analytics.db.")
+	sample(buf, "ponzu_analytics_queue_depth", "", float64(depth))
+	header(buf, "ponzu_analytics_queue_capacity", "gauge", "Capacity of the analytics request queue.")
+	sample(buf, "ponzu_analytics_queue_capacity", "", float64(capacity))
+
+	size, files := uploadsUsage()
+	header(buf, "ponzu_uploads_bytes", "gauge", "Storage space used by uploaded files.")
+	sample(buf, "ponzu_uploads_bytes", "", float64(size))
+	header(buf, "ponzu_uploads_files", "gauge", "Number of uploaded files.")
+	sample(buf, "ponzu_uploads_files", "", float64(files))
+}
+
+func writeBolt(buf *bytes.Buffer) {
+	stats := db.Store().Stats()
+
+	values := []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"ponzu_bolt_tx_total", "counter", "Total read transactions started in system.db.", float64(stats.TxN)},
+		{"ponzu_bolt_open_tx", "gauge", "Open read transactions in system.db.", float64(stats.OpenTxN)},
+		{"ponzu_bolt_free_pages", "gauge", "Free pages on the system.db freelist.", float64(stats.FreePageN)},
+		{"ponzu_bolt_pending_pages", "gauge", "Pending pages on the system.db freelist.", float64(stats.PendingPageN)},
+		{"ponzu_bolt_free_alloc_bytes", "gauge", "Bytes allocated in free pages of system.db.", float64(stats.FreeAlloc)},
+		{"ponzu_bolt_freelist_inuse_bytes", "gauge", "Bytes used by the system.db freelist.", float64(stats.FreelistInuse)},
+		{"ponzu_bolt_tx_pages_total", "counter", "Page allocations made by system.db transactions.", float64(stats.TxStats.PageCount)},
+		{"ponzu_bolt_tx_page_alloc_bytes_total", "counter", "Bytes allocated for pages by system.db transactions.", float64(stats.TxStats.PageAlloc)},
+		{"ponzu_bolt_tx_cursors_total", "counter", "Cursors created by system.db transactions.", float64(stats.TxStats.CursorCount)},
+		{"ponzu_bolt_tx_nodes_total", "counter", "Node allocations made by system.db transactions.", float64(stats.TxStats.NodeCount)},
+		{"ponzu_bolt_tx_rebalance_total", "counter", "Node rebalances in system.db.", float64(stats.TxStats.Rebalance)},
+		{"ponzu_bolt_tx_rebalance_seconds_total", "counter", "Time spent rebalancing nodes in system.db.", stats.TxStats.RebalanceTime.Seconds()},
+		{"ponzu_bolt_tx_split_total", "counter", "Node splits in system.db.", float64(stats.TxStats.Split)},
+		{"ponzu_bolt_tx_spill_total", "counter", "Node spills in system.db.", float64(stats.TxStats.Spill)},
+		{"ponzu_bolt_tx_spill_seconds_total", "counter", "Time spent spilling nodes in system.db.", stats.TxStats.SpillTime.Seconds()},
+		{"ponzu_bolt_tx_write_total", "counter", "Writes to disk by system.db.", float64(stats.TxStats.Write)},
+		{"ponzu_bolt_tx_write_seconds_total", "counter", "Time spent writing to disk by system.db.", stats.TxStats.WriteTime.Seconds()},
+	}
+
+	for _, g := range values {
+		header(buf, g.name, g.kind, g.help)
+		sample(buf, g.name, "", g.value)
+	}
+}
+
+func writeContent(buf *bytes.Buffer) {
+	header(buf, "ponzu_content_items", "gauge", "Content items stored by type and status.")
+	for _, t := range typeNames() {
+		for _, status := range []string{"public", "pending"} {
+			ns := t
+			if status != "public" {
+				ns += "__" + status
+			}
+
+			n, err := db.ContentCount(ns)
+			if err != nil {
+				log.Println("[metrics] Error counting content:", ns, err)
+				continue
+			}
+
+			sample(buf, "ponzu_content_items", labels("type", t, "status", status), float64(n))
+		}
+	}
+}
+
+func writeSearch(buf *bytes.Buffer) {
+	var names []string
+	for ns := range search.Search {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+
+	header(buf, "ponzu_search_documents", "gauge", "Documents in each search index.")
+	for _, ns := range names {
+		n, err := search.Search[ns].DocCount()
+		if err != nil {
+			log.Println("[metrics] Error getting search index doc count:", err)
+			continue
+		}
+
+		sample(buf, "ponzu_search_documents", labels("type", ns), float64(n))
+	}
+}
+
+func typeNames() []string {
+	var names []string
+	for t := range item.Types {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// usageInterval is how long the upload usage is kept before it is recalculated,
+// since every upload record is read to calculate it
+const usageInterval = 5 * time.Minute
+
+var usage struct {
+	sync.Mutex
+	size, files int64
+	updated     time.Time
+}
+
+// uploadsUsage returns the total size and number of uploaded files, from their
+// records rather than the files themselves, which may not be stored on disk
+func uploadsUsage() (int64, int64) {
+	usage.Lock()
+	defer usage.Unlock()
+
+	if time.Since(usage.updated) < usageInterval {
+		return usage.size, usage.files
+	}
+
+	var size, files int64
+	for _, upload := range db.UploadAll() {
+		size += gjson.GetBytes(upload, "content_length").Int()
+		files++
+	}
+
+	usage.size, usage.files, usage.updated = size, files, time.Now()
+
+	return size, files
+}
@@ -40,7 +40,7 @@ func init() {
 func MapIndex(typeName string) error {
 	// type assert for Searchable, get configuration (which can be overridden)
 	// by Ponzu user if defines own SearchMapping()
-	it, ok := item.Types[typeName]
+	it, ok := typeFor(typeName)
 	if !ok {
 		return fmt.Errorf("[search] MapIndex Error: Failed to MapIndex for %s, type doesn't exist", typeName)
 	}
@@ -105,7 +105,7 @@ func UpdateIndex(id string, data interface{}) error {
 	idx, ok := Search[ns]
 	if ok {
 		// unmarshal json to struct, error if not registered
-		it, ok := item.Types[ns]
+		it, ok := typeFor(ns)
 		if !ok {
 			return fmt.Errorf("[search] UpdateIndex Error: type '%s' doesn't exist", ns)
 		}
@@ -162,3 +162,55 @@ func TypeQuery(typeName, query string, count, offset int) ([]string, error) {
 
 	return results, nil
 }
+
+// Match is a single result from a highlighted search, containing the Ponzu
+// target (Type:ID) of the matched item and any highlighted fragments of text
+// from the fields which matched the query, keyed by field name
+type Match struct {
+	Target    string
+	Score     float64
+	Fragments map[string][]string
+}
+
+// TypeQueryHighlight conducts a search like TypeQuery, but also returns the
+// total number of matches for the query (for pagination) and highlighted
+// fragments for each match. As with db.QueryOptions, offset is a multiplier of
+// count. Fragments are only available for fields which are stored in the index
+// by the type's SearchMapping.
+func TypeQueryHighlight(typeName, query string, count, offset int) ([]Match, int, error) {
+	idx, ok := Search[typeName]
+	if !ok {
+		return nil, 0, ErrNoIndex
+	}
+
+	q := bleve.NewQueryStringQuery(query)
+	req := bleve.NewSearchRequestOptions(q, count, offset*count, false)
+	req.Highlight = bleve.NewHighlight()
+	res, err := idx.Search(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var results []Match
+	for _, hit := range res.Hits {
+		results = append(results, Match{
+			Target:    hit.ID,
+			Score:     hit.Score,
+			Fragments: hit.Fragments,
+		})
+	}
+
+	return results, int(res.Total), nil
+}
+
+// typeFor returns the function to create a new instance of the type indexed
+// within the namespace provided. In addition to the content types registered in
+// item.Types, the system's file uploads are indexed in the "__uploads" namespace
+func typeFor(namespace string) (func() interface{}, bool) {
+	if namespace == "__uploads" {
+		return func() interface{} { return new(item.FileUpload) }, true
+	}
+
+	it, ok := item.Types[namespace]
+	return it, ok
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Local stores files within the Root directory on the local filesystem
+type Local struct {
+	Root string
+}
+
+// Put implements Storage
+func (l *Local) Put(key string, r io.Reader, size int64, contentType string) error {
+	p := l.path(key)
+
+	err := os.MkdirAll(filepath.Dir(p), os.ModeDir|os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, r)
+	if err != nil {
+		dst.Close()
+		os.Remove(p)
+		return err
+	}
+
+	return dst.Close()
+}
+
+// Get implements Storage
+func (l *Local) Get(key string) (io.ReadCloser, Info, error) {
+	f, err := os.Open(l.path(key))
+	if os.IsNotExist(err) {
+		return nil, Info{}, ErrNotExist
+	}
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	info, err := localInfo(f.Stat())
+	if err != nil {
+		f.Close()
+		return nil, Info{}, err
+	}
+
+	info.ContentType = mime.TypeByExtension(path.Ext(key))
+
+	return f, info, nil
+}
+
+// Stat implements Storage
+func (l *Local) Stat(key string) (Info, error) {
+	info, err := localInfo(os.Stat(l.path(key)))
+	if err != nil {
+		return Info{}, err
+	}
+
+	info.ContentType = mime.TypeByExtension(path.Ext(key))
+
+	return info, nil
+}
+
+// Delete implements Storage
+func (l *Local) Delete(key string) error {
+	err := os.Remove(l.path(key))
+	if os.IsNotExist(err) {
+		return ErrNotExist
+	}
+
+	return err
+}
+
+// URL implements Storage
+func (l *Local) URL(key string) string {
+	return urlPath(key)
+}
+
+// path cleans the key so it cannot be used to reach outside of the Root
+func (l *Local) path(key string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func localInfo(fi os.FileInfo, err error) (Info, error) {
+	if os.IsNotExist(err) {
+		return Info{}, ErrNotExist
+	}
+	if err != nil {
+		return Info{}, err
+	}
+
+	if fi.IsDir() {
+		return Info{}, ErrNotExist
+	}
+
+	return Info{
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}, nil
+}
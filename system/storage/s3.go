@@ -0,0 +1,427 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+)
+
+// emptyPayload is the SHA-256 hash of an empty request body
+const emptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 stores files in a bucket of an S3-compatible object store, such as AWS S3,
+// MinIO or DigitalOcean Spaces. Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	// Endpoint is the base URL of the object store, which defaults to
+	// https://s3.{Region}.amazonaws.com
+	Endpoint string
+	Region   string
+	Bucket   string
+
+	AccessKey string
+	SecretKey string
+
+	// Prefix is prepended to every key, to store uploads within a "directory"
+	// of a shared bucket
+	Prefix string
+
+	// PathStyle addresses the bucket in the URL path instead of as a subdomain
+	// of the endpoint, which most self-hosted object stores require
+	PathStyle bool
+
+	Client *http.Client
+
+	// now is used to sign requests, and is overridden by tests
+	now func() time.Time
+}
+
+func s3FromConfig() *S3 {
+	get := func(key string) string {
+		v, _ := db.ConfigCache(key).(string)
+		return v
+	}
+
+	pathStyle, _ := db.ConfigCache("s3_path_style").(bool)
+
+	return &S3{
+		Endpoint:  get("s3_endpoint"),
+		Region:    get("s3_region"),
+		Bucket:    get("s3_bucket"),
+		AccessKey: get("s3_access_key"),
+		SecretKey: get("s3_secret_key"),
+		Prefix:    get("s3_prefix"),
+		PathStyle: pathStyle,
+	}
+}
+
+// Put implements Storage
+func (s *S3) Put(key string, r io.Reader, size int64, contentType string) error {
+	req, err := s.request(http.MethodPut, key, r)
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// Get implements Storage
+func (s *S3) Get(key string) (io.ReadCloser, Info, error) {
+	req, err := s.request(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	info := s3Info(res)
+	if info.Size < 0 {
+		return res.Body, info, nil
+	}
+
+	return &s3Object{s: s, key: key, size: info.Size, body: res.Body}, info, nil
+}
+
+// Stat implements Storage
+func (s *S3) Stat(key string) (Info, error) {
+	req, err := s.request(http.MethodHead, key, nil)
+	if err != nil {
+		return Info{}, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return Info{}, err
+	}
+	res.Body.Close()
+
+	return s3Info(res), nil
+}
+
+// Delete implements Storage
+func (s *S3) Delete(key string) error {
+	req, err := s.request(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// URL implements Storage. Files are served through Ponzu, so that the paths
+// stored for uploads do not depend on the backend.
+func (s *S3) URL(key string) string {
+	return urlPath(key)
+}
+
+// request creates a signed request for the object at the key
+func (s *S3) request(method, key string, body io.Reader) (*http.Request, error) {
+	if s.Bucket == "" {
+		return nil, fmt.Errorf("S3 storage requires a bucket")
+	}
+
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.region())
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	object := strings.TrimPrefix(strings.Trim(s.Prefix, "/")+"/"+strings.TrimPrefix(key, "/"), "/")
+	if s.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + object
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + object
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	// send the path exactly as it is encoded in the signature
+	req.URL.RawPath = uriEncode(req.URL.Path, false)
+
+	payload := emptyPayload
+	if body != nil {
+		// the body is streamed, so its hash is not included in the signature
+		payload = "UNSIGNED-PAYLOAD"
+	}
+
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	s.sign(req)
+
+	return req, nil
+}
+
+// do sends the request, returning ErrNotExist for missing objects and an error
+// for any other unsuccessful response
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotExist
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		return nil, fmt.Errorf("S3 %s %s failed with status %d: %s", req.Method, req.URL.Path, res.StatusCode, msg)
+	}
+
+	return res, nil
+}
+
+func (s *S3) region() string {
+	if s.Region == "" {
+		return "us-east-1"
+	}
+
+	return s.Region
+}
+
+// sign adds the AWS Signature Version 4 Authorization header to the request,
+// signing the host, range and x-amz-* headers. The X-Amz-Content-Sha256 header
+// must already be set.
+func (s *S3) sign(req *http.Request) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "range" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders string
+	for _, k := range names {
+		canonicalHeaders += k + ":" + headers[k] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := strings.Join([]string{t.Format("20060102"), s.region(), "s3", "aws4_request"}, "/")
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// s3Object reads an object from the store and can seek within it, requesting
+// the range from the new offset when it is next read, so that it can be served
+// to Range requests with http.ServeContent
+type s3Object struct {
+	s    *S3
+	key  string
+	size int64
+
+	// off is the offset of the next Read, and at is the offset of body
+	off  int64
+	at   int64
+	body io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.off >= o.size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil || o.at != o.off {
+		if o.body != nil {
+			o.body.Close()
+			o.body = nil
+		}
+
+		req, err := o.s.request(http.MethodGet, o.key, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", o.off))
+		o.s.sign(req)
+
+		res, err := o.s.do(req)
+		if err != nil {
+			return 0, err
+		}
+
+		o.body = res.Body
+		o.at = o.off
+	}
+
+	n, err := o.body.Read(p)
+	o.off += int64(n)
+	o.at += int64(n)
+
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.off
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, fmt.Errorf("Invalid whence for seek: %d", whence)
+	}
+
+	if offset < 0 {
+		return 0, fmt.Errorf("Cannot seek to negative offset: %d", offset)
+	}
+
+	o.off = offset
+
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+
+	return o.body.Close()
+}
+
+func s3Info(res *http.Response) Info {
+	info := Info{
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+	}
+
+	if size, err := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.Size = size
+	}
+
+	if t, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+
+	return info
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		vals := q[k]
+		sort.Strings(vals)
+		for _, v := range vals {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode encodes every byte except the unreserved characters, and slashes
+// unless encodeSlash is set, as required by Signature Version 4
+func uriEncode(s string, encodeSlash bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,97 @@
+// Package storage provides the backends which store files uploaded to Ponzu,
+// on the local filesystem or in an S3-compatible object store. File keys are
+// paths relative to the uploads root, like "2017/06/filename.ext", which are
+// served from the URL path "/api/uploads/2017/06/filename.ext" regardless of
+// the backend used.
+package storage
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ponzu-cms/ponzu/system/db"
+)
+
+const (
+	// URLPrefix is the URL path prefix of all uploaded files
+	URLPrefix = "/api/uploads/"
+
+	// BackendLocal stores uploads in the "uploads" directory within the
+	// current directory. It is the default.
+	BackendLocal = "local"
+
+	// BackendS3 stores uploads in an S3-compatible object store
+	BackendS3 = "s3"
+)
+
+// ErrNotExist is returned when a file key is not found in storage
+var ErrNotExist = errors.New("File does not exist in storage")
+
+// Info describes a stored file
+type Info struct {
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// Storage is implemented by the backends which store uploaded files
+type Storage interface {
+	// Put stores the size bytes read from r at the key
+	Put(key string, r io.Reader, size int64, contentType string) error
+
+	// Get returns the content of the file at the key, which must be closed by
+	// the caller, or ErrNotExist
+	Get(key string) (io.ReadCloser, Info, error)
+
+	// Stat returns information about the file at the key, or ErrNotExist
+	Stat(key string) (Info, error)
+
+	// Delete removes the file at the key
+	Delete(key string) error
+
+	// URL returns the URL path where the file at the key is served
+	URL(key string) string
+}
+
+// Current returns the Storage selected by the "storage_backend" config
+func Current() Storage {
+	backend, _ := db.ConfigCache("storage_backend").(string)
+
+	switch backend {
+	case BackendS3:
+		return s3FromConfig()
+
+	default:
+		pwd, err := os.Getwd()
+		if err != nil {
+			log.Println("Couldn't find current directory for uploads:", err)
+		}
+
+		return &Local{Root: filepath.Join(pwd, "uploads")}
+	}
+}
+
+// Exists checks if a file is stored at the key
+func Exists(s Storage, key string) bool {
+	_, err := s.Stat(key)
+	return err == nil
+}
+
+// Key returns the file key from the URL path of an uploaded file, or an empty
+// string if the path is not within URLPrefix
+func Key(urlPath string) string {
+	if !strings.HasPrefix(urlPath, URLPrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(urlPath, URLPrefix)
+}
+
+func urlPath(key string) string {
+	return URLPrefix + strings.TrimPrefix(key, "/")
+}